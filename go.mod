@@ -2,9 +2,12 @@ module github.com/zricethezav/gitleaks
 
 require (
 	github.com/BurntSushi/toml v0.3.1
+	github.com/OneOfOne/xxhash v1.2.8 // indirect
 	github.com/benmatselby/go-azuredevops v0.1.0
 	github.com/emirpasic/gods v1.12.0 // indirect
 	github.com/franela/goblin v0.0.0-20181003173013-ead4ad1d2727
+	github.com/ghodss/yaml v1.0.0 // indirect
+	github.com/gobwas/glob v0.2.3 // indirect
 	github.com/google/go-github v15.0.0+incompatible
 	github.com/hako/durafmt v0.0.0-20180520121703-7b7ae1e72ead
 	github.com/ipfs/go-ipfs v0.4.19 // indirect
@@ -13,11 +16,16 @@ require (
 	github.com/microsoft/azure-devops-go-api/azuredevops v0.0.0-20190912142452-3207b4a469d3
 	github.com/onsi/ginkgo v1.8.0 // indirect
 	github.com/onsi/gomega v1.5.0 // indirect
+	github.com/open-policy-agent/opa v0.14.2
+	github.com/rcrowley/go-metrics v0.0.0-20181016184325-3113b8401b8a // indirect
 	github.com/sirupsen/logrus v1.0.6
 	github.com/xanzy/go-gitlab v0.11.3
+	github.com/yashtewari/glob-intersection v0.2.0 // indirect
 	golang.org/x/lint v0.0.0-20190409202823-959b441ac422 // indirect
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
 	golang.org/x/sync v0.0.0-20190227155943-e225da77a7e6 // indirect
+	golang.org/x/sys v0.0.0-20190222072716-a9d3bda3a223
+	golang.org/x/text v0.3.0
 	google.golang.org/appengine v1.2.0 // indirect
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
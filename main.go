@@ -1,17 +1,47 @@
 package main
 
 import (
+	"errors"
 	"os"
-	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zricethezav/gitleaks/src"
 )
 
+// subcommands are the commands of gitleaks besides audits, run with the args following
+// their name
+var subcommands = map[string]func(args []string) error{
+	"suppress":     gitleaks.Suppress,
+	"install-hook": gitleaks.InstallHook,
+	"bench":        gitleaks.Bench,
+	"lsp":          gitleaks.LSP,
+	"serve":        gitleaks.Serve,
+	"service":      gitleaks.Service,
+}
+
 func main() {
-	leakCount, err := gitleaks.Run(gitleaks.ParseOpts())
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			if err := subcommand(os.Args[2:]); err != nil {
+				log.Error(err)
+				os.Exit(gitleaks.ErrExit)
+			}
+			os.Exit(0)
+		}
+	}
+
+	opts := gitleaks.ParseOpts()
+	if opts.JSONRPC {
+		if err := gitleaks.ServeJSONRPC(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+			log.Error(err)
+			os.Exit(gitleaks.ErrExit)
+		}
+		os.Exit(0)
+	}
+
+	leakCount, err := gitleaks.Run(opts)
 	if err != nil {
-		if strings.Contains(err.Error(), "whitelisted") {
+		if errors.Is(err, gitleaks.ErrWhitelisted) {
 			log.Info(err.Error())
 			os.Exit(0)
 		}
@@ -0,0 +1,93 @@
+package gitleaks
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// writeActionsOutputs writes the step outputs and the job summary of the run when it runs
+// in GitHub Actions, so workflows use the results without wrapper scripts. The outputs
+// are leaks_found, the leaks found including those of --baseline, new_findings, those not
+// in it, and report_path, the path of --report.
+func writeActionsOutputs(runErr error) {
+	if os.Getenv("GITHUB_ACTIONS") != "true" || opts == nil {
+		return
+	}
+	mutex.Lock()
+	newLeaks, known := telemetry.leaks, telemetry.known
+	rulesFired := make(map[string]int64, len(telemetry.rulesFired))
+	for rule, n := range telemetry.rulesFired {
+		rulesFired[rule] = n
+	}
+	repos, commits, bytes := telemetry.repos, telemetry.commits, telemetry.bytes
+	mutex.Unlock()
+
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		outputs := fmt.Sprintf("leaks_found=%d\nnew_findings=%d\nreport_path=%s\n", newLeaks+known, newLeaks, opts.Report)
+		if err := appendFile(path, outputs); err != nil {
+			log.Warnf("unable to write the step outputs to GITHUB_OUTPUT: %v", err)
+		}
+	}
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		var summary strings.Builder
+		summary.WriteString("## gitleaks\n\n")
+		switch {
+		case runErr != nil:
+			fmt.Fprintf(&summary, ":warning: The audit failed: %s\n\n", markdownEscape(runErr.Error()))
+		case newLeaks == 0:
+			summary.WriteString(":white_check_mark: No new leaks found.\n\n")
+		default:
+			fmt.Fprintf(&summary, ":x: **%d new leaks** found.\n\n", newLeaks)
+		}
+		fmt.Fprintf(&summary, "Audited %d repos, %d commits (%s) in run `%s`.\n\n", repos, commits, formatSize(bytes), runID)
+		if len(rulesFired) != 0 {
+			rules := make([]string, 0, len(rulesFired))
+			for rule := range rulesFired {
+				rules = append(rules, rule)
+			}
+			sort.Slice(rules, func(i, j int) bool {
+				if rulesFired[rules[i]] != rulesFired[rules[j]] {
+					return rulesFired[rules[i]] > rulesFired[rules[j]]
+				}
+				return rules[i] < rules[j]
+			})
+			summary.WriteString("| Rule | Leaks |\n| --- | ---: |\n")
+			for _, rule := range rules {
+				fmt.Fprintf(&summary, "| %s | %d |\n", markdownEscape(rule), rulesFired[rule])
+			}
+			summary.WriteString("\n")
+		}
+		if known != 0 {
+			fmt.Fprintf(&summary, "%d leaks are already in the baseline `%s`.\n\n", known, opts.Baseline)
+		}
+		if opts.Report != "" {
+			fmt.Fprintf(&summary, "Report: `%s`\n", opts.Report)
+		}
+		if err := appendFile(path, summary.String()); err != nil {
+			log.Warnf("unable to write the job summary to GITHUB_STEP_SUMMARY: %v", err)
+		}
+	}
+}
+
+// appendFile appends content to the file at path, like the files of GitHub Actions which
+// earlier steps of the job may have written to
+func appendFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// markdownEscape escapes the characters of s which break markdown tables or inline code
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "`", "\\`", "\n", " ").Replace(s)
+}
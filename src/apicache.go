@@ -0,0 +1,225 @@
+package gitleaks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// etagResponse is a cached api response
+type etagResponse struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	// Stored is when the response was received or last revalidated
+	Stored time.Time `json:"stored"`
+}
+
+// etagTransport is an http.RoundTripper which remembers the ETag of every successful GET
+// and sends it back as If-None-Match on the next request for the same url through the same
+// transport. Github does not count 304 Not Modified responses against the rate limit, in
+// which case the cached body is replayed. Clients are made per audit, which lists each
+// url once, so requests are only saved across runs, with dir.
+//
+// With dir set, responses are also kept on disk between runs, so repeated audits of an
+// organization, e.g. during a remediation sprint, do not list its repos again. Responses
+// younger than ttl are replayed without a request, older ones are revalidated.
+type etagTransport struct {
+	base  http.RoundTripper
+	mu    sync.Mutex
+	cache map[string]*etagResponse
+	dir   string
+	ttl   time.Duration
+}
+
+func newETagTransport(base http.RoundTripper) *etagTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &etagTransport{
+		base:  base,
+		cache: make(map[string]*etagResponse),
+	}
+}
+
+// newAPITransport returns the transport of the clients of provider apis, caching their
+// responses in --api-cache, if set, for --api-cache-ttl
+func newAPITransport(base http.RoundTripper) *etagTransport {
+	t := newETagTransport(base)
+	if opts != nil && opts.APICache != "" {
+		t.dir, t.ttl = opts.APICache, opts.APICacheTTL
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	key := etagKey(req)
+	cached := t.lookup(key)
+
+	if cached != nil && t.ttl > 0 && time.Since(cached.Stored) < t.ttl {
+		log.Debugf("api %s cached %s ago, using cached response", req.URL, time.Since(cached.Stored).Round(time.Second))
+		return cached.replay(req, nil), nil
+	}
+	if cached != nil && (cached.ETag != "" || cached.LastModified != "") {
+		// RoundTrippers must not modify the request they are given
+		req = req.WithContext(req.Context())
+		req.Header = cloneHeader(req.Header)
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		log.Debugf("api %s not modified, using cached response", req.URL)
+		resp.Body.Close()
+		revalidated := *cached
+		revalidated.Stored = time.Now()
+		t.store(key, &revalidated)
+		// keep the up-to-date rate limit headers from the 304
+		return revalidated.replay(req, resp), nil
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "" && t.dir == "") {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	t.store(key, &etagResponse{
+		URL:          req.URL.String(),
+		ETag:         etag,
+		LastModified: lastModified,
+		Header:       cloneHeader(resp.Header),
+		Body:         body,
+		Stored:       time.Now(),
+	})
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// etagKey is the key of the cached response of req. Responses depend on the credentials
+// of the request, the key hashes them rather than storing them on disk.
+func etagKey(req *http.Request) string {
+	h := sha256.New()
+	for _, s := range []string{req.URL.String(), req.Header.Get("Accept"), req.Header.Get("Authorization"), req.Header.Get("Private-Token")} {
+		fmt.Fprintf(h, "%s\x00", s)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// lookup returns the cached response of key, read from dir if it is not in memory
+func (t *etagTransport) lookup(key string) *etagResponse {
+	t.mu.Lock()
+	cached := t.cache[key]
+	t.mu.Unlock()
+	if cached != nil || t.dir == "" {
+		return cached
+	}
+	content, err := ioutil.ReadFile(filepath.Join(t.dir, key+".json"))
+	if err != nil {
+		return nil
+	}
+	cached = &etagResponse{}
+	if err := json.Unmarshal(content, cached); err != nil {
+		log.Debugf("ignoring invalid api cache entry %s: %v", key, err)
+		return nil
+	}
+	t.mu.Lock()
+	t.cache[key] = cached
+	t.mu.Unlock()
+	return cached
+}
+
+// store caches response under key, and writes it to dir if set. Failing to write the
+// cache only costs the requests of the next run, so it is not an error.
+func (t *etagTransport) store(key string, response *etagResponse) {
+	t.mu.Lock()
+	t.cache[key] = response
+	t.mu.Unlock()
+	if t.dir == "" {
+		return
+	}
+	content, err := json.Marshal(response)
+	if err != nil {
+		log.Debugf("unable to cache %s: %v", response.URL, err)
+		return
+	}
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		log.Debugf("unable to cache %s: %v", response.URL, err)
+		return
+	}
+	// written through a temporary file, so concurrent runs never read partial entries
+	tmp, err := ioutil.TempFile(t.dir, key+".*.tmp")
+	if err != nil {
+		log.Debugf("unable to cache %s: %v", response.URL, err)
+		return
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(t.dir, key+".json"))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Debugf("unable to cache %s: %v", response.URL, err)
+	}
+}
+
+// replay returns the cached response as a response to req. The headers of notModified,
+// the 304 revalidating it if any, take precedence.
+func (cached *etagResponse) replay(req *http.Request, notModified *http.Response) *http.Response {
+	header := cloneHeader(cached.Header)
+	resp := &http.Response{
+		Status:     http.StatusText(http.StatusOK),
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(cached.Body)),
+		Request:    req,
+	}
+	if notModified != nil {
+		for k, v := range notModified.Header {
+			header[k] = v
+		}
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = notModified.Proto, notModified.ProtoMajor, notModified.ProtoMinor
+	}
+	return resp
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
@@ -0,0 +1,227 @@
+package gitleaks
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// archiveMaxSize is the size of the largest archive, or file of an archive, audited with
+// --scan-archives. Archives are read into memory, zips need random access, and the limit
+// stops archives which decompress into far more than their size.
+const archiveMaxSize = 50 << 20
+
+// archiveMaxTotalSize is the number of bytes all the files of an archive, those of nested
+// archives included, are read into. Past it the rest of the archive is not audited, as
+// archives of many files under archiveMaxSize, or of nested archives, can decompress
+// into far more than archiveMaxSize.
+var archiveMaxTotalSize int64 = 200 << 20
+
+// errArchiveBudget stops the audit of an archive whose files decompress into more than
+// archiveMaxTotalSize
+var errArchiveBudget = errors.New("its files decompress into more than the total size audited of an archive")
+
+// archiveSeparator separates the path of an archive from the path of a file in it, e.g.
+// dist/app.jar!config/app.properties
+const archiveSeparator = "!"
+
+// archiveKind returns the kind of archive of a file by its name, zip, tar, tgz or gz,
+// or "" if it is none
+func archiveKind(name string) string {
+	name = strings.ToLower(name)
+	switch path.Ext(name) {
+	case ".zip", ".jar", ".war", ".ear", ".apk", ".whl", ".nupkg":
+		return "zip"
+	case ".tar":
+		return "tar"
+	case ".tgz":
+		return "tgz"
+	case ".gz":
+		if strings.HasSuffix(name, ".tar.gz") {
+			return "tgz"
+		}
+		return "gz"
+	}
+	return ""
+}
+
+// auditArchive audits the files of the archive of commit, opened by open, if
+// --scan-archives is set. Returns true if the file is an archive and so is audited, false
+// if it is audited like any other file.
+func (repo *Repo) auditArchive(commit *Commit, open func() (io.ReadCloser, error)) bool {
+	if !opts.ScanArchives || archiveKind(commit.filePath) == "" {
+		return false
+	}
+	rc, err := open()
+	if err != nil {
+		log.Debugf("unable to open archive %s: %v", commit.filePath, err)
+		return true
+	}
+	defer rc.Close()
+	content, err := readArchiveFile(rc, nil)
+	if err != nil {
+		log.Debugf("skipping archive %s: %v", commit.filePath, err)
+		return true
+	}
+	budget := archiveMaxTotalSize
+	if err := repo.inspectArchive(commit, content, 1, &budget); err != nil {
+		log.Warnf("audited archive %s partially, %v (%s)", commit.filePath, err, formatSize(archiveMaxTotalSize))
+		degrade()
+	}
+	return true
+}
+
+// blobOpener returns a func opening the blob of hash, for auditArchive
+func (repo *Repo) blobOpener(hash plumbing.Hash) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		blob, err := repo.repository.BlobObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		return blob.Reader()
+	}
+}
+
+// inspectArchive inspects the files of the archive content of commit, at depth depth of
+// nested archives. Leaks are reported with the path of the archive and of the file in it.
+// The files read are taken from budget, the bytes its top-level archive may still be
+// read into, and errArchiveBudget is returned once it is spent.
+func (repo *Repo) inspectArchive(commit *Commit, content []byte, depth int, budget *int64) error {
+	err := walkArchive(commit.filePath, content, budget, func(name string, data []byte) error {
+		file := *commit
+		file.filePath = commit.filePath + archiveSeparator + name
+		if skipWhitelistedFile(&file) {
+			return nil
+		}
+		repo.auditFileRules(&file)
+		if archiveKind(name) != "" {
+			if depth >= opts.MaxArchiveDepth {
+				log.Debugf("skipping archive %s, nested deeper than --max-archive-depth", file.filePath)
+				return nil
+			}
+			return repo.inspectArchive(&file, data, depth+1, budget)
+		}
+		if bytes.IndexByte(data, 0) != -1 {
+			// binary file
+			return nil
+		}
+		if err := repo.inspectReader(bytes.NewReader(data), int64(len(data)), &file); err != nil {
+			log.Debugf("unable to read %s: %v", file.filePath, err)
+		}
+		return nil
+	})
+	if err == errArchiveBudget {
+		return err
+	} else if err != nil {
+		log.Debugf("unable to read archive %s: %v", commit.filePath, err)
+	}
+	return nil
+}
+
+// walkArchive calls fn with the path and content of each regular file of the archive
+// content named name, until fn returns an error or the files read spend budget. Files
+// larger than archiveMaxSize are skipped.
+func walkArchive(name string, content []byte, budget *int64, fn func(name string, data []byte) error) error {
+	switch archiveKind(name) {
+	case "zip":
+		zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				log.Debugf("unable to open %s of archive %s: %v", f.Name, name, err)
+				continue
+			}
+			data, err := readArchiveFile(rc, budget)
+			rc.Close()
+			if err == errArchiveBudget {
+				return err
+			} else if err != nil {
+				log.Debugf("skipping %s of archive %s: %v", f.Name, name, err)
+				continue
+			}
+			if err := fn(f.Name, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "gz":
+		zr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		data, err := readArchiveFile(zr, budget)
+		if err != nil {
+			return err
+		}
+		return fn(strings.TrimSuffix(path.Base(name), path.Ext(name)), data)
+	}
+
+	var r io.Reader = bytes.NewReader(content)
+	if archiveKind(name) == "tgz" {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		data, err := readArchiveFile(tr, budget)
+		if err == errArchiveBudget {
+			return err
+		} else if err != nil {
+			log.Debugf("skipping %s of archive %s: %v", hdr.Name, name, err)
+			continue
+		}
+		if err := fn(strings.TrimPrefix(path.Clean("/"+hdr.Name), "/"), data); err != nil {
+			return err
+		}
+	}
+}
+
+// readArchiveFile reads an archive, or a file of one, of at most archiveMaxSize. The bytes
+// read are taken from budget, if set, returning errArchiveBudget once it is spent.
+func readArchiveFile(r io.Reader, budget *int64) ([]byte, error) {
+	limit := int64(archiveMaxSize)
+	if budget != nil && *budget < limit {
+		limit = *budget
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if budget != nil {
+		if *budget -= int64(len(data)); *budget < 0 {
+			return nil, errArchiveBudget
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > archiveMaxSize {
+		return nil, fmt.Errorf("larger than %s", formatSize(archiveMaxSize))
+	}
+	return data, nil
+}
@@ -0,0 +1,251 @@
+package gitleaks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	inTotoPayloadType   = "application/vnd.in-toto+json"
+	// scanPredicateType identifies the predicate of gitleaks attestations
+	scanPredicateType = "https://github.com/zricethezav/gitleaks/attestation/scan/v1"
+)
+
+var (
+	// attestSubjects are the repos audited by the run, the subjects of --attest
+	attestSubjects []inTotoSubject
+	// attestRulesFired counts the leaks of each rule in the repos of attestSubjects
+	attestRulesFired map[string]int
+)
+
+// dsseEnvelope is a signed in-toto statement, see
+// https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+type inTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []inTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     scanPredicate   `json:"predicate"`
+}
+
+// inTotoSubject is an audited repo at the commit it was audited at
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// scanPredicate summarizes the findings of the run, so policy engines can require a
+// passed secret scan without parsing reports
+type scanPredicate struct {
+	Scanner struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scanner"`
+	RunID string `json:"runID"`
+	// ConfigDigest is the sha256 of the gitleaks config of the run
+	ConfigDigest map[string]string `json:"configDigest"`
+	StartedOn    time.Time         `json:"startedOn"`
+	FinishedOn   time.Time         `json:"finishedOn"`
+	// Passed is true if no leak failed the audit, and with --strict if the audit was
+	// complete
+	Passed       bool           `json:"passed"`
+	Leaks        int            `json:"leaks"`
+	RulesFired   map[string]int `json:"rulesFired"`
+	Degradations int64          `json:"degradations"`
+	Report       *inTotoSubject `json:"report,omitempty"`
+}
+
+// recordAttestSubject adds the repo at its HEAD commit to the subjects of --attest, and
+// the leaks of each rule found in it to the findings summary
+func (repo *Repo) recordAttestSubject(rulesFired map[string]int) {
+	if opts.Attest == "" || repo.repository == nil {
+		return
+	}
+	head, err := repo.repository.Head()
+	if err != nil {
+		log.Debugf("unable to attest %s without a HEAD: %v", repo.name, err)
+		return
+	}
+	// name the repo by its web url, or else by its path
+	name := repo.name
+	if abs, err := filepath.Abs(repo.path); repo.path != "" && err == nil {
+		name = abs
+	}
+	for _, u := range repo.remoteURLs() {
+		if web := webURL(u); web != "" {
+			name = web
+			break
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	attestSubjects = append(attestSubjects, inTotoSubject{
+		Name:   name,
+		Digest: map[string]string{"gitCommit": head.Hash().String()},
+	})
+	if attestRulesFired == nil {
+		attestRulesFired = make(map[string]int)
+	}
+	for rule, n := range rulesFired {
+		attestRulesFired[rule] += n
+	}
+}
+
+// writeAttestation writes an in-toto statement about the run to --attest, signed with
+// --attest-key as a DSSE envelope. failing is the number of leaks failing the audit.
+func writeAttestation(failing int, started time.Time) error {
+	signer, err := loadAttestKey(opts.AttestKey)
+	if err != nil {
+		return err
+	}
+	statement := inTotoStatement{
+		Type:          inTotoStatementType,
+		Subject:       attestSubjects,
+		PredicateType: scanPredicateType,
+	}
+	if statement.Subject == nil {
+		statement.Subject = []inTotoSubject{}
+	}
+	sort.Slice(statement.Subject, func(i, j int) bool { return statement.Subject[i].Name < statement.Subject[j].Name })
+	p := &statement.Predicate
+	p.Scanner.Name = "gitleaks"
+	p.Scanner.Version = version
+	p.RunID = runID
+	if config != nil {
+		p.ConfigDigest = map[string]string{"sha256": config.digest}
+	}
+	p.StartedOn = started.UTC()
+	p.FinishedOn = time.Now().UTC()
+	p.Degradations = atomic.LoadInt64(&degradations)
+	p.Leaks = failing
+	p.Passed = failing == 0 && (!opts.Strict || p.Degradations == 0)
+	p.RulesFired = attestRulesFired
+	if p.RulesFired == nil {
+		p.RulesFired = map[string]int{}
+	}
+	if opts.Report != "" {
+		if b, err := ioutil.ReadFile(opts.Report); err == nil {
+			p.Report = &inTotoSubject{Name: opts.Report, Digest: map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256(b))}}
+		}
+	}
+
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return err
+	}
+	sig, err := signer.sign(dssePAE(inTotoPayloadType, payload))
+	if err != nil {
+		return fmt.Errorf("unable to sign attestation: %v", err)
+	}
+	envelope := dsseEnvelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []dsseSignature{{KeyID: signer.keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}
+	b, err := json.MarshalIndent(envelope, "", "\t")
+	if err != nil {
+		return err
+	}
+	log.Infof("writing attestation to %s", opts.Attest)
+	return ioutil.WriteFile(opts.Attest, append(b, '\n'), 0644)
+}
+
+// dssePAE is the pre-authentication encoding of DSSE, the message which is signed
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte("DSSEv1 " + strconv.Itoa(len(payloadType)) + " " + payloadType + " " + strconv.Itoa(len(payload)) + " " + string(payload))
+}
+
+// attestSigner signs attestations with an ed25519 or ecdsa key. keyID is the hex
+// sha256 of the public key, so verifiers can pick the key to check.
+type attestSigner struct {
+	key   crypto.Signer
+	keyID string
+}
+
+// loadAttestKey reads a PEM encoded PKCS8 ed25519 or ecdsa private key, as written by
+// openssl genpkey -algorithm ed25519
+func loadAttestKey(path string) (*attestSigner, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read --attest-key: %v", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("--attest-key %s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if ecKey, ecErr := x509.ParseECPrivateKey(block.Bytes); ecErr == nil {
+			key = ecKey
+		} else {
+			return nil, fmt.Errorf("unable to parse --attest-key %s: %v", path, err)
+		}
+	}
+	var signer crypto.Signer
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signer = k
+	case *ecdsa.PrivateKey:
+		signer = k
+	default:
+		return nil, fmt.Errorf("--attest-key %s must be an ed25519 or ecdsa key", path)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &attestSigner{key: signer, keyID: fmt.Sprintf("%x", sha256.Sum256(pub))}, nil
+}
+
+func (s *attestSigner) sign(message []byte) ([]byte, error) {
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		return s.key.Sign(rand.Reader, message, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(message)
+	return s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// guardAttest validates --attest and --attest-key
+func (opts *Options) guardAttest() error {
+	if opts.Attest == "" {
+		if opts.AttestKey != "" {
+			return fmt.Errorf("--attest-key requires --attest")
+		}
+		return nil
+	}
+	if opts.AttestKey == "" {
+		return fmt.Errorf("--attest requires --attest-key")
+	}
+	if _, err := os.Stat(opts.AttestKey); err != nil {
+		return fmt.Errorf("--attest-key %s does not exist", opts.AttestKey)
+	}
+	return nil
+}
@@ -2,10 +2,8 @@ package gitleaks
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
-	"os/exec"
-	"strings"
+	"strconv"
 
 	"context"
 
@@ -14,6 +12,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	gogit "gopkg.in/src-d/go-git.v4"
+	gitHttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
 )
 
 // auditGitlabRepos kicks off audits if --gitlab-user or --gitlab-org options are set.
@@ -24,6 +23,7 @@ func auditAzureDevOpsRepos() (int, error) {
 		tempDir string
 		err     error
 		leaks   []Leak
+		forks   = make(map[string]bool)
 	)
 
 	organizationUrl := "https://dev.azure.com/" + opts.AzdevOrg // todo: replace value with your organization url
@@ -36,63 +36,128 @@ func auditAzureDevOpsRepos() (int, error) {
 
 	gitClient, err := git.NewClient(ctx, connection)
 	if err != nil {
-		log.Fatal(err)
+		return NoLeaks, err
 	}
 
+	enumerateTrace := startTrace("enumerate", "").set("owner", opts.AzdevOrg)
 	repos, err := gitClient.GetRepositories(ctx, git.GetRepositoriesArgs{})
 	if err != nil {
-		log.Fatal(err)
+		enumerateTrace.finish()
+		return NoLeaks, err
 	}
 
-	log.Debugf("found repositories: %d", len(*repos))
+	guard, err := newDiscoveryGuard(opts.AzdevOrg)
+	if err != nil {
+		return NoLeaks, err
+	}
+	var shardRepos []git.GitRepository
+	for _, p := range *repos {
+		if !inShard(*p.Name) {
+			continue
+		}
+		var size int64
+		if p.Size != nil {
+			size = int64(*p.Size)
+		}
+		if err = guard.add(size); err != nil {
+			return NoLeaks, err
+		}
+		shardRepos = append(shardRepos, p)
+	}
+	enumerateTrace.set("repos", strconv.Itoa(len(shardRepos))).finish()
+	log.Debugf("found repositories: %s", guard)
 
-	if tempDir, err = createAzureDevOpsTempDir(); err != nil {
-		log.Fatal("error creating temp directory: ", err)
+	if opts.Disk {
+		if tempDir, err = createAzureDevOpsTempDir(); err != nil {
+			return NoLeaks, fmt.Errorf("error creating temp directory: %v", err)
+		}
 	}
 
-	for _, p := range *repos {
+	for _, p := range shardRepos {
+		if isInterrupted() {
+			break
+		}
 		repo, err := cloneAzureDevopsRepo(tempDir, &p)
 		if err != nil {
-			log.Warn(err)
-			os.RemoveAll(fmt.Sprintf("%s/%s", tempDir, p.Id))
+			skipRepo(err)
+			if opts.Disk {
+				removeClone(fmt.Sprintf("%s/%s", tempDir, p.Id))
+			}
 			continue
 		}
 
 		err = repo.audit()
 		if err != nil {
-			log.Warn(err)
-			os.RemoveAll(fmt.Sprintf("%s/%s", tempDir, p.Id))
+			skipRepo(err)
+			if opts.Disk {
+				removeClone(fmt.Sprintf("%s/%s", tempDir, p.Id))
+			}
 			continue
 		}
 
-		os.RemoveAll(fmt.Sprintf("%s/%s", tempDir, p.Id))
+		if opts.Disk {
+			removeClone(fmt.Sprintf("%s/%s", tempDir, p.Id))
+		}
 
 		repo.report()
 		leaks = append(leaks, repo.leaks...)
+		if repo.fork {
+			forks[repo.name] = true
+		}
 	}
 
-	if opts.Report != "" {
+	leaks = dedupForks(leaks, forks)
+	if opts.writesReport() {
 		err = writeReport(leaks)
 		if err != nil {
 			return NoLeaks, err
 		}
 	}
 
-	return len(leaks), nil
+	return failingLeaks(leaks), nil
 }
 
 func createAzureDevOpsTempDir() (string, error) {
 
-	pathName := opts.AzdevOrg
+	return ownerCloneDir(opts.AzdevOrg)
+}
 
-	os.RemoveAll(fmt.Sprintf("%s/%s", dir, pathName))
+// azureDevOpsAuth returns the credentials used to clone over https, if AZURE_DEVOPS_TOKEN is set
+func azureDevOpsAuth() *gitHttp.BasicAuth {
+	if token := os.Getenv("AZURE_DEVOPS_TOKEN"); token != "" {
+		return &gitHttp.BasicAuth{
+			Username: "fakeUsername", // yes, this can be anything except an empty string
+			Password: token,
+		}
+	}
+	return nil
+}
 
-	ownerDir, err := ioutil.TempDir(dir, pathName)
-	if err != nil {
-		return "", err
+// azureDevOpsCloneOptions returns the clone options of p. Repos are cloned over https
+// with AZURE_DEVOPS_TOKEN, or over ssh if the token is not set or --azdev-ssh is set,
+// e.g. for tokens scoped to the api.
+func azureDevOpsCloneOptions(p *git.GitRepository) (*gogit.CloneOptions, error) {
+	if opts.AzdevSSH || azureDevOpsAuth() == nil {
+		if p.SshUrl != nil {
+			if sshAuth := config.sshAuthFor(*p.SshUrl); sshAuth != nil {
+				return &gogit.CloneOptions{URL: *p.SshUrl, Auth: sshAuth}, nil
+			}
+		}
+		if opts.AzdevSSH {
+			return nil, fmt.Errorf("skipping %s, no ssh url or key to clone it over ssh, set --ssh-key or [[auth.ssh]]", *p.Name)
+		}
 	}
 
-	return ownerDir, nil
+	opt := &gogit.CloneOptions{
+		URL: *p.WebUrl,
+	}
+	if p.RemoteUrl != nil {
+		opt.URL = *p.RemoteUrl
+	}
+	if auth := azureDevOpsAuth(); auth != nil {
+		opt.Auth = auth
+	}
+	return opt, nil
 }
 
 func cloneAzureDevopsRepo(tempDir string, p *git.GitRepository) (*Repo, error) {
@@ -101,25 +166,38 @@ func cloneAzureDevopsRepo(tempDir string, p *git.GitRepository) (*Repo, error) {
 		err  error
 	)
 
-	gitAzureDevOpsToken := os.Getenv("AZURE_DEVOPS_TOKEN")
+	var urls []string
+	for _, u := range []*string{p.RemoteUrl, p.SshUrl, p.WebUrl} {
+		if u != nil {
+			urls = append(urls, *u)
+		}
+	}
+	if re := whitelistedRepo(*p.Name, urls...); re != nil {
+		return nil, fmt.Errorf("skipping %s, %w%s", *p.Name, ErrWhitelisted, re.describe())
+	}
 
-	log.Infof("cloning: %s", *p.Name)
-	cloneTarget := fmt.Sprintf("%s/%s", tempDir, *p.Id)
-	auth := "https://" + "fakeUsername:" + gitAzureDevOpsToken + "@"
-	repository := strings.Replace(*p.WebUrl, "https://", auth, 1)
-	cmdOutput, err := exec.Command("git", "clone", repository, cloneTarget).Output()
+	opt, err := azureDevOpsCloneOptions(p)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	log.Infof("cloning: %s", *p.Name)
+	cloneTrace := startTrace("clone", "").set("repo", *p.Name)
+	defer cloneTrace.finish()
+
+	if opts.Disk {
+		repo, err = plainClone(fmt.Sprintf("%s/%s", tempDir, *p.Id), opt)
+	} else {
+		repo, err = memoryClone(opt)
 	}
-	fmt.Printf("%s", cmdOutput)
-	repo, err = gogit.PlainOpen(cloneTarget)
 
 	if err != nil {
-		return nil, err
+		return nil, cloneError(err)
 	}
 
 	return &Repo{
 		repository: repo,
 		name:       *p.Name,
+		fork:       p.IsFork != nil && *p.IsFork,
 	}, nil
 }
@@ -0,0 +1,183 @@
+package gitleaks
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/microsoft/azure-devops-go-api/azuredevops"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/git"
+	log "github.com/sirupsen/logrus"
+)
+
+// azdevPushEvent is the payload of git.push service hooks
+type azdevPushEvent struct {
+	EventType string `json:"eventType"`
+	Resource  struct {
+		Commits    []struct{} `json:"commits"`
+		RefUpdates []struct {
+			Name        string `json:"name"`
+			OldObjectID string `json:"oldObjectId"`
+			NewObjectID string `json:"newObjectId"`
+		} `json:"refUpdates"`
+		Repository struct {
+			ID        string `json:"id"`
+			Name      string `json:"name"`
+			RemoteURL string `json:"remoteUrl"`
+			Project   struct {
+				ID string `json:"id"`
+			} `json:"project"`
+		} `json:"repository"`
+	} `json:"resource"`
+}
+
+// azdevStatusTarget is the branch a scan of a service hook sets the status of the pull
+// requests of
+type azdevStatusTarget struct {
+	project, repositoryID string
+	// ref is the full name of the pushed branch, e.g. refs/heads/feature
+	ref string
+}
+
+// azdevWebhook handles POST /azdev/webhook. git.push service hooks whose basic auth
+// password is AZURE_DEVOPS_WEBHOOK_SECRET queue a scan of each pushed branch, whose
+// result is set as the gitleaks/leaks status of the active pull requests of the branch.
+// A branch policy requiring that status blocks the completion of pull requests with leaks.
+func (s *scanServer) azdevWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use POST /azdev/webhook")
+		return
+	}
+	secret := os.Getenv("AZURE_DEVOPS_WEBHOOK_SECRET")
+	if secret == "" {
+		writeAPIError(w, http.StatusServiceUnavailable, "set AZURE_DEVOPS_WEBHOOK_SECRET to receive azure devops service hooks")
+		return
+	}
+	// service hooks authenticate with basic auth, the username is not checked
+	if _, password, ok := r.BasicAuth(); !ok || subtle.ConstantTimeCompare([]byte(password), []byte(secret)) != 1 {
+		writeAPIError(w, http.StatusUnauthorized, "missing or invalid basic auth password")
+		return
+	}
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 25<<20))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var push azdevPushEvent
+	if err := json.Unmarshal(payload, &push); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid service hook event: %v", err))
+		return
+	}
+	if push.EventType != "git.push" {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("unsupported event %q, only git.push events are scanned", push.EventType))
+		return
+	}
+
+	repository := push.Resource.Repository
+	var queued []*scan
+	for _, update := range push.Resource.RefUpdates {
+		// deleted branches and tags have no pull requests
+		if !strings.HasPrefix(update.Name, "refs/heads/") || update.NewObjectID == zeroSHA {
+			continue
+		}
+		req := scanRequest{RepoURL: repository.RemoteURL, CommitTo: update.NewObjectID}
+		if update.OldObjectID != zeroSHA {
+			req.CommitFrom = update.OldObjectID
+		} else {
+			// new branches are scanned as deep as the commits pushed with them
+			req.Depth = int64(len(push.Resource.Commits))
+			if req.Depth == 0 {
+				req.Depth = 1
+			}
+		}
+		target := &azdevStatusTarget{project: repository.Project.ID, repositoryID: repository.ID, ref: update.Name}
+		sc, code, err := s.enqueue(req, target)
+		if err != nil {
+			writeAPIError(w, code, err.Error())
+			return
+		}
+		queued = append(queued, sc)
+	}
+	if len(queued) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.writeScan(w, http.StatusAccepted, queued)
+}
+
+// setStatus sets the gitleaks/leaks status of the active pull requests of the branch of a
+// scan of a service hook. Statuses need --azdev-url and AZURE_DEVOPS_TOKEN, failures are
+// only logged.
+func (target *azdevStatusTarget) setStatus(s *scanServer, sc *scan) {
+	token := os.Getenv("AZURE_DEVOPS_TOKEN")
+	if s.sopts.AzdevURL == "" || token == "" {
+		log.Warnf("--azdev-url or AZURE_DEVOPS_TOKEN is not set, not setting the status of the pull requests of %s", target.ref)
+		return
+	}
+	ctx := context.Background()
+	client, err := git.NewClient(ctx, azuredevops.NewPatConnection(s.sopts.AzdevURL, token))
+	if err != nil {
+		log.Warnf("unable to connect to %s: %v", s.sopts.AzdevURL, err)
+		return
+	}
+	active := git.PullRequestStatusValues.Active
+	pullRequests, err := client.GetPullRequests(ctx, git.GetPullRequestsArgs{
+		RepositoryId: &target.repositoryID,
+		Project:      &target.project,
+		SearchCriteria: &git.GitPullRequestSearchCriteria{
+			SourceRefName: &target.ref,
+			Status:        &active,
+		},
+	})
+	if err != nil {
+		log.Warnf("unable to list the pull requests of %s: %v", target.ref, err)
+		return
+	}
+
+	state, description := azdevStatus(sc)
+	genre, name := "gitleaks", "leaks"
+	status := &git.GitPullRequestStatus{
+		Context:     &git.GitStatusContext{Genre: &genre, Name: &name},
+		State:       &state,
+		Description: &description,
+	}
+	if s.sopts.PublicURL != "" {
+		// GET /scan/{id} requires the bearer token, see --public-url
+		targetURL := strings.TrimSuffix(s.sopts.PublicURL, "/") + "/scan/" + sc.ID
+		status.TargetUrl = &targetURL
+	}
+	for _, pr := range *pullRequests {
+		if pr.PullRequestId == nil {
+			continue
+		}
+		_, err := client.CreatePullRequestStatus(ctx, git.CreatePullRequestStatusArgs{
+			Status:        status,
+			RepositoryId:  &target.repositoryID,
+			PullRequestId: pr.PullRequestId,
+			Project:       &target.project,
+		})
+		if err != nil {
+			log.Warnf("unable to set the status of pull request %d: %v", *pr.PullRequestId, err)
+		}
+	}
+}
+
+// azdevStatus returns the state and description of the pull request status of a scan,
+// those of its github commit status
+func azdevStatus(sc *scan) (git.GitStatusState, string) {
+	state, description := githubStatus(sc)
+	switch state {
+	case "pending":
+		return git.GitStatusStateValues.Pending, description
+	case "error":
+		return git.GitStatusStateValues.Error, description
+	case "failure":
+		return git.GitStatusStateValues.Failed, description
+	}
+	return git.GitStatusStateValues.Succeeded, description
+}
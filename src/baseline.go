@@ -0,0 +1,58 @@
+package gitleaks
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// baseline holds the fingerprints of the leaks of the --baseline report. Leaks found
+// again are not reported, so gitleaks can be adopted on repos with known leaks and
+// only fail on new ones.
+var baseline map[string]bool
+
+// baselineFingerprint identifies a leak of a baseline report. Unlike leakFingerprint
+// it ignores the rule and line so leaks stay known when rules are tuned.
+func baselineFingerprint(leak Leak) string {
+	h := sha256.New()
+	for _, field := range []string{leak.Commit, reportPath(leak.File), leak.Offender} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// loadBaseline reads the leaks of the json report at baselinePath
+func loadBaseline(baselinePath string) (map[string]bool, error) {
+	leaks, _, err := readReport(baselinePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load baseline: %v", err)
+	}
+	fingerprints := make(map[string]bool)
+	for _, leak := range leaks {
+		fingerprints[baselineFingerprint(leak)] = true
+	}
+	log.Debugf("loaded %d leaks from baseline %s", len(fingerprints), baselinePath)
+	return fingerprints, nil
+}
+
+// filterBaseline returns the leaks which are not in the baseline
+func filterBaseline(leaks []Leak) []Leak {
+	if baseline == nil {
+		return leaks
+	}
+	var newLeaks []Leak
+	for _, leak := range leaks {
+		if !baseline[baselineFingerprint(leak)] {
+			newLeaks = append(newLeaks, leak)
+		}
+	}
+	if known := len(leaks) - len(newLeaks); known != 0 {
+		log.Infof("%d leaks already in baseline %s", known, opts.Baseline)
+		mutex.Lock()
+		telemetry.known += int64(known)
+		mutex.Unlock()
+	}
+	return newLeaks
+}
@@ -0,0 +1,239 @@
+package gitleaks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+// BenchOptions are the options of gitleaks bench
+type BenchOptions struct {
+	Corpus       string  `long:"corpus" required:"true" description:"directory of fixture repos, bundles or repos, with the expected leaks of each in <name>.expected.json"`
+	ConfigPath   string  `long:"config" description:"path to the gitleaks config to evaluate, defaults to the default config"`
+	Report       string  `long:"report" description:"path to write the results to, as json"`
+	MinPrecision float64 `long:"min-precision" description:"fail if the precision of the corpus is below this, e.g. 0.95"`
+	MinRecall    float64 `long:"min-recall" description:"fail if the recall of the corpus is below this, e.g. 0.9"`
+	Log          string  `short:"l" long:"log" default:"warn" description:"log level"`
+}
+
+// benchFixture is a fixture repo of a corpus
+type benchFixture struct {
+	name string
+	// args select the fixture, --bundle or --repo-path
+	args []string
+	// expected are the leaks the fixture is known to contain
+	expected []Leak
+}
+
+// benchResult is the evaluation of a fixture, or of the whole corpus
+type benchResult struct {
+	Name           string  `json:"name"`
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	FalseNegatives int     `json:"falseNegatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	Commits        int64   `json:"commits"`
+	Bytes          int64   `json:"bytes"`
+	DurationMs     int64   `json:"durationMs"`
+	// BytesPerSecond is the throughput of the audit
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+	// Missed and Unexpected are the false negatives and false positives
+	Missed     []Leak `json:"missed,omitempty"`
+	Unexpected []Leak `json:"unexpected,omitempty"`
+}
+
+// Bench is the entry point for gitleaks bench. It audits every fixture of a corpus,
+// compares the leaks found with the expected ones, and reports precision, recall and
+// throughput per fixture and of the corpus, so changes of rules or of the engine are
+// measured rather than guessed.
+func Bench(args []string) error {
+	var bopts BenchOptions
+	parser := flags.NewParser(&bopts, flags.Default&^flags.PrintErrors)
+	parser.Usage = "bench [OPTIONS]"
+	if _, err := parser.ParseArgs(args); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	(&Options{Log: bopts.Log}).setLogs()
+
+	fixtures, err := benchFixtures(bopts.Corpus)
+	if err != nil {
+		return err
+	}
+	if len(fixtures) == 0 {
+		return fmt.Errorf("no fixture repos or bundles in %s", bopts.Corpus)
+	}
+	results, total, err := runBench(bopts, fixtures)
+	if err != nil {
+		return err
+	}
+	printBench(results, total)
+	if bopts.Report != "" {
+		b, err := json.MarshalIndent(struct {
+			Total    benchResult   `json:"total"`
+			Fixtures []benchResult `json:"fixtures"`
+		}{total, results}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(bopts.Report, b, 0644); err != nil {
+			return err
+		}
+	}
+	if total.Precision < bopts.MinPrecision || total.Recall < bopts.MinRecall {
+		return fmt.Errorf("precision %.3f and recall %.3f of the corpus are below --min-precision %.3f or --min-recall %.3f",
+			total.Precision, total.Recall, bopts.MinPrecision, bopts.MinRecall)
+	}
+	return nil
+}
+
+// benchFixtures returns the fixtures of a corpus: its bundles, e.g. gronit.bundle, and
+// its repos. The expected leaks of a fixture are the json report <name>.expected.json,
+// fixtures without one are expected to contain no leaks.
+func benchFixtures(corpus string) ([]benchFixture, error) {
+	files, err := ioutil.ReadDir(corpus)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []benchFixture
+	for _, f := range files {
+		p := filepath.Join(corpus, f.Name())
+		var fixture benchFixture
+		switch {
+		case !f.IsDir() && strings.HasSuffix(f.Name(), ".bundle"):
+			fixture = benchFixture{name: bundleName(p), args: []string{"--bundle=" + p}}
+		case f.IsDir() && containsGit(p):
+			fixture = benchFixture{name: strings.TrimSuffix(f.Name(), ".git"), args: []string{"--repo-path=" + p}}
+		default:
+			continue
+		}
+		expected, _, err := readReport(filepath.Join(corpus, fixture.name+".expected.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("unable to read the expected leaks of %s: %v", fixture.name, err)
+		}
+		fixture.expected = expected
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// runBench audits the fixtures one after another, audits share the state of the package
+func runBench(bopts BenchOptions, fixtures []benchFixture) ([]benchResult, benchResult, error) {
+	var (
+		results []benchResult
+		total   = benchResult{Name: "total"}
+	)
+	for _, fixture := range fixtures {
+		args := fixture.args
+		if bopts.ConfigPath != "" {
+			args = append(args, "--config="+bopts.ConfigPath)
+		}
+		var benchOpts Options
+		if _, err := flags.NewParser(&benchOpts, flags.None).ParseArgs(args); err != nil {
+			return nil, total, err
+		}
+		if err := benchOpts.guard(); err != nil {
+			return nil, total, err
+		}
+
+		log.Infof("benchmarking %s", fixture.name)
+		start := time.Now()
+		_, leaks, err := runScan(&benchOpts)
+		if err != nil {
+			return nil, total, fmt.Errorf("unable to audit fixture %s: %v", fixture.name, err)
+		}
+		result := compareLeaks(fixture.name, fixture.expected, leaks)
+		result.DurationMs = time.Since(start).Milliseconds()
+		mutex.Lock()
+		result.Commits, result.Bytes = telemetry.commits, telemetry.bytes
+		mutex.Unlock()
+		result.finish()
+		results = append(results, result)
+
+		total.TruePositives += result.TruePositives
+		total.FalsePositives += result.FalsePositives
+		total.FalseNegatives += result.FalseNegatives
+		total.Commits += result.Commits
+		total.Bytes += result.Bytes
+		total.DurationMs += result.DurationMs
+	}
+	total.finish()
+	return results, total, nil
+}
+
+// compareLeaks counts the leaks found which were expected, the true positives, those
+// not expected and the expected ones not found. Leaks are the same if their rule, file,
+// commit and offender are.
+func compareLeaks(name string, expected, found []Leak) benchResult {
+	key := func(leak Leak) string {
+		return strings.Join([]string{leak.Rule, leak.File, leak.Commit, leak.Offender}, "\x00")
+	}
+	remaining := make(map[string]int)
+	for _, leak := range expected {
+		remaining[key(leak)]++
+	}
+	result := benchResult{Name: name}
+	for _, leak := range found {
+		if k := key(leak); remaining[k] != 0 {
+			remaining[k]--
+			result.TruePositives++
+			continue
+		}
+		result.FalsePositives++
+		result.Unexpected = append(result.Unexpected, leak)
+	}
+	for _, leak := range expected {
+		if k := key(leak); remaining[k] != 0 {
+			remaining[k]--
+			result.FalseNegatives++
+			result.Missed = append(result.Missed, leak)
+		}
+	}
+	return result
+}
+
+// finish computes the ratios of a result. Fixtures without leaks found have a precision
+// of 1, those without leaks expected a recall of 1.
+func (r *benchResult) finish() {
+	r.Precision, r.Recall = 1, 1
+	if found := r.TruePositives + r.FalsePositives; found != 0 {
+		r.Precision = float64(r.TruePositives) / float64(found)
+	}
+	if expected := r.TruePositives + r.FalseNegatives; expected != 0 {
+		r.Recall = float64(r.TruePositives) / float64(expected)
+	}
+	if r.DurationMs != 0 {
+		r.BytesPerSecond = float64(r.Bytes) / (float64(r.DurationMs) / 1000)
+	}
+}
+
+// printBench prints the results as a table, followed by the leaks each fixture missed
+// or did not expect
+func printBench(results []benchResult, total benchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIXTURE\tTP\tFP\tFN\tPRECISION\tRECALL\tCOMMITS\tSIZE\tDURATION\tTHROUGHPUT")
+	for _, r := range append(results, total) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.3f\t%.3f\t%d\t%s\t%s\t%s/s\n", r.Name, r.TruePositives, r.FalsePositives, r.FalseNegatives,
+			r.Precision, r.Recall, r.Commits, formatSize(r.Bytes), time.Duration(r.DurationMs)*time.Millisecond, formatSize(int64(r.BytesPerSecond)))
+	}
+	w.Flush()
+	for _, r := range results {
+		for _, leak := range r.Missed {
+			fmt.Printf("%s: missed %s in %s of %s\n", r.Name, leak.Rule, leak.File, leak.Commit)
+		}
+		for _, leak := range r.Unexpected {
+			fmt.Printf("%s: unexpected %s in %s of %s: %s\n", r.Name, leak.Rule, leak.File, leak.Commit, leak.Offender)
+		}
+	}
+}
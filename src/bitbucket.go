@@ -0,0 +1,316 @@
+package gitleaks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	gitHttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// bitbucketCloudURL is the Bitbucket Cloud API. Set BITBUCKET_URL to the url of a
+// Bitbucket Server to audit a self hosted instance instead.
+var bitbucketCloudURL = "https://api.bitbucket.org/2.0/"
+
+// bitbucketPages number of records per request
+const bitbucketPages = 100
+
+// bitbucketRepo is a repo listed by either the Bitbucket Cloud or the Bitbucket Server API
+type bitbucketRepo struct {
+	name    string
+	slug    string
+	size    int64
+	fork    bool
+	httpURL string
+	sshURL  string
+}
+
+// bitbucketLinks are the clone links of Bitbucket Cloud and Bitbucket Server repos
+type bitbucketLinks struct {
+	Clone []struct {
+		Href string `json:"href"`
+		Name string `json:"name"`
+	} `json:"clone"`
+}
+
+// cloneURLs returns the http(s) and ssh clone urls
+func (links bitbucketLinks) cloneURLs() (string, string) {
+	var httpURL, sshURL string
+	for _, link := range links.Clone {
+		switch link.Name {
+		case "https", "http":
+			httpURL = link.Href
+		case "ssh":
+			sshURL = link.Href
+		}
+	}
+	return httpURL, sshURL
+}
+
+// auditBitbucketRepos kicks off audits if --bitbucket-user or --bitbucket-org options
+// are set. Repos are listed with the Bitbucket API, cloned and audited one at a time.
+// If an error occurs during an audit of a repo, that error is logged.
+func auditBitbucketRepos() (int, error) {
+	var (
+		tempDir string
+		err     error
+		leaks   []Leak
+		forks   = make(map[string]bool)
+	)
+	owner := opts.BitbucketOrg + opts.BitbucketUser
+	guard, err := newDiscoveryGuard(owner)
+	if err != nil {
+		return NoLeaks, err
+	}
+
+	enumerateTrace := startTrace("enumerate", "").set("owner", owner)
+	listed, err := listBitbucketRepos()
+	if err != nil {
+		return NoLeaks, err
+	}
+	var repos []bitbucketRepo
+	for _, p := range listed {
+		if !inShard(p.name) {
+			continue
+		}
+		if err = guard.add(p.size); err != nil {
+			return NoLeaks, err
+		}
+		repos = append(repos, p)
+	}
+	enumerateTrace.set("repos", strconv.Itoa(len(repos))).finish()
+	log.Debugf("found repositories: %s", guard)
+
+	if opts.Disk {
+		if tempDir, err = ownerCloneDir(owner); err != nil {
+			return NoLeaks, fmt.Errorf("error creating temp directory: %v", err)
+		}
+	}
+
+	for _, p := range repos {
+		if isInterrupted() {
+			break
+		}
+		repo, err := cloneBitbucketRepo(tempDir, p)
+		if err != nil {
+			skipRepo(err)
+			continue
+		}
+
+		err = repo.audit()
+		if err != nil {
+			skipRepo(err)
+			continue
+		}
+
+		if opts.Disk {
+			removeClone(fmt.Sprintf("%s/%s", tempDir, p.slug))
+		}
+
+		repo.report()
+		leaks = append(leaks, repo.leaks...)
+		if repo.fork {
+			forks[repo.name] = true
+		}
+	}
+
+	leaks = dedupForks(leaks, forks)
+	if opts.writesReport() {
+		err = writeReport(leaks)
+		if err != nil {
+			return NoLeaks, err
+		}
+	}
+
+	return failingLeaks(leaks), nil
+}
+
+// listBitbucketRepos lists the repos of --bitbucket-org or --bitbucket-user. On
+// Bitbucket Cloud both are workspaces. On Bitbucket Server --bitbucket-org is a
+// project key and --bitbucket-user a user slug.
+func listBitbucketRepos() ([]bitbucketRepo, error) {
+	if serverURL := os.Getenv("BITBUCKET_URL"); serverURL != "" {
+		return listBitbucketServerRepos(strings.TrimSuffix(serverURL, "/"))
+	}
+	return listBitbucketCloudRepos()
+}
+
+func listBitbucketCloudRepos() ([]bitbucketRepo, error) {
+	var repos []bitbucketRepo
+	workspace := opts.BitbucketOrg + opts.BitbucketUser
+	next := fmt.Sprintf("%srepositories/%s?pagelen=%d", bitbucketCloudURL, url.PathEscape(workspace), bitbucketPages)
+	for next != "" {
+		var page struct {
+			Next   string `json:"next"`
+			Values []struct {
+				Name   string          `json:"name"`
+				Slug   string          `json:"slug"`
+				Size   int64           `json:"size"`
+				Parent json.RawMessage `json:"parent"`
+				Links  bitbucketLinks  `json:"links"`
+			} `json:"values"`
+		}
+		if err := bitbucketGet(next, &page); err != nil {
+			return nil, err
+		}
+		for _, v := range page.Values {
+			httpURL, sshURL := v.Links.cloneURLs()
+			repos = append(repos, bitbucketRepo{
+				name:    v.Name,
+				slug:    v.Slug,
+				size:    v.Size,
+				fork:    len(v.Parent) != 0 && string(v.Parent) != "null",
+				httpURL: httpURL,
+				sshURL:  sshURL,
+			})
+		}
+		next = page.Next
+	}
+	return repos, nil
+}
+
+func listBitbucketServerRepos(serverURL string) ([]bitbucketRepo, error) {
+	var repos []bitbucketRepo
+	reposURL := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos", serverURL, url.PathEscape(opts.BitbucketOrg))
+	if opts.BitbucketUser != "" {
+		reposURL = fmt.Sprintf("%s/rest/api/1.0/users/%s/repos", serverURL, url.PathEscape(opts.BitbucketUser))
+	}
+	start := 0
+	for {
+		var page struct {
+			IsLastPage    bool `json:"isLastPage"`
+			NextPageStart int  `json:"nextPageStart"`
+			Values        []struct {
+				Name   string          `json:"name"`
+				Slug   string          `json:"slug"`
+				Origin json.RawMessage `json:"origin"`
+				Links  bitbucketLinks  `json:"links"`
+			} `json:"values"`
+		}
+		if err := bitbucketGet(fmt.Sprintf("%s?limit=%d&start=%d", reposURL, bitbucketPages, start), &page); err != nil {
+			return nil, err
+		}
+		for _, v := range page.Values {
+			httpURL, sshURL := v.Links.cloneURLs()
+			repos = append(repos, bitbucketRepo{
+				name:    v.Name,
+				slug:    v.Slug,
+				fork:    len(v.Origin) != 0 && string(v.Origin) != "null",
+				httpURL: httpURL,
+				sshURL:  sshURL,
+			})
+		}
+		if page.IsLastPage || len(page.Values) == 0 {
+			break
+		}
+		start = page.NextPageStart
+	}
+	return repos, nil
+}
+
+// bitbucketGet fetches a page of the Bitbucket API and decodes it into v. Requests are
+// authenticated with BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD, or with an OAuth
+// or HTTP access token in BITBUCKET_TOKEN.
+func bitbucketGet(apiURL string, v interface{}) error {
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return err
+	}
+	if token := os.Getenv("BITBUCKET_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if user := os.Getenv("BITBUCKET_USERNAME"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("BITBUCKET_APP_PASSWORD"))
+	}
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second, Transport: newAPITransport(nil)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error listing bitbucket repos: %v", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return fmt.Errorf("error listing bitbucket repos: %w", ErrInvalidAuth)
+	case http.StatusNotFound:
+		return fmt.Errorf("error listing bitbucket repos: %w", ErrRepoNotFound)
+	default:
+		return fmt.Errorf("error listing bitbucket repos: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// bitbucketAuth returns the credentials used to clone over http(s), if any
+func bitbucketAuth() *gitHttp.BasicAuth {
+	if token := os.Getenv("BITBUCKET_TOKEN"); token != "" {
+		username := os.Getenv("BITBUCKET_USERNAME")
+		if username == "" {
+			// bitbucket cloud accepts oauth tokens as the password of this user
+			username = "x-token-auth"
+		}
+		return &gitHttp.BasicAuth{
+			Username: username,
+			Password: token,
+		}
+	}
+	if username := os.Getenv("BITBUCKET_USERNAME"); username != "" {
+		return &gitHttp.BasicAuth{
+			Username: username,
+			Password: os.Getenv("BITBUCKET_APP_PASSWORD"),
+		}
+	}
+	return nil
+}
+
+func cloneBitbucketRepo(tempDir string, p bitbucketRepo) (*Repo, error) {
+	var (
+		repo *git.Repository
+		err  error
+	)
+
+	if opts.ExcludeForks && p.fork {
+		return nil, fmt.Errorf("skipping %s, %w", p.name, ErrExcludedFork)
+	}
+
+	if re := whitelistedRepo(p.name, p.httpURL, p.sshURL); re != nil {
+		return nil, fmt.Errorf("skipping %s, %w%s", p.name, ErrWhitelisted, re.describe())
+	}
+
+	opt := &git.CloneOptions{
+		URL: p.httpURL,
+	}
+	if auth := bitbucketAuth(); auth != nil {
+		opt.Auth = auth
+	} else if sshAuth := config.sshAuthFor(p.sshURL); sshAuth != nil && p.sshURL != "" {
+		opt.URL = p.sshURL
+		opt.Auth = sshAuth
+	}
+
+	log.Infof("cloning: %s", p.name)
+	cloneTrace := startTrace("clone", "").set("repo", p.name)
+	defer cloneTrace.finish()
+
+	if opts.Disk {
+		repo, err = plainClone(fmt.Sprintf("%s/%s", tempDir, p.slug), opt)
+	} else {
+		repo, err = memoryClone(opt)
+	}
+
+	if err != nil {
+		return nil, cloneError(err)
+	}
+
+	return &Repo{
+		repository: repo,
+		name:       p.name,
+		fork:       p.fork,
+	}, nil
+}
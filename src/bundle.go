@@ -0,0 +1,125 @@
+package gitleaks
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// bundleName names the repo of a bundle by its file name, without the .bundle extension
+func bundleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".bundle")
+}
+
+// openBundle reads the refs and the packfile of a git bundle, e.g. of
+// git bundle create repo.bundle --all, into a repo in memory. Bundles ship the history of
+// a repo to air-gapped hosts, where it is audited without access to its origin.
+func openBundle(path string) (*git.Repository, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readBundle(path, f)
+}
+
+// readBundle reads a bundle of version 2 or 3. Bundles with prerequisites, created from
+// a range of commits, are refused: their packfiles are thin, the objects of the commits
+// before the range are missing.
+func readBundle(path string, r io.Reader) (*git.Repository, error) {
+	br := bufio.NewReader(r)
+	signature, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a git bundle: %v", path, err)
+	}
+	signature = strings.TrimSuffix(signature, "\n")
+	if signature != "# v2 git bundle" && signature != "# v3 git bundle" {
+		return nil, fmt.Errorf("%s is not a git bundle of version 2 or 3", path)
+	}
+
+	var (
+		refs          []*plumbing.Reference
+		head          *plumbing.Reference
+		prerequisites int
+	)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("invalid header of bundle %s: %v", path, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "@"):
+			// capabilities of v3 bundles, filtered bundles lack objects of their commits
+			if capability := strings.TrimPrefix(line, "@"); capability != "object-format=sha1" {
+				return nil, fmt.Errorf("unsupported capability %s of bundle %s", capability, path)
+			}
+		case strings.HasPrefix(line, "-"):
+			prerequisites++
+		default:
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 || !validHash(fields[0]) {
+				return nil, fmt.Errorf("invalid ref %q of bundle %s", line, path)
+			}
+			ref := plumbing.NewHashReference(plumbing.ReferenceName(fields[1]), plumbing.NewHash(fields[0]))
+			if ref.Name() == plumbing.HEAD {
+				head = ref
+				continue
+			}
+			refs = append(refs, ref)
+		}
+	}
+	if prerequisites != 0 {
+		return nil, fmt.Errorf("bundle %s needs %d prerequisite commits, which it does not contain. Bundle the complete history, e.g. with git bundle create %s --all", path, prerequisites, filepath.Base(path))
+	}
+	if len(refs) == 0 && head == nil {
+		return nil, fmt.Errorf("bundle %s contains no refs", path)
+	}
+
+	storage := memory.NewStorage()
+	if err := packfile.UpdateObjectStorage(storage, br); err != nil {
+		return nil, fmt.Errorf("unable to read the packfile of bundle %s: %v", path, err)
+	}
+	for _, ref := range refs {
+		if err := storage.SetReference(ref); err != nil {
+			return nil, err
+		}
+	}
+	if err := storage.SetReference(bundleHead(head, refs)); err != nil {
+		return nil, err
+	}
+	return git.Open(storage, nil)
+}
+
+// validHash returns true if s is the hex hash of an object
+func validHash(s string) bool {
+	_, err := hex.DecodeString(s)
+	return len(s) == 40 && err == nil
+}
+
+// bundleHead returns HEAD of a bundle. Bundles record HEAD as a commit, it points to
+// the first branch at that commit, like the HEAD of a clone of the bundle. Bundles
+// without HEAD point it to their first branch.
+func bundleHead(head *plumbing.Reference, refs []*plumbing.Reference) *plumbing.Reference {
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && (head == nil || ref.Hash() == head.Hash()) {
+			return plumbing.NewSymbolicReference(plumbing.HEAD, ref.Name())
+		}
+	}
+	if head != nil {
+		return head
+	}
+	return plumbing.NewHashReference(plumbing.HEAD, refs[0].Hash())
+}
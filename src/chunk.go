@@ -0,0 +1,101 @@
+package gitleaks
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// blobWindowSize is the size of the windows files are read and matched in, so the
+// memory of huge files, like committed sql dumps or logs, stays bounded. Lines longer
+// than a window are split, the next window repeating the last blobWindowOverlap bytes
+// so secrets spanning the split are matched.
+var (
+	blobWindowSize    = 8 << 20
+	blobWindowOverlap = 4 << 10
+)
+
+// inspectReader inspects the content of commit, a file of size bytes, read from r in
+// windows of blobWindowSize. Windows end after their last newline, so leaks keep their
+// line numbers. Leaks in lines split across windows are located by their column in the
+// window.
+func (repo *Repo) inspectReader(r io.Reader, size int64, commit *Commit) error {
+	if skipLargeFile(commit, size) {
+		return nil
+	}
+	bufSize := blobWindowSize
+	if size >= 0 && size < int64(bufSize) {
+		// one byte more than the file detects its end in a single read
+		bufSize = int(size) + 1
+	}
+	var (
+		buf     = make([]byte, 0, bufSize)
+		line    = commit.startLine
+		overlap = 0
+		eof     = false
+	)
+	for !eof {
+		n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			eof = true
+		} else if err != nil {
+			return err
+		}
+		if eof && len(buf) == overlap {
+			// nothing but the overlap of the previous window is left
+			break
+		}
+
+		window, rest, nextOverlap := buf, []byte(nil), 0
+		if !eof {
+			if i := bytes.LastIndexByte(buf, '\n'); i != -1 {
+				window, rest = buf[:i+1], buf[i+1:]
+			} else {
+				// a line longer than a window
+				nextOverlap = blobWindowOverlap
+				if nextOverlap > len(buf)/2 {
+					nextOverlap = len(buf) / 2
+				}
+				rest = buf[len(buf)-nextOverlap:]
+			}
+		}
+
+		windowCommit := *commit
+		windowCommit.content = string(window)
+		windowCommit.startLine = line
+		windowCommit.overlap = overlap
+		repo.inspect(&windowCommit)
+		if line != 0 {
+			line += strings.Count(windowCommit.content, "\n")
+		}
+
+		overlap = nextOverlap
+		buf = buf[:copy(buf, rest)]
+	}
+	return nil
+}
+
+// inOverlap returns true if offender lies within the first overlap bytes of line, the
+// part of a line split across windows which the previous window matched already
+func inOverlap(line, offender string, overlap int) bool {
+	i := strings.Index(line, offender)
+	return overlap != 0 && i != -1 && i+len(offender) <= overlap
+}
+
+// skipLargeFile returns true if the file of commit, of size bytes, is larger than
+// --max-file-size, like lockfiles or vendored bundles. Files of unknown size, -1, are
+// never skipped.
+func skipLargeFile(commit *Commit, size int64) bool {
+	if opts.MaxFileSize == "" {
+		return false
+	}
+	maxSize, _ := parseSize(opts.MaxFileSize)
+	if size <= maxSize {
+		return false
+	}
+	log.Debugf("skipping %s of %s, %s is above --max-file-size", commit.filePath, commit.sha, formatSize(size))
+	return true
+}
@@ -0,0 +1,115 @@
+package gitleaks
+
+import (
+	"regexp"
+	"strings"
+)
+
+// codeownersPaths are the locations of CODEOWNERS files, in the order GitHub reads them
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeownersRule is a line of a CODEOWNERS file, a pattern and the owners of the files
+// it matches
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// codeowners are the rules of a CODEOWNERS file. The last rule matching a file wins.
+type codeowners []codeownersRule
+
+// parseCodeowners parses the rules of a CODEOWNERS file. Rules without owners unset the
+// owners of the files they match.
+func parseCodeowners(content string) codeowners {
+	var rules codeowners
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(codeownersRegex(fields[0]))
+		if err != nil {
+			continue
+		}
+		rules = append(rules, codeownersRule{pattern: re, owners: fields[1:]})
+	}
+	return rules
+}
+
+// codeownersRegex translates a gitignore style pattern of a CODEOWNERS file to a regex
+// matching the paths of the files it owns
+func codeownersRegex(pattern string) string {
+	// patterns with a slash before their end are relative to the root of the repo
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	dir := strings.HasSuffix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+
+	var re strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			re.WriteString("[^/]*")
+		case pattern[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	prefix := "^(.*/)?"
+	if anchored {
+		prefix = "^"
+	}
+	// directories own everything below them, other patterns files or directories
+	suffix := "(/.*)?$"
+	if dir {
+		suffix = "/.*$"
+	}
+	return prefix + re.String() + suffix
+}
+
+// owners returns the owners of file, those of the last rule matching it
+func (c codeowners) owners(file string) []string {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].pattern.MatchString(file) {
+			return c[i].owners
+		}
+	}
+	return nil
+}
+
+// repoCodeowners returns the rules of the CODEOWNERS file of HEAD of repo, or nil if it
+// has none
+func repoCodeowners(repo *Repo) codeowners {
+	if repo == nil || repo.repository == nil {
+		return nil
+	}
+	head, err := repo.repository.Head()
+	if err != nil {
+		return nil
+	}
+	c, err := repo.repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil
+	}
+	for _, p := range codeownersPaths {
+		f, err := c.File(p)
+		if err != nil {
+			continue
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return nil
+		}
+		return parseCodeowners(content)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package gitleaks
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// parseCommitRange splits a --commits range of the form A..B into the commit to start
+// after and the commit to end at. Either side may be empty, like in git.
+func parseCommitRange(spec string) (string, string, error) {
+	if strings.Contains(spec, "...") {
+		return "", "", fmt.Errorf("invalid commit range %s, symmetric differences (A...B) are not supported", spec)
+	}
+	parts := strings.Split(spec, "..")
+	if len(parts) != 2 || (parts[0] == "" && parts[1] == "") {
+		return "", "", fmt.Errorf("invalid commit range %s, expected A..B", spec)
+	}
+	return parts[0], parts[1], nil
+}
+
+// commitRange resolves --commit-from and --commit-to. It returns the commit to walk
+// from and the commits reachable from --commit-from, which are skipped so only the
+// commits of a range like a pull request are audited. --commit-to defaults to HEAD.
+func (repo *Repo) commitRange() (plumbing.Hash, map[plumbing.Hash]bool, error) {
+	to := "HEAD"
+	if opts.CommitTo != "" {
+		to = opts.CommitTo
+	}
+	toHash, err := repo.repository.ResolveRevision(plumbing.Revision(to))
+	if err != nil {
+		return plumbing.ZeroHash, nil, fmt.Errorf("unable to resolve --commit-to %s: %v", to, err)
+	}
+
+	excluded := make(map[plumbing.Hash]bool)
+	if opts.CommitFrom == "" {
+		return *toHash, excluded, nil
+	}
+	fromHash, err := repo.repository.ResolveRevision(plumbing.Revision(opts.CommitFrom))
+	if err != nil {
+		return plumbing.ZeroHash, nil, fmt.Errorf("unable to resolve --commit-from %s: %v", opts.CommitFrom, err)
+	}
+	cIter, err := repo.repository.Log(&git.LogOptions{From: *fromHash})
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+	err = cIter.ForEach(func(c *object.Commit) error {
+		excluded[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+	return *toHash, excluded, nil
+}
@@ -1,37 +1,38 @@
 package gitleaks
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"os/user"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	log "github.com/sirupsen/logrus"
+	"github.com/zricethezav/gitleaks/src/detect"
+	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
 )
 
-type entropyRange struct {
-	v1 float64
-	v2 float64
-}
-
 // Rule instructs how gitleaks should audit each line of code
-type Rule struct {
-	description string
-	regex       *regexp.Regexp
-	severity    string
-	tags        []string
-	entropies   []*entropyRange
-	entropyROI  string
-	fileTypes   []*regexp.Regexp
-}
+type Rule = detect.Rule
 
 // TomlConfig is used for loading gitleaks configs from a toml file
 type TomlConfig struct {
+	// CaseInsensitive and WordBoundary are the defaults of the options of the same
+	// name of every rule
+	CaseInsensitive bool
+	WordBoundary    bool
+
 	Rules []struct {
+		// ID defaults to the description in lower case with dashes, e.g. aws-client-id
+		ID          string
 		Description string
 		Regex       string
 		Entropies   []string
@@ -39,26 +40,186 @@ type TomlConfig struct {
 		Severity    string
 		EntropyROI  string
 		FileTypes   []string
+		// Paths are gitignore style patterns of file paths, e.g. id_rsa or *.pem. Rules
+		// with paths but without regex report matching files whatever their content.
+		Paths       []string
+		Entropy     float64
+		SecretGroup int
+		Keywords    []string
+		// Verifier checks whether secrets of the rule are live with --verify, aws, github
+		// or slack. Rules of the default config have the verifier of their id.
+		Verifier string
+
+		// CaseInsensitive compiles the regex with (?i), WordBoundary with \b around it.
+		// Unset, they default to the options of the same name of the config.
+		CaseInsensitive *bool
+		WordBoundary    *bool
+		// Allowlist whitelists matches of this rule only, e.g.
+		// [rules.allowlist]
+		// paths = ["(.*?)_test.go$"]
+		Allowlist struct {
+			Regexes []interface{}
+			Paths   []interface{}
+			Commits []interface{}
+		}
 	}
+	// Whitelist items are either plain strings or tables carrying the item plus
+	// optional reason and approvedBy fields, e.g.
+	// files = [{file = "(.*?)_test.go$", reason = "fixtures", approvedBy = "alice"}]
 	Whitelist struct {
-		Files   []string
-		Regexes []string
-		Commits []string
-		Repos   []string
+		Files    []interface{}
+		Regexes  []interface{}
+		Commits  []interface{}
+		Repos    []interface{}
+		Authors  []interface{}
+		Messages []interface{}
+		// Fingerprints are "commit:file:rule" of single leaks, e.g. written by
+		// gitleaks suppress
+		Fingerprints []interface{}
+	}
+	// Version is the version of the rules of the config, reported with their leaks
+	Version string
+	// Links are url templates of commits and files in reports, for hosts whose web urls
+	// can not be derived from their clone urls
+	Links []struct {
+		Host   string
+		Commit string
+		File   string
+	}
+	// Auth selects the ssh key of each host, matched by regex. Hosts without an entry use
+	// --ssh-key, e.g.
+	// [[auth.ssh]]
+	// host = 'gitlab\.example\.com'
+	// key = "~/.ssh/gitlab"
+	// passphrase = "${GITLAB_KEY_PASSPHRASE}"
+	Auth struct {
+		SSH []struct {
+			Host       string
+			Key        string
+			Passphrase string
+		}
+	}
+	// Notify configures where leaks are sent after each repo is audited, e.g.
+	// [notify.webhook]
+	// url = "https://soar.example.com/hooks/gitleaks"
+	// headers = {Authorization = "Bearer ${SOAR_TOKEN}"}
+	// [notify.slack]
+	// url = "${SLACK_WEBHOOK_URL}"
+	Notify struct {
+		Webhook struct {
+			URL     string
+			Headers map[string]string
+			Secret  string
+			Retries *int
+			Backoff string
+		}
+		Slack struct {
+			// URL is the incoming webhook of the slack app
+			URL       string
+			Channel   string
+			ReportURL string
+			Retries   *int
+			Backoff   string
+		}
+		AzureBoards struct {
+			// Organization is the url of the organization, e.g. https://dev.azure.com/org
+			Organization     string
+			Project          string
+			Type             string
+			AreaPath         string
+			Tags             []string
+			FingerprintField string
+		}
+		// DedupeWindow is how long leaks still present are not notified again, State
+		// the file remembering the notified leaks between runs
+		DedupeWindow string
+		State        string
+	}
+	// Report configures the content of reports, e.g. fields added to every leak for
+	// routing by downstream systems
+	// [report.extraFields]
+	// team = "payments"
+	// pipeline = "${CI_PIPELINE_ID}"
+	Report struct {
+		ExtraFields map[string]string
+	}
+}
+
+// whitelistEntry is a single whitelist item. Reason and approvedBy are optional and
+// document why the item is whitelisted so suppressions can be reviewed. Entries past
+// their optional expiry date are dropped, so suppressions get revisited.
+type whitelistEntry struct {
+	*regexp.Regexp
+	value      string
+	reason     string
+	approvedBy string
+	expires    time.Time
+}
+
+// expiresLayout is the format of the expiry dates of whitelist entries
+const expiresLayout = "2006-01-02"
+
+// expired returns true once the expiry date of the entry, if any, has passed
+func (e *whitelistEntry) expired() bool {
+	return !e.expires.IsZero() && !time.Now().Before(e.expires.AddDate(0, 0, 1))
+}
+
+// describe returns the reason and reviewer of a whitelist entry for logging
+func (e *whitelistEntry) describe() string {
+	switch {
+	case e.reason != "" && e.approvedBy != "":
+		return fmt.Sprintf(", reason: %s, approved by: %s", e.reason, e.approvedBy)
+	case e.reason != "":
+		return fmt.Sprintf(", reason: %s", e.reason)
+	case e.approvedBy != "":
+		return fmt.Sprintf(", approved by: %s", e.approvedBy)
 	}
+	return ""
+}
+
+// suppression identifies a whitelist entry of kind (file, regex) in suppressed matches
+func (e *whitelistEntry) suppression(kind string) string {
+	return fmt.Sprintf("whitelist %s '%s'%s", kind, e.value, e.describe())
 }
 
 // Config contains gitleaks config
 type Config struct {
 	Rules     []*Rule
 	WhiteList struct {
-		regexes []*regexp.Regexp
-		files   []*regexp.Regexp
-		commits map[string]bool
-		repos   []*regexp.Regexp
+		regexes []*whitelistEntry
+		files   []*whitelistEntry
+		commits map[string]*whitelistEntry
+		// fingerprints are keyed by ignoreFingerprint
+		fingerprints map[string]*whitelistEntry
+		repos        []*whitelistEntry
+		authors      []*whitelistEntry
+		messages     []*whitelistEntry
 	}
+	// FileRules are the rules matching files by their filetypes or paths alone
 	FileRules []*Rule
-	sshAuth   *ssh.PublicKeys
+	// pathGlobs are the patterns of the paths of rules, by the regex they compile to
+	pathGlobs map[*regexp.Regexp]string
+	// ruleCommits are the commits whitelisted by the allowlists of rules
+	ruleCommits map[*Rule]map[string]*whitelistEntry
+	links       []*linkTemplate
+	webhook     webhookConfig
+	slack       slackConfig
+	workItems   workItemsConfig
+	sshAuth     *ssh.PublicKeys
+	// notifyDedupe is the dedupe window of the webhook and slack notifications
+	notifyDedupe notifyDedupeConfig
+	// sshKeys are the keys of [[auth.ssh]], tried before sshAuth
+	sshKeys []*sshHostKey
+	// detector matches content against Rules and the regex and file whitelists
+	detector detect.Detector
+	// digest is the hex sha256 of the config file, or of the default config
+	digest string
+	// ruleVerifiers are the names of the verifiers of rules with --verify, see verifiers
+	ruleVerifiers map[*Rule]string
+	// ruleProvenance is where each rule is defined
+	ruleProvenance map[*Rule]ruleProvenance
+	// extraFields are the fields of [report.extraFields], added to every leak
+	extraFields map[string]string
 }
 
 // loadToml loads of the toml config containing regexes and whitelists.
@@ -71,6 +232,7 @@ func newConfig() (*Config, error) {
 		tomlConfig TomlConfig
 		configPath string
 		config     Config
+		source     = ruleSourceDefault
 	)
 
 	if opts.ConfigPath != "" {
@@ -84,52 +246,194 @@ func newConfig() (*Config, error) {
 	}
 
 	if configPath != "" {
-		if _, err := toml.DecodeFile(configPath, &tomlConfig); err != nil {
+		b, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("problem loading config: %v", err)
+		}
+		if _, err := toml.Decode(string(b), &tomlConfig); err != nil {
 			return nil, fmt.Errorf("problem loading config: %v", err)
 		}
+		config.digest = fmt.Sprintf("%x", sha256.Sum256(b))
+		source = ruleSourceConfig
 	} else {
 		_, err := toml.Decode(defaultConfig, &tomlConfig)
 		if err != nil {
 			return nil, fmt.Errorf("problem loading default config: %v", err)
 		}
+		config.digest = fmt.Sprintf("%x", sha256.Sum256([]byte(defaultConfig)))
 	}
 
-	sshAuth, err := getSSHAuth()
+	// keys are only read from the config of the run, never from the audited repo
+	sshKeys, err := loadSSHHostKeys(tomlConfig)
 	if err != nil {
 		return nil, err
 	}
+	config.sshKeys = sshKeys
+	sshAuth, err := getSSHAuth()
+	// the default key is not needed if --repo has a key of its own
+	if err != nil && config.sshAuthFor(opts.Repo) == nil {
+		return nil, err
+	}
 	config.sshAuth = sshAuth
 
 	err = config.update(tomlConfig)
 	if err != nil {
 		return nil, err
 	}
+	config.stampRules(ruleProvenance{source: source, version: tomlConfig.Version, digest: config.digest})
+	// notifications are only read from the config of the run, never from the audited repo
+	if config.webhook, err = newWebhookConfig(tomlConfig); err != nil {
+		return nil, err
+	}
+	if config.slack, err = newSlackConfig(tomlConfig); err != nil {
+		return nil, err
+	}
+	if config.workItems, err = newWorkItemsConfig(tomlConfig); err != nil {
+		return nil, err
+	}
+	if config.notifyDedupe, err = newNotifyDedupeConfig(tomlConfig); err != nil {
+		return nil, err
+	}
+	// extra fields are only read from the config of the run, never from the audited repo
+	if config.extraFields, err = newExtraFields(tomlConfig); err != nil {
+		return nil, err
+	}
 	return &config, err
 }
 
+// ruleRegex returns regex matching case insensitively and only whole words, if set.
+// Word boundaries only match next to word characters, so regexes starting or ending
+// with punctuation, like -----BEGIN, should not set wordBoundary. Entropy-only rules
+// keep their empty regex, which is how they are told apart from regex rules.
+func ruleRegex(regex string, caseInsensitive, wordBoundary bool) string {
+	if regex == "" {
+		return regex
+	}
+	if wordBoundary {
+		// the group keeps alternations and flags of regex inside the boundaries
+		regex = `\b(?:` + regex + `)\b`
+	}
+	if caseInsensitive {
+		regex = "(?i)" + regex
+	}
+	return regex
+}
+
 // updateConfig will update a the global config values
 func (config *Config) update(tomlConfig TomlConfig) error {
 	for _, rule := range tomlConfig.Rules {
-		re := regexp.MustCompile(rule.Regex)
+		caseInsensitive, wordBoundary := tomlConfig.CaseInsensitive, tomlConfig.WordBoundary
+		if rule.CaseInsensitive != nil {
+			caseInsensitive = *rule.CaseInsensitive
+		}
+		if rule.WordBoundary != nil {
+			wordBoundary = *rule.WordBoundary
+		}
+		re := regexp.MustCompile(ruleRegex(rule.Regex, caseInsensitive, wordBoundary))
 		ranges, err := getEntropyRanges(rule.Entropies)
 		var fileTypes = []*regexp.Regexp{}
 		for _, regex := range rule.FileTypes {
 			fileTypes = append(fileTypes, regexp.MustCompile(regex))
 		}
+		for _, glob := range rule.Paths {
+			pathRe, err := regexp.Compile(codeownersRegex(glob))
+			if err != nil {
+				return fmt.Errorf("invalid path %s of %s: %v", glob, rule.Description, err)
+			}
+			if config.pathGlobs == nil {
+				config.pathGlobs = make(map[*regexp.Regexp]string)
+			}
+			config.pathGlobs[pathRe] = glob
+			fileTypes = append(fileTypes, pathRe)
+		}
 
 		if err != nil {
 			log.Errorf("could not create entropy range for %s, skipping rule", rule.Description)
+			degrade()
+			continue
+		}
+		if rule.Entropy < 0.0 || rule.Entropy > 8.0 {
+			log.Errorf("entropy of %s must be within 0.0-8.0, skipping rule", rule.Description)
+			degrade()
+			continue
+		}
+		if rule.SecretGroup < 0 || rule.SecretGroup > re.NumSubexp() {
+			log.Errorf("regex of %s has no group %d, skipping rule", rule.Description, rule.SecretGroup)
+			degrade()
+			continue
+		}
+		if rule.Severity != "" {
+			if _, err := parseSeverity(rule.Severity); err != nil {
+				log.Errorf("%v for %s, skipping rule", err, rule.Description)
+				degrade()
+				continue
+			}
+		}
+		if rule.Verifier != "" && verifiers[rule.Verifier] == nil {
+			log.Errorf("unknown verifier %s of %s, must be aws, github or slack, skipping rule", rule.Verifier, rule.Description)
+			degrade()
 			continue
 		}
 
+		var keywords []string
+		for _, keyword := range rule.Keywords {
+			keywords = append(keywords, strings.ToLower(keyword))
+		}
+		allowedRegexes, err := getWhitelistEntries("regex", rule.Allowlist.Regexes)
+		if err != nil {
+			return fmt.Errorf("allowlist of %s: %v", rule.Description, err)
+		}
+		allowedPaths, err := getWhitelistEntries("path", rule.Allowlist.Paths)
+		if err != nil {
+			return fmt.Errorf("allowlist of %s: %v", rule.Description, err)
+		}
+		allowedCommits, err := getWhitelistEntries("commit", rule.Allowlist.Commits)
+		if err != nil {
+			return fmt.Errorf("allowlist of %s: %v", rule.Description, err)
+		}
+
+		id := rule.ID
+		if id == "" {
+			id = ruleID(rule.Description)
+		}
 		r := &Rule{
-			description: rule.Description,
-			regex:       re,
-			severity:    rule.Severity,
-			tags:        rule.Tags,
-			entropies:   ranges,
-			entropyROI:  rule.EntropyROI,
-			fileTypes:   fileTypes,
+			ID:          id,
+			Description: rule.Description,
+			Regex:       re,
+			Severity:    rule.Severity,
+			Tags:        rule.Tags,
+			Entropies:   ranges,
+			EntropyROI:  rule.EntropyROI,
+			FileTypes:   fileTypes,
+			Entropy:     rule.Entropy,
+			SecretGroup: rule.SecretGroup,
+			Keywords:    keywords,
+		}
+		for _, re := range allowedRegexes {
+			r.Allowlist.Lines = append(r.Allowlist.Lines, re)
+		}
+		for _, re := range allowedPaths {
+			r.Allowlist.Files = append(r.Allowlist.Files, re)
+		}
+		if len(allowedCommits) != 0 {
+			if config.ruleCommits == nil {
+				config.ruleCommits = make(map[*Rule]map[string]*whitelistEntry)
+			}
+			config.ruleCommits[r] = make(map[string]*whitelistEntry)
+			for _, commit := range allowedCommits {
+				config.ruleCommits[r][commit.value] = commit
+			}
+		}
+
+		verifier := rule.Verifier
+		if verifier == "" {
+			verifier = defaultVerifiers[id]
+		}
+		if verifier != "" {
+			if config.ruleVerifiers == nil {
+				config.ruleVerifiers = make(map[*Rule]string)
+			}
+			config.ruleVerifiers[r] = verifier
 		}
 
 		if len(rule.Entropies) == 0 && rule.Regex == "" && len(fileTypes) != 0 {
@@ -140,26 +444,123 @@ func (config *Config) update(tomlConfig TomlConfig) error {
 	}
 
 	// set whitelists
-	config.WhiteList.commits = make(map[string]bool)
-	for _, commit := range tomlConfig.Whitelist.Commits {
-		config.WhiteList.commits[commit] = true
+	if config.WhiteList.commits == nil {
+		config.WhiteList.commits = make(map[string]*whitelistEntry)
+	}
+	commits, err := getWhitelistEntries("commit", tomlConfig.Whitelist.Commits)
+	if err != nil {
+		return err
+	}
+	for _, commit := range commits {
+		config.WhiteList.commits[commit.value] = commit
+	}
+	if config.WhiteList.fingerprints == nil {
+		config.WhiteList.fingerprints = make(map[string]*whitelistEntry)
+	}
+	fingerprints, err := getWhitelistEntries("fingerprint", tomlConfig.Whitelist.Fingerprints)
+	if err != nil {
+		return err
 	}
-	for _, regex := range tomlConfig.Whitelist.Files {
-		config.WhiteList.files = append(config.WhiteList.files, regexp.MustCompile(regex))
+	for _, fingerprint := range fingerprints {
+		config.WhiteList.fingerprints[fingerprint.value] = fingerprint
 	}
-	for _, regex := range tomlConfig.Whitelist.Regexes {
-		config.WhiteList.regexes = append(config.WhiteList.regexes, regexp.MustCompile(regex))
+	files, err := getWhitelistEntries("file", tomlConfig.Whitelist.Files)
+	if err != nil {
+		return err
+	}
+	config.WhiteList.files = append(config.WhiteList.files, files...)
+	regexes, err := getWhitelistEntries("regex", tomlConfig.Whitelist.Regexes)
+	if err != nil {
+		return err
+	}
+	config.WhiteList.regexes = append(config.WhiteList.regexes, regexes...)
+	repos, err := getWhitelistEntries("repo", tomlConfig.Whitelist.Repos)
+	if err != nil {
+		return err
 	}
-	for _, regex := range tomlConfig.Whitelist.Repos {
-		config.WhiteList.repos = append(config.WhiteList.repos, regexp.MustCompile(regex))
+	config.WhiteList.repos = append(config.WhiteList.repos, repos...)
+	authors, err := getWhitelistEntries("author", tomlConfig.Whitelist.Authors)
+	if err != nil {
+		return err
+	}
+	config.WhiteList.authors = append(config.WhiteList.authors, authors...)
+	messages, err := getWhitelistEntries("message", tomlConfig.Whitelist.Messages)
+	if err != nil {
+		return err
 	}
+	config.WhiteList.messages = append(config.WhiteList.messages, messages...)
 
+	for _, link := range tomlConfig.Links {
+		host, err := regexp.Compile(link.Host)
+		if err != nil {
+			return fmt.Errorf("invalid links host %s: %v", link.Host, err)
+		}
+		config.links = append(config.links, &linkTemplate{host: host, commit: link.Commit, file: link.File})
+	}
+
+	config.detector = detect.Detector{
+		Rules:            config.Rules,
+		MaxFragmentLines: maxFragmentLines,
+		Workers:          runtime.GOMAXPROCS(0),
+	}
+	for _, re := range config.WhiteList.regexes {
+		config.detector.Allowlist.Lines = append(config.detector.Allowlist.Lines, re)
+	}
+	for _, re := range config.WhiteList.files {
+		config.detector.Allowlist.Files = append(config.detector.Allowlist.Files, re)
+	}
 	return nil
 }
 
+// getWhitelistEntries hydrates whitelist entries from the items of a toml whitelist. An
+// item is either a string or a table holding the item under key plus optional reason
+// and approvedBy fields. Commits are matched verbatim, everything else is a regex.
+func getWhitelistEntries(key string, items []interface{}) ([]*whitelistEntry, error) {
+	var entries []*whitelistEntry
+	for _, item := range items {
+		entry := &whitelistEntry{}
+		switch v := item.(type) {
+		case string:
+			entry.value = v
+		case map[string]interface{}:
+			entry.value, _ = v[key].(string)
+			entry.reason, _ = v["reason"].(string)
+			entry.approvedBy, _ = v["approvedBy"].(string)
+			if entry.value == "" {
+				return nil, fmt.Errorf("whitelist %s entry missing %s", key, key)
+			}
+			switch expires := v["expires"].(type) {
+			case nil:
+			case time.Time:
+				entry.expires = expires
+			case string:
+				t, err := time.Parse(expiresLayout, expires)
+				if err != nil {
+					return nil, fmt.Errorf("whitelist %s entry %s: expires should be a date like 2006-01-02", key, entry.value)
+				}
+				entry.expires = t
+			default:
+				return nil, fmt.Errorf("whitelist %s entry %s: expires should be a date like 2006-01-02", key, entry.value)
+			}
+		default:
+			return nil, fmt.Errorf("invalid whitelist %s entry: %v", key, item)
+		}
+		if entry.expired() {
+			log.Warnf("whitelist %s entry %s expired on %s, ignoring it", key, entry.value, entry.expires.Format(expiresLayout))
+			degrade()
+			continue
+		}
+		if key != "commit" && key != "fingerprint" {
+			entry.Regexp = regexp.MustCompile(entry.value)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
 // entropyRanges hydrates entropyRanges which allows for fine tuning entropy checking
-func getEntropyRanges(entropyLimitStr []string) ([]*entropyRange, error) {
-	var ranges []*entropyRange
+func getEntropyRanges(entropyLimitStr []string) ([]*detect.EntropyRange, error) {
+	var ranges []*detect.EntropyRange
 	for _, span := range entropyLimitStr {
 		split := strings.Split(span, "-")
 		v1, err := strconv.ParseFloat(split[0], 64)
@@ -173,11 +574,11 @@ func getEntropyRanges(entropyLimitStr []string) ([]*entropyRange, error) {
 		if v1 > v2 {
 			return nil, fmt.Errorf("entropy range must be ascending")
 		}
-		r := &entropyRange{
-			v1: v1,
-			v2: v2,
+		r := &detect.EntropyRange{
+			Min: v1,
+			Max: v2,
 		}
-		if r.v1 > 8.0 || r.v1 < 0.0 || r.v2 > 8.0 || r.v2 < 0.0 {
+		if r.Min > 8.0 || r.Min < 0.0 || r.Max > 8.0 || r.Max < 0.0 {
 			return nil, fmt.Errorf("invalid entropy ranges, must be within 0.0-8.0")
 		}
 		ranges = append(ranges, r)
@@ -189,20 +590,49 @@ func getEntropyRanges(entropyLimitStr []string) ([]*entropyRange, error) {
 // from a remote or local repo. Use the --repo-config option to trigger this.
 func (config *Config) updateFromRepo(repo *Repo) error {
 	var tomlConfig TomlConfig
-	wt, err := repo.repository.Worktree()
+	r, err := repoConfigReader(repo)
 	if err != nil {
-		return err
+		return fmt.Errorf("problem loading config: %v", err)
 	}
-	f, err := wt.Filesystem.Open(".gitleaks.toml")
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return fmt.Errorf("problem loading config: %v", err)
 	}
-	defer f.Close()
-	if _, err := toml.DecodeReader(f, &tomlConfig); err != nil {
+	if _, err := toml.Decode(string(b), &tomlConfig); err != nil {
 		return fmt.Errorf("problem loading config: %v", err)
 	}
 
-	return config.update(tomlConfig)
+	if err := config.update(tomlConfig); err != nil {
+		return err
+	}
+	config.stampRules(ruleProvenance{source: ruleSourceRepo, version: tomlConfig.Version, digest: fmt.Sprintf("%x", sha256.Sum256(b))})
+	return nil
+}
+
+// repoConfigReader opens the .gitleaks.toml of the worktree of repo. Bare repos, like
+// mirrors and clones into memory, have no worktree, so the file of HEAD is read instead.
+func repoConfigReader(repo *Repo) (io.ReadCloser, error) {
+	wt, err := repo.repository.Worktree()
+	if err == nil {
+		return wt.Filesystem.Open(".gitleaks.toml")
+	}
+	if err != git.ErrIsBareRepository {
+		return nil, err
+	}
+	head, err := repo.repository.Head()
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve HEAD: %v", err)
+	}
+	c, err := repo.repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.File(".gitleaks.toml")
+	if err != nil {
+		return nil, err
+	}
+	return f.Reader()
 }
 
 // getSSHAuth return an ssh auth use by go-git to clone repos behind authentication.
@@ -215,12 +645,13 @@ func getSSHAuth() (*ssh.PublicKeys, error) {
 	if opts.SSHKey != "" {
 		sshKeyPath = opts.SSHKey
 	} else {
-		// try grabbing default
-		c, err := user.Current()
+		// try grabbing default. $HOME is used rather than the user database, which
+		// needs cgo and is missing from scratch images
+		home, err := os.UserHomeDir()
 		if err != nil {
 			return nil, nil
 		}
-		sshKeyPath = fmt.Sprintf("%s/.ssh/id_rsa", c.HomeDir)
+		sshKeyPath = filepath.Join(home, ".ssh", "id_rsa")
 	}
 	sshAuth, err := ssh.NewPublicKeysFromFile("git", sshKeyPath, "")
 	if err != nil {
@@ -106,6 +106,20 @@ entropies = [
 filetypes = [".go"]
 `
 
+const testWhitelistAnnotated = `
+[[rules]]
+description = "AWS"
+regex = '''AKIA[0-9A-Z]{16}'''
+
+[whitelist]
+regexes = [
+  {regex = "AKIA", reason = "test fixtures", approvedBy = "gitleakstest"},
+]
+commits = [
+  {commit = "eaeffdc65b4c73ccb67e75d96bd8743be2c85973", reason = "rotated"},
+]
+`
+
 func testTomlLoader() string {
 	tmpDir, _ := ioutil.TempDir("", "whiteListConfigs")
 	ioutil.WriteFile(path.Join(tmpDir, "regex"), []byte(testWhitelistRegex), 0644)
@@ -119,5 +133,6 @@ func testTomlLoader() string {
 	ioutil.WriteFile(path.Join(tmpDir, "badEntropy2"), []byte(testBadEntropyRange2), 0644)
 	ioutil.WriteFile(path.Join(tmpDir, "mdFiles"), []byte(testMDFileType), 0644)
 	ioutil.WriteFile(path.Join(tmpDir, "entropyRegexGo"), []byte(testEntropyRegexRangeGoFilter), 0644)
+	ioutil.WriteFile(path.Join(tmpDir, "annotated"), []byte(testWhitelistAnnotated), 0644)
 	return tmpDir
 }
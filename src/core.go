@@ -1,11 +1,16 @@
 package gitleaks
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/zricethezav/gitleaks/src/detect"
 )
 
 var (
@@ -14,11 +19,18 @@ var (
 	dir          string
 	threads      int
 	totalCommits int64
-	mutex        = &sync.Mutex{}
+	// timezone of the dates of leaks, set by --timezone
+	timezone = time.UTC
+	// suppressedLeaks are matches skipped by whitelists, kept for --show-suppressed
+	suppressedLeaks []Leak
+	mutex           = &sync.Mutex{}
+	// cloneProgress is where the progress of clones is written, stderr with --jsonrpc
+	cloneProgress io.Writer = os.Stdout
 )
 
 func init() {
 	log.SetOutput(os.Stdout)
+	log.AddHook(idHook{})
 	threads = defaultThreadNum
 }
 
@@ -32,28 +44,117 @@ type Report struct {
 
 // Run is the entry point for gitleaks
 func Run(optsL *Options) (int, error) {
+	atomic.StoreInt64(&degradations, 0)
+	attestSubjects, attestRulesFired = nil, nil
+	policy, policyErr, repoHeads = nil, nil, nil
+	resetTelemetry()
+	started := time.Now()
+	leakCount, err := run(optsL)
+	if err == nil && isInterrupted() {
+		// the report is partial, it does not pass policies nor is it attested
+		err = ErrInterrupted
+	}
+	if err == nil {
+		err = policyErr
+	}
+	if err == nil && opts.Attest != "" {
+		err = writeAttestation(leakCount, started)
+	}
+	if err == nil && opts.EntropyReport != "" {
+		err = writeEntropyReport(opts.EntropyReport)
+	}
+	if err == nil {
+		err = strictError()
+	}
+	if opts != nil && opts.TelemetryURL != "" {
+		sendTelemetry(leakCount, err, started)
+	}
+	writeActionsOutputs(err)
+	return leakCount, err
+}
+
+func run(optsL *Options) (int, error) {
 	var (
 		err   error
 		leaks []Leak
 	)
 
 	opts = optsL
+	runID = newRunID()
+	currentSpan.Store("")
+	startRootTrace()
+	defer exportTraces()
+	resetProgress()
+	stopStatus := watchStatusSignal()
+	defer stopStatus()
+	stopInterrupt := watchInterrupt()
+	defer stopInterrupt()
+	timezone, _ = time.LoadLocation(opts.Timezone)
+	if opts.MergeReports != "" {
+		return mergeReports()
+	}
+
 	config, err = newConfig()
 	if err != nil {
 		return NoLeaks, err
 	}
 
-	if opts.Disk {
+	if opts.Policy != "" {
+		if policy, err = loadPolicy(opts.Policy); err != nil {
+			return NoLeaks, err
+		}
+	}
+
+	ruleCounts = nil
+	suppressedLeaks = nil
+	baseline = nil
+	revokedSecrets = nil
+	entropyHistogram = nil
+	if opts.EntropyReport != "" {
+		entropyHistogram = detect.NewEntropyHistogram()
+	}
+	repoRemoteURLs = make(map[string]string)
+	if opts.Baseline != "" {
+		baseline, err = loadBaseline(opts.Baseline)
+		if err != nil {
+			return NoLeaks, err
+		}
+	}
+	if opts.RevokedFeed != "" {
+		revokedSecrets, err = loadRevokedFeed(opts.RevokedFeed)
+		if err != nil {
+			return NoLeaks, err
+		}
+	}
+
+	if opts.Report != "" && opts.reportFormat() == "ndjson" && !opts.CountOnly {
+		if err = openLeakStream(); err != nil {
+			return NoLeaks, err
+		}
+		defer closeLeakStream()
+	}
+
+	if opts.KeepClones != "" {
+		// clones made with --keep-clones are left on disk for follow-up inspection
+		dir = opts.KeepClones
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return NoLeaks, err
+		}
+	} else if opts.Disk {
 		// temporary directory where all the gitleaks plain clones will reside
 		dir, err = ioutil.TempDir("", "gitleaks")
-		defer os.RemoveAll(dir)
 		if err != nil {
 			return NoLeaks, err
 		}
+		cloneTempDir = dir
+		defer func() {
+			removeCloneTempDir()
+			cloneTempDir = ""
+		}()
 	}
 
 	// start audits
-	if opts.Repo != "" || opts.RepoPath != "" {
+	if opts.Repo != "" || opts.RepoPath != "" || opts.Bundle != "" {
 		var repo *Repo
 		repo, err = newRepo()
 		if err != nil {
@@ -71,26 +172,66 @@ func Run(optsL *Options) (int, error) {
 		leaks = repo.leaks
 	} else if opts.OwnerPath != "" {
 		var repos []*Repo
+		enumerateTrace := startTrace("enumerate", "").set("owner", opts.OwnerPath)
 		repos, err = discoverRepos(opts.OwnerPath)
+		enumerateTrace.finish()
 		if err != nil {
 			return NoLeaks, err
 		}
+		guard, err := newDiscoveryGuard(opts.OwnerPath)
+		if err != nil {
+			return NoLeaks, err
+		}
+		var shardRepos []*Repo
+		for _, repo := range repos {
+			if !inShard(repo.name) {
+				continue
+			}
+			if err = guard.add(0); err != nil {
+				return NoLeaks, err
+			}
+			shardRepos = append(shardRepos, repo)
+		}
+		repos = shardRepos
 		for _, repo := range repos {
+			if isInterrupted() {
+				break
+			}
 			err = repo.clone()
 			if err != nil {
 				log.Warnf("error occurred cloning repo: %s, continuing to next repo", repo.name)
+				degrade()
 				continue
 			}
 			err = repo.audit()
 			if err != nil {
-				log.Warnf("error occurred auditing repo: %s, continuing to next repo", repo.name)
+				skipRepo(fmt.Errorf("error occurred auditing repo: %s, continuing to next repo: %w", repo.name, err))
 				continue
 			}
 			repo.report()
 			leaks = append(leaks, repo.leaks...)
 		}
+	} else if opts.Stdin {
+		leaks, err = auditStdin()
+		if err != nil {
+			return NoLeaks, err
+		}
+	} else if opts.Image != "" {
+		leaks, err = auditImage()
+		if err != nil {
+			return NoLeaks, err
+		}
+	} else if opts.Path != "" {
+		leaks, err = auditPath()
+		if err != nil {
+			return NoLeaks, err
+		}
 	} else if opts.AzdevOrg != "" {
 		return auditAzureDevOpsRepos()
+	} else if opts.BitbucketOrg != "" || opts.BitbucketUser != "" {
+		return auditBitbucketRepos()
+	} else if opts.GiteaOrg != "" || opts.GiteaUser != "" {
+		return auditGiteaRepos()
 	} else if opts.GithubOrg != "" || opts.GithubUser != "" {
 		return auditGithubRepos()
 	} else if opts.GitLabOrg != "" || opts.GitLabUser != "" {
@@ -99,12 +240,12 @@ func Run(optsL *Options) (int, error) {
 		return auditGithubPR()
 	}
 
-	if opts.Report != "" {
+	if opts.writesReport() {
 		err = writeReport(leaks)
 		if err != nil {
 			return NoLeaks, err
 		}
 	}
 
-	return len(leaks), nil
+	return failingLeaks(leaks), nil
 }
@@ -0,0 +1,84 @@
+package gitleaks
+
+import (
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ruleCounts tallies matches per repo and rule for --count-only. Counting skips
+// building leaks, which makes sizing audits of many repos a lot cheaper.
+var (
+	countMu    sync.Mutex
+	ruleCounts map[string]map[string]int64
+)
+
+// countMatch counts a match of rule in repo
+func countMatch(repoName string, rule string) {
+	countMu.Lock()
+	defer countMu.Unlock()
+	if ruleCounts == nil {
+		ruleCounts = make(map[string]map[string]int64)
+	}
+	if ruleCounts[repoName] == nil {
+		ruleCounts[repoName] = make(map[string]int64)
+	}
+	ruleCounts[repoName][rule]++
+}
+
+// repoCounts returns the rules matched in repo, sorted, and the number of matches of each
+func repoCounts(repoName string) ([]string, map[string]int64) {
+	countMu.Lock()
+	defer countMu.Unlock()
+	counts := make(map[string]int64)
+	var rules []string
+	for rule, count := range ruleCounts[repoName] {
+		rules = append(rules, rule)
+		counts[rule] = count
+	}
+	sort.Strings(rules)
+	return rules, counts
+}
+
+// reportCounts logs the matches counted in repo
+func reportCounts(repoName string) {
+	rules, counts := repoCounts(repoName)
+	var total int64
+	for _, rule := range rules {
+		total += counts[rule]
+		log.Infof("%d matches of rule %s", counts[rule], rule)
+	}
+	log.Infof("%d matches counted in %s", total, repoName)
+}
+
+// writeCountReport writes the matches counted per repo and rule as a csv to --report
+func writeCountReport() error {
+	log.Infof("writing report to %s", opts.Report)
+	countMu.Lock()
+	var repos []string
+	for repoName := range ruleCounts {
+		repos = append(repos, repoName)
+	}
+	countMu.Unlock()
+	sort.Strings(repos)
+
+	f, err := os.Create(opts.Report)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"repo", "rule", "count"})
+	for _, repoName := range repos {
+		rules, counts := repoCounts(repoName)
+		for _, rule := range rules {
+			w.Write([]string{repoName, rule, strconv.FormatInt(counts[rule], 10)})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,126 @@
+package gitleaks
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumn is a column of csv reports
+type csvColumn struct {
+	name  string
+	value func(Leak) string
+}
+
+// csvColumns are the columns of csv reports, in their default order
+var csvColumns = []csvColumn{
+	{"repo", func(leak Leak) string { return leak.Repo }},
+	{"line", func(leak Leak) string { return leak.Line }},
+	{"commit", func(leak Leak) string { return leak.Commit }},
+	{"offender", func(leak Leak) string { return leak.Offender }},
+	{"rule", func(leak Leak) string { return leak.Rule }},
+	{"info", func(leak Leak) string { return leak.Info }},
+	{"tags", func(leak Leak) string { return leak.Tags }},
+	{"severity", func(leak Leak) string { return leak.Severity }},
+	{"commitMsg", func(leak Leak) string { return leak.Message }},
+	{"author", func(leak Leak) string { return leak.Author }},
+	{"email", func(leak Leak) string { return leak.Email }},
+	{"file", func(leak Leak) string { return leak.File }},
+	{"date", func(leak Leak) string { return leak.Date.Format(time.RFC3339) }},
+	{"commitDate", func(leak Leak) string { return leak.CommitDate.Format(time.RFC3339) }},
+	{"runID", func(leak Leak) string { return leak.RunID }},
+	{"spanID", func(leak Leak) string { return leak.SpanID }},
+	{"alsoPresentIn", func(leak Leak) string { return strings.Join(leak.AlsoPresentIn, " ") }},
+	{"refs", func(leak Leak) string { return strings.Join(leak.Refs, " ") }},
+	{"lineNumber", func(leak Leak) string { return strconv.Itoa(leak.LineNumber) }},
+	{"startColumn", func(leak Leak) string { return strconv.Itoa(leak.StartColumn) }},
+	{"endColumn", func(leak Leak) string { return strconv.Itoa(leak.EndColumn) }},
+	{"ruleID", func(leak Leak) string { return leak.RuleID }},
+	{"fingerprint", func(leak Leak) string { return leak.Fingerprint }},
+	{"ruleSource", func(leak Leak) string { return leak.RuleSource }},
+	{"ruleVersion", func(leak Leak) string { return leak.RuleVersion }},
+	{"ruleDigest", func(leak Leak) string { return leak.RuleDigest }},
+	{"extraFields", func(leak Leak) string { return formatExtraFields(leak.ExtraFields) }},
+	{"lineLength", func(leak Leak) string { return strconv.Itoa(leak.LineLength) }},
+	{"offenderLength", func(leak Leak) string { return strconv.Itoa(leak.OffenderLength) }},
+	{"suppressedBy", func(leak Leak) string { return leak.SuppressedBy }},
+	{"contextBefore", func(leak Leak) string { return strings.Join(leak.ContextBefore, "\n") }},
+	{"contextAfter", func(leak Leak) string { return strings.Join(leak.ContextAfter, "\n") }},
+	{"revoked", func(leak Leak) string { return strconv.FormatBool(leak.Revoked) }},
+	{"verified", func(leak Leak) string {
+		if leak.Verified == nil {
+			return ""
+		}
+		return strconv.FormatBool(*leak.Verified)
+	}},
+}
+
+// reportCSVColumns returns the columns of the csv report: those of --csv-columns, or all
+// of them. The line is left out with --csv-no-line, the suppressing whitelist without
+// --show-suppressed, the context of leaks without --context, whether they are revoked
+// without --revoked-feed, whether they are verified without --verify and the extra fields
+// without [report.extraFields].
+func (opts *Options) reportCSVColumns() ([]csvColumn, error) {
+	if opts.CSVColumns == "" {
+		var columns []csvColumn
+		for _, column := range csvColumns {
+			if (column.name == "line" && opts.CSVNoLine) || (column.name == "suppressedBy" && !opts.ShowSuppressed) ||
+				(strings.HasPrefix(column.name, "context") && opts.Context == 0) || (column.name == "revoked" && opts.RevokedFeed == "") ||
+				(column.name == "verified" && !opts.Verify) || (column.name == "extraFields" && len(extraFields()) == 0) {
+				continue
+			}
+			columns = append(columns, column)
+		}
+		return columns, nil
+	}
+
+	byName := make(map[string]csvColumn)
+	for _, column := range csvColumns {
+		byName[column.name] = column
+	}
+	var columns []csvColumn
+	for _, name := range strings.Split(opts.CSVColumns, ",") {
+		column, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			var names []string
+			for _, column := range csvColumns {
+				names = append(names, column.name)
+			}
+			return nil, fmt.Errorf("unknown --csv-columns column %q, must be one of %s", strings.TrimSpace(name), strings.Join(names, ", "))
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// writeCSVReport writes leaks to w as csv, quoted as of RFC 4180, so lines with commas,
+// quotes or newlines stay in their field
+func writeCSVReport(w io.Writer, leaks []Leak) error {
+	columns, err := opts.reportCSVColumns()
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, leak := range leaks {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = column.value(leak)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,116 @@
+package gitleaks
+
+import (
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// blobKey identifies a secret of a rule added to a blob. Merges and cherry-picks add
+// the same blob in several commits, each of which reports the secret again.
+type blobKey struct {
+	blob, rule, offender string
+}
+
+// dedupeRefs collapses the leaks of the repo with the same blob, rule and offender into
+// the leak of the oldest commit, for --dedupe-refs. Refs of the kept leak lists the
+// branches and tags containing any of the collapsed commits. Leaks without a blob, like
+// those of removed lines, are kept as they are.
+func (repo *Repo) dedupeRefs() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	var (
+		deduped []Leak
+		kept    = make(map[blobKey]int)
+		commits = make(map[blobKey][]string)
+		targets = make(map[string]bool)
+	)
+	for _, leak := range repo.leaks {
+		if leak.blob == "" {
+			deduped = append(deduped, leak)
+			continue
+		}
+		key := blobKey{leak.blob, leak.Rule, leak.Offender}
+		commits[key] = append(commits[key], leak.Commit)
+		targets[leak.Commit] = true
+		if i, ok := kept[key]; !ok {
+			kept[key] = len(deduped)
+			deduped = append(deduped, leak)
+		} else if olderLeak(leak, deduped[i]) {
+			deduped[i] = leak
+		}
+	}
+	if len(kept) == 0 {
+		return
+	}
+
+	refsOf := commitRefs(repo.repository, targets)
+	for key, i := range kept {
+		var refs []string
+		for _, sha := range commits[key] {
+			for _, ref := range refsOf[sha] {
+				if !contains(refs, ref) {
+					refs = append(refs, ref)
+				}
+			}
+		}
+		sort.Strings(refs)
+		deduped[i].Refs = refs
+	}
+	log.Debugf("%d leaks of %s collapsed by blob into %d", len(repo.leaks), repo.name, len(deduped))
+	repo.leaks = deduped
+}
+
+// olderLeak returns true if a was committed before b. Cherry-picks keep the author date
+// of the original commit, so author dates are compared first.
+func olderLeak(a, b Leak) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.Before(b.Date)
+	}
+	return a.CommitDate.Before(b.CommitDate)
+}
+
+// commitRefs returns the short names of the branches and tags containing each of the
+// commits of targets. Every ref is walked, so this is only done for --dedupe-refs.
+func commitRefs(repository *git.Repository, targets map[string]bool) map[string][]string {
+	refsOf := make(map[string][]string)
+	if repository == nil || len(targets) == 0 {
+		return refsOf
+	}
+	refs, err := repository.References()
+	if err != nil {
+		log.Warnf("unable to list refs: %v", err)
+		return refsOf
+	}
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !(ref.Name().IsBranch() || ref.Name().IsTag() || ref.Name().IsRemote()) {
+			return nil
+		}
+		tip, err := commitOfRef(repository, ref)
+		if err != nil {
+			// refs to other objects
+			return nil
+		}
+		iter := object.NewCommitPreorderIter(tip, nil, nil)
+		iter.ForEach(func(c *object.Commit) error {
+			if targets[c.Hash.String()] {
+				refsOf[c.Hash.String()] = append(refsOf[c.Hash.String()], ref.Name().Short())
+			}
+			return nil
+		})
+		iter.Close()
+		return nil
+	})
+	return refsOf
+}
+
+// commitOfRef returns the commit ref points to, peeling annotated tags
+func commitOfRef(repository *git.Repository, ref *plumbing.Reference) (*object.Commit, error) {
+	if tag, err := repository.TagObject(ref.Hash()); err == nil {
+		return tag.Commit()
+	}
+	return repository.CommitObject(ref.Hash())
+}
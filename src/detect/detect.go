@@ -0,0 +1,357 @@
+// Package detect matches content against gitleaks rules. It knows nothing about git,
+// so the commit walker, the filesystem walker and any other source of content share
+// the same engine: wrap the content in a Fragment and call Detector.Detect.
+package detect
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// EntropyRange is an exclusive range of shannon entropy, between 0.0 and 8.0
+type EntropyRange struct {
+	Min float64
+	Max float64
+}
+
+// Rule instructs how gitleaks should audit each line of code
+type Rule struct {
+	// ID is a stable machine readable name of the rule, e.g. aws-client-id
+	ID          string
+	Description string
+	Regex       *regexp.Regexp
+	Severity    string
+	Tags        []string
+	Entropies   []*EntropyRange
+	// EntropyROI is "word" to measure the entropy of each word of a line instead of
+	// the whole line
+	EntropyROI string
+	FileTypes  []*regexp.Regexp
+	// Entropy, if set, is the minimum shannon entropy of the secret matched by Regex
+	Entropy float64
+	// SecretGroup is the capture group of Regex holding the secret, 0 for the whole match
+	SecretGroup int
+	// Keywords, if set, skip lines containing none of them before running Regex. They
+	// must be lower case, and are matched against the lower cased line.
+	Keywords []string
+	// Allowlist allows the findings of this rule only, e.g. test fixtures of a rule
+	// which is too valuable to allowlist the fixtures for every rule
+	Allowlist Allowlist
+}
+
+// Allow is an allowlist entry. *regexp.Regexp satisfies it, and so does any type
+// embedding one, which lets callers attach their own data to entries.
+type Allow interface {
+	FindString(s string) string
+}
+
+// Allowlist holds entries matched against the lines and file path of a fragment
+type Allowlist struct {
+	Lines []Allow
+	Files []Allow
+}
+
+// Fragment is content to audit plus the path of the file it belongs to, which rules
+// and the allowlist can match on
+type Fragment struct {
+	Content  string
+	FilePath string
+	// StartLine is the line number of the first line of Content, 1 if not set
+	StartLine int
+}
+
+// Finding is a rule match in a fragment
+type Finding struct {
+	Rule     *Rule
+	Line     string
+	Offender string
+	Info     string
+	// LineNumber is the line number of Line, counted from the fragment's StartLine.
+	// StartColumn and EndColumn are the first and last character of Offender in Line,
+	// counted from 1, or 0 if Offender is not part of Line.
+	LineNumber  int
+	StartColumn int
+	EndColumn   int
+	// AllowedBy is the allowlist entry which matched the file or line of the finding,
+	// AllowedKind is either "file" or "regex", or "rule file" or "rule regex" for
+	// entries of the allowlist of the rule. Only set if KeepAllowed is set.
+	AllowedBy   Allow
+	AllowedKind string
+}
+
+// Detector matches fragments against a set of rules
+type Detector struct {
+	Rules     []*Rule
+	Allowlist Allowlist
+	// KeepAllowed returns findings on allowlisted files and lines, marked with the
+	// entry which allowed them, instead of dropping them
+	KeepAllowed bool
+	// MaxFragmentLines, if set, splits fragments with more lines, like huge diffs of
+	// vendored dependencies, into pieces of that many lines which are matched in
+	// parallel by up to Workers goroutines
+	MaxFragmentLines int
+	Workers          int
+	// Entropies, if set, counts the entropy of the candidate secrets of every rule in
+	// lines which are not allowlisted, whether they become findings or not
+	Entropies *EntropyHistogram
+	// MaxLineLength, if set, skips lines longer than this many bytes, like those of
+	// minified bundles, which dominate the runtime of the regexes. SkippedLine, if set,
+	// is called with the line number and length of each skipped line.
+	MaxLineLength int
+	SkippedLine   func(filePath string, lineNumber, length int)
+}
+
+// Detect returns the findings of all rules in each line of fragment, in line order
+func (d *Detector) Detect(fragment Fragment) []Finding {
+	var (
+		allowedBy   Allow
+		allowedKind string
+	)
+	if allow := firstMatch(d.Allowlist.Files, fragment.FilePath); allow != nil {
+		if !d.KeepAllowed {
+			return nil
+		}
+		allowedBy, allowedKind = allow, "file"
+	}
+
+	startLine := fragment.StartLine
+	if startLine == 0 {
+		startLine = 1
+	}
+	lines := strings.Split(fragment.Content, "\n")
+	if d.MaxFragmentLines <= 0 || len(lines) <= d.MaxFragmentLines || d.Workers <= 1 {
+		return d.detectLines(lines, startLine, fragment.FilePath, allowedBy, allowedKind)
+	}
+
+	// match the pieces in parallel and put their findings back in line order
+	var (
+		wg        sync.WaitGroup
+		pieces    = (len(lines) + d.MaxFragmentLines - 1) / d.MaxFragmentLines
+		results   = make([][]Finding, pieces)
+		semaphore = make(chan bool, d.Workers)
+	)
+	for i := 0; i < pieces; i++ {
+		first := i * d.MaxFragmentLines
+		last := first + d.MaxFragmentLines
+		if last > len(lines) {
+			last = len(lines)
+		}
+		wg.Add(1)
+		semaphore <- true
+		go func(i, first, last int) {
+			defer func() {
+				wg.Done()
+				<-semaphore
+			}()
+			results[i] = d.detectLines(lines[first:last], startLine+first, fragment.FilePath, allowedBy, allowedKind)
+		}(i, first, last)
+	}
+	wg.Wait()
+
+	var findings []Finding
+	for _, result := range results {
+		findings = append(findings, result...)
+	}
+	return findings
+}
+
+// detectLines matches lines, the first of which is line number firstLine, against
+// all rules
+func (d *Detector) detectLines(lines []string, firstLine int, filePath string, allowedBy Allow, allowedKind string) []Finding {
+	var findings []Finding
+	for i, line := range lines {
+		if d.MaxLineLength > 0 && len(line) > d.MaxLineLength {
+			if d.SkippedLine != nil {
+				d.SkippedLine(filePath, firstLine+i, len(line))
+			}
+			continue
+		}
+		lineAllowedBy, lineAllowedKind := allowedBy, allowedKind
+		if allow := firstMatch(d.Allowlist.Lines, line); allow != nil {
+			if !d.KeepAllowed {
+				continue
+			}
+			if lineAllowedBy == nil {
+				lineAllowedBy, lineAllowedKind = allow, "regex"
+			}
+		}
+		lowerLine := strings.ToLower(line)
+		for _, rule := range d.Rules {
+			if !rule.hasKeyword(lowerLine) {
+				continue
+			}
+			if d.Entropies != nil && lineAllowedBy == nil && rule.matchesFile(filePath) {
+				rule.observeEntropy(line, d.Entropies)
+			}
+			finding := rule.check(line, filePath)
+			if finding == nil {
+				continue
+			}
+			finding.LineNumber = firstLine + i
+			finding.StartColumn, finding.EndColumn = columns(line, finding.Offender)
+			finding.AllowedBy, finding.AllowedKind = lineAllowedBy, lineAllowedKind
+			if allow, kind := rule.allowed(line, filePath); allow != nil {
+				if !d.KeepAllowed {
+					continue
+				}
+				if finding.AllowedBy == nil {
+					finding.AllowedBy, finding.AllowedKind = allow, kind
+				}
+			}
+			findings = append(findings, *finding)
+		}
+	}
+	return findings
+}
+
+// columns returns the first and last character of offender in line, counted from 1
+func columns(line, offender string) (int, int) {
+	i := strings.Index(line, offender)
+	if i == -1 || offender == "" {
+		return 0, 0
+	}
+	start := utf8.RuneCountInString(line[:i]) + 1
+	return start, start + utf8.RuneCountInString(offender) - 1
+}
+
+// firstMatch returns the first entry of allowlist matching s, or nil
+func firstMatch(allowlist []Allow, s string) Allow {
+	for _, allow := range allowlist {
+		if allow.FindString(s) != "" {
+			return allow
+		}
+	}
+	return nil
+}
+
+// allowed returns the first entry of the allowlist of the rule matching filePath or
+// line, and its kind, or nil
+func (rule *Rule) allowed(line, filePath string) (Allow, string) {
+	if allow := rule.AllowedFile(filePath); allow != nil {
+		return allow, "rule file"
+	}
+	if allow := firstMatch(rule.Allowlist.Lines, line); allow != nil {
+		return allow, "rule regex"
+	}
+	return nil, ""
+}
+
+// AllowedFile returns the first file entry of the allowlist of the rule matching
+// filePath, or nil
+func (rule *Rule) AllowedFile(filePath string) Allow {
+	return firstMatch(rule.Allowlist.Files, filePath)
+}
+
+// hasKeyword reports whether lowerLine contains one of the keywords of the rule, or
+// the rule has none
+func (rule *Rule) hasKeyword(lowerLine string) bool {
+	if len(rule.Keywords) == 0 {
+		return true
+	}
+	for _, keyword := range rule.Keywords {
+		if strings.Contains(lowerLine, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesFile reports whether filePath is one of the FileTypes of the rule, or the rule
+// has none
+func (rule *Rule) matchesFile(filePath string) bool {
+	if len(rule.FileTypes) == 0 {
+		return true
+	}
+	for _, f := range rule.FileTypes {
+		if f.FindString(filePath) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// check inspects a single line of filePath and returns a finding if the rule matches
+func (rule *Rule) check(line string, filePath string) *Finding {
+	var (
+		match       string
+		entropy     float64
+		entropyWord string
+	)
+
+	if !rule.matchesFile(filePath) {
+		return nil
+	}
+
+	if rule.Entropy != 0 || rule.SecretGroup != 0 {
+		return rule.checkSecret(line)
+	}
+
+	if rule.Entropies != nil {
+		if rule.EntropyROI == "word" {
+			words := strings.Fields(line)
+			for _, word := range words {
+				_entropy := getShannonEntropy(word)
+				for _, e := range rule.Entropies {
+					if _entropy > e.Min && _entropy < e.Max {
+						entropy = _entropy
+						entropyWord = word
+						goto postEntropy
+					}
+				}
+			}
+		} else {
+			_entropy := getShannonEntropy(line)
+			for _, e := range rule.Entropies {
+				if _entropy > e.Min && _entropy < e.Max {
+					entropy = _entropy
+					entropyWord = line
+					goto postEntropy
+				}
+			}
+		}
+	}
+
+postEntropy:
+	if rule.Regex != nil {
+		match = rule.Regex.FindString(line)
+	}
+
+	if match != "" && entropy != 0.0 {
+		return rule.finding(line, fmt.Sprintf("%s regex match and entropy met at %.2f", rule.Regex.String(), entropy), entropyWord)
+	} else if match != "" && rule.Entropies == nil {
+		return rule.finding(line, fmt.Sprintf("%s regex match", rule.Regex.String()), match)
+	} else if entropy != 0.0 && rule.Regex.String() == "" {
+		return rule.finding(line, fmt.Sprintf("entropy met at %.2f", entropy), entropyWord)
+	}
+	return nil
+}
+
+// checkSecret matches rules which combine the regex with the entropy of the secret it
+// captures, instead of measuring the entropy of the whole line or of every word
+func (rule *Rule) checkSecret(line string) *Finding {
+	groups := rule.Regex.FindStringSubmatch(line)
+	if len(groups) <= rule.SecretGroup || groups[rule.SecretGroup] == "" {
+		return nil
+	}
+	secret := groups[rule.SecretGroup]
+	if rule.Entropy == 0 {
+		return rule.finding(line, fmt.Sprintf("%s regex match", rule.Regex.String()), secret)
+	}
+	entropy := getShannonEntropy(secret)
+	if entropy < rule.Entropy {
+		return nil
+	}
+	return rule.finding(line, fmt.Sprintf("%s regex match and secret entropy %.2f above %.2f", rule.Regex.String(), entropy, rule.Entropy), secret)
+}
+
+func (rule *Rule) finding(line, info, offender string) *Finding {
+	return &Finding{
+		Rule:     rule,
+		Line:     line,
+		Offender: offender,
+		Info:     info,
+	}
+}
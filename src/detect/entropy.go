@@ -0,0 +1,114 @@
+package detect
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EntropyBuckets is the number of buckets of an EntropyHistogram, one per tenth from
+// 0.0 to 8.0
+const EntropyBuckets = 81
+
+// EntropyHistogram counts the shannon entropy of the candidate secrets of each rule,
+// in buckets of a tenth, so entropy thresholds can be chosen from the content being
+// audited. It is safe for concurrent use.
+type EntropyHistogram struct {
+	mu     sync.Mutex
+	counts map[string]*[EntropyBuckets]int64
+}
+
+// NewEntropyHistogram returns an empty histogram
+func NewEntropyHistogram() *EntropyHistogram {
+	return &EntropyHistogram{counts: make(map[string]*[EntropyBuckets]int64)}
+}
+
+// Observe counts the entropy of a candidate secret of rule
+func (h *EntropyHistogram) Observe(rule *Rule, entropy float64) {
+	bucket := int(math.Round(entropy * 10))
+	if bucket >= EntropyBuckets {
+		bucket = EntropyBuckets - 1
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts, ok := h.counts[rule.Description]
+	if !ok {
+		counts = new([EntropyBuckets]int64)
+		h.counts[rule.Description] = counts
+	}
+	counts[bucket]++
+}
+
+// Rules returns the descriptions of the rules with candidates, sorted
+func (h *EntropyHistogram) Rules() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var rules []string
+	for rule := range h.counts {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+// Counts returns the number of candidates of rule per bucket, bucket i holding the
+// entropies rounding to i/10
+func (h *EntropyHistogram) Counts(rule string) [EntropyBuckets]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if counts, ok := h.counts[rule]; ok {
+		return *counts
+	}
+	return [EntropyBuckets]int64{}
+}
+
+// observeEntropy counts the entropy of the candidate secrets of rule in line: the
+// secret matched by Regex, or the line or its words for rules with entropy ranges
+func (rule *Rule) observeEntropy(line string, h *EntropyHistogram) {
+	var candidates []string
+	switch {
+	case rule.Entropies != nil:
+		if rule.Regex != nil && rule.Regex.String() != "" && !rule.Regex.MatchString(line) {
+			return
+		}
+		candidates = []string{line}
+		if rule.EntropyROI == "word" {
+			candidates = strings.Fields(line)
+		}
+	case rule.Regex != nil && rule.Regex.String() != "":
+		groups := rule.Regex.FindStringSubmatch(line)
+		if len(groups) <= rule.SecretGroup || groups[rule.SecretGroup] == "" {
+			return
+		}
+		candidates = []string{groups[rule.SecretGroup]}
+	}
+	for _, candidate := range candidates {
+		h.Observe(rule, getShannonEntropy(candidate))
+	}
+}
+
+// ShannonEntropy returns the shannon entropy of data, in bits per character
+func ShannonEntropy(data string) float64 {
+	return getShannonEntropy(data)
+}
+
+// getShannonEntropy https://en.wiktionary.org/wiki/Shannon_entropy
+func getShannonEntropy(data string) (entropy float64) {
+	if data == "" {
+		return 0
+	}
+
+	charCounts := make(map[rune]int)
+	for _, char := range data {
+		charCounts[char]++
+	}
+
+	invLength := 1.0 / float64(len(data))
+	for _, count := range charCounts {
+		freq := float64(count) * invLength
+		entropy -= freq * math.Log2(freq)
+	}
+
+	return entropy
+}
@@ -0,0 +1,165 @@
+package gitleaks
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the suffixes accepted by --max-total-size
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a human readable size like "500MB" or "2GB" into bytes. A bare
+// number is taken as bytes.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid size %s", s)
+			}
+			return int64(n * float64(unit.bytes)), nil
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	return n, nil
+}
+
+// discoveryGuard enforces --max-repos and --max-total-size while the repos of a user,
+// organization or owner directory are enumerated, so that an accidental audit of a
+// huge organization fails before anything is cloned.
+type discoveryGuard struct {
+	owner     string
+	repos     int
+	totalSize int64
+	maxSize   int64
+}
+
+func newDiscoveryGuard(owner string) (*discoveryGuard, error) {
+	guard := &discoveryGuard{owner: owner}
+	if opts.MaxTotalSize != "" {
+		maxSize, err := parseSize(opts.MaxTotalSize)
+		if err != nil {
+			return nil, err
+		}
+		guard.maxSize = maxSize
+	}
+	return guard, nil
+}
+
+// add accounts for a discovered repo of size bytes, returning an error once a limit
+// is exceeded. Providers which do not report sizes pass 0.
+func (guard *discoveryGuard) add(size int64) error {
+	guard.repos++
+	guard.totalSize += size
+	if opts.MaxRepos != 0 && guard.repos > opts.MaxRepos {
+		return fmt.Errorf("%s has more than %d repos, refusing to audit. Raise --max-repos to continue",
+			guard.owner, opts.MaxRepos)
+	}
+	if guard.maxSize != 0 && guard.totalSize > guard.maxSize {
+		return fmt.Errorf("repos of %s exceed %s (--max-total-size) after %d repos, refusing to audit. Raise --max-total-size to continue",
+			guard.owner, opts.MaxTotalSize, guard.repos)
+	}
+	return nil
+}
+
+// String summarizes what has been discovered so far
+func (guard *discoveryGuard) String() string {
+	return fmt.Sprintf("%d repos, %s", guard.repos, formatSize(guard.totalSize))
+}
+
+func formatSize(size int64) string {
+	for _, unit := range sizeUnits {
+		if size >= unit.bytes && unit.bytes > 1 {
+			return fmt.Sprintf("%.1f%s", float64(size)/float64(unit.bytes), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// shard is a 1-based slice of the repos of an owner, set with --shard=i/n
+type shard struct {
+	index int
+	count int
+}
+
+// parseShard parses "i/n" where 1 <= i <= n
+func parseShard(s string) (*shard, error) {
+	split := strings.Split(s, "/")
+	if len(split) != 2 {
+		return nil, fmt.Errorf("invalid shard %s, expected i/n", s)
+	}
+	index, err := strconv.Atoi(split[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard %s, expected i/n", s)
+	}
+	count, err := strconv.Atoi(split[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard %s, expected i/n", s)
+	}
+	if count < 1 || index < 1 || index > count {
+		return nil, fmt.Errorf("invalid shard %s, must satisfy 1 <= i <= n", s)
+	}
+	return &shard{index: index, count: count}, nil
+}
+
+// inShard returns true if the repo called name belongs to the shard selected with
+// --shard. Repos are assigned by a hash of their name so every job of a split audit
+// agrees on the assignment without coordinating.
+func inShard(name string) bool {
+	return matchesShard(opts.Shard, name)
+}
+
+// inTopics returns true if a repo with topics is selected by --topic and --exclude-topic:
+// it has none of the excluded topics and, if --topic is set, one of its topics. Topics
+// are compared ignoring case.
+func inTopics(topics []string) bool {
+	has := func(selected []string) bool {
+		for _, topic := range topics {
+			for _, s := range selected {
+				if strings.EqualFold(topic, s) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if has(opts.ExcludeTopic) {
+		return false
+	}
+	return len(opts.Topic) == 0 || has(opts.Topic)
+}
+
+// inRefShard returns true if the ref called name belongs to the shard selected with
+// --ref-shard
+func inRefShard(name string) bool {
+	return matchesShard(opts.RefShard, name)
+}
+
+func matchesShard(spec, name string) bool {
+	if spec == "" {
+		return true
+	}
+	s, err := parseShard(spec)
+	if err != nil {
+		// validated by opts.guard
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32()%uint32(s.count)) == s.index-1
+}
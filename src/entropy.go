@@ -1,25 +1,76 @@
 package gitleaks
 
 import (
-	"math"
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zricethezav/gitleaks/src/detect"
 )
 
-// getShannonEntropy https://en.wiktionary.org/wiki/Shannon_entropy
-func getShannonEntropy(data string) (entropy float64) {
-	if data == "" {
-		return 0
-	}
+// entropyHistogram counts the entropy of the candidate secrets of each rule for
+// --entropy-report, nil without it
+var entropyHistogram *detect.EntropyHistogram
 
-	charCounts := make(map[rune]int)
-	for _, char := range data {
-		charCounts[char]++
+// writeEntropyReport writes the histogram of the entropy of the candidate secrets of
+// each rule to path, with percentiles to choose entropy thresholds from. Candidates
+// are the secrets matched by the regex of a rule, or the lines or words of rules with
+// entropy ranges, whether they were reported as leaks or not.
+func writeEntropyReport(path string) error {
+	log.Infof("writing entropy report to %s", path)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-
-	invLength := 1.0 / float64(len(data))
-	for _, count := range charCounts {
-		freq := float64(count) * invLength
-		entropy -= freq * math.Log2(freq)
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# entropy of the candidate secrets of each rule, in buckets of 0.1")
+	for _, rule := range entropyHistogram.Rules() {
+		counts := entropyHistogram.Counts(rule)
+		var total, max int64
+		first, last := -1, 0
+		for i, n := range counts {
+			total += n
+			if n > max {
+				max = n
+			}
+			if n != 0 {
+				if first == -1 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s: %d candidates, p50 %.1f, p90 %.1f, p99 %.1f\n", rule, total,
+			entropyPercentile(counts, total, 0.5), entropyPercentile(counts, total, 0.9), entropyPercentile(counts, total, 0.99))
+		for i := first; i <= last; i++ {
+			bar := int(counts[i] * 50 / max)
+			if counts[i] != 0 && bar == 0 {
+				bar = 1
+			}
+			fmt.Fprintln(w, strings.TrimSpace(fmt.Sprintf("%4.1f %8d %s", float64(i)/10, counts[i], strings.Repeat("#", bar))))
+		}
 	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
 
-	return entropy
+// entropyPercentile returns the entropy below which the fraction p of the candidates
+// of a histogram lie
+func entropyPercentile(counts [detect.EntropyBuckets]int64, total int64, p float64) float64 {
+	var seen int64
+	for i, n := range counts {
+		seen += n
+		if float64(seen) >= p*float64(total) {
+			return float64(i) / 10
+		}
+	}
+	return 8.0
 }
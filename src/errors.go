@@ -0,0 +1,75 @@
+package gitleaks
+
+import (
+	"errors"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// Errors returned by gitleaks. Use errors.Is to check for them, the returned errors
+// may wrap the error of the underlying git or provider library.
+var (
+	// ErrAuthRequired is returned when a repo can not be cloned without credentials
+	ErrAuthRequired = errors.New("authentication required")
+	// ErrInvalidAuth is returned when the credentials do not fit the clone url, e.g. an
+	// ssh key for an https url
+	ErrInvalidAuth = errors.New("invalid auth method")
+	// ErrRepoNotFound is returned when a repo does not exist or is not visible with
+	// the supplied credentials
+	ErrRepoNotFound = errors.New("repository not found")
+	// ErrEmptyRepo is returned when cloning a repo without any commits
+	ErrEmptyRepo = errors.New("remote repository is empty")
+	// ErrWhitelisted is returned when the target repo is whitelisted
+	ErrWhitelisted = errors.New("whitelisted")
+	// ErrExcludedFork is returned when a fork is skipped because of --exclude-forks
+	ErrExcludedFork = errors.New("excluding forks")
+	// ErrUnhealthyRepo is returned when a repo can not be audited completely, e.g. a
+	// shallow clone or a repo with refs to missing objects
+	ErrUnhealthyRepo = errors.New("unhealthy repository")
+	// ErrTooManyRefs is returned when a repo has more refs than --max-refs
+	ErrTooManyRefs = errors.New("too many refs")
+	// ErrInterrupted is returned when the audit is interrupted, after reporting the leaks
+	// found until then
+	ErrInterrupted = errors.New("interrupted, the report only has the leaks found before the interrupt")
+)
+
+// gitleaksError ties an error of a dependency to one of the exported gitleaks errors,
+// keeping the original error and its message.
+type gitleaksError struct {
+	sentinel error
+	err      error
+}
+
+func (e *gitleaksError) Error() string {
+	return e.err.Error()
+}
+
+// Is reports whether target is the gitleaks error this error corresponds to
+func (e *gitleaksError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// Unwrap returns the original error
+func (e *gitleaksError) Unwrap() error {
+	return e.err
+}
+
+// cloneError maps the errors go-git returns while cloning to the exported errors
+func cloneError(err error) error {
+	var sentinel error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, transport.ErrAuthenticationRequired):
+		sentinel = ErrAuthRequired
+	case errors.Is(err, transport.ErrInvalidAuthMethod):
+		sentinel = ErrInvalidAuth
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		sentinel = ErrRepoNotFound
+	case errors.Is(err, transport.ErrEmptyRemoteRepository):
+		sentinel = ErrEmptyRepo
+	default:
+		return err
+	}
+	return &gitleaksError{sentinel: sentinel, err: err}
+}
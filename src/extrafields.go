@@ -0,0 +1,52 @@
+package gitleaks
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// newExtraFields returns the fields of [report.extraFields] of a config, added to every
+// leak and to the envelopes of reports and notifications, e.g. the team owning the
+// audited repos or the id of the pipeline running the audit for routing downstream.
+// Values may reference environment variables, expanded once when the config is loaded.
+func newExtraFields(tomlConfig TomlConfig) (map[string]string, error) {
+	if len(tomlConfig.Report.ExtraFields) == 0 {
+		return nil, nil
+	}
+	fields := make(map[string]string, len(tomlConfig.Report.ExtraFields))
+	for name, value := range tomlConfig.Report.ExtraFields {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("[report.extraFields] has a field without a name")
+		}
+		fields[name] = os.Expand(value, func(env string) string {
+			v, ok := os.LookupEnv(env)
+			if !ok {
+				log.Warnf("extra field %s of [report.extraFields] references %s, which is not set", name, env)
+			}
+			return v
+		})
+	}
+	return fields, nil
+}
+
+// extraFields returns the fields of [report.extraFields] of the config of the run
+func extraFields() map[string]string {
+	if config == nil {
+		return nil
+	}
+	return config.extraFields
+}
+
+// formatExtraFields formats fields as name=value pairs sorted by name, for csv reports
+func formatExtraFields(fields map[string]string) string {
+	pairs := make([]string, 0, len(fields))
+	for name, value := range fields {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
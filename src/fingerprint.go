@@ -0,0 +1,50 @@
+package gitleaks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ruleID returns the default id of a rule described by description: its letters and
+// digits in lower case, with every other run of characters replaced by a dash, e.g.
+// aws-client-id for "AWS Client ID"
+func ruleID(description string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range description {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() != 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// findingFingerprint identifies the leak by the rule ruleID at line and column of file in
+// a commit of repo. Unlike leakFingerprint it ignores the rule description and the
+// offender as reported, so it is the same across runs, report formats and --redact.
+// The secret itself is only part of the fingerprint with --hash-key, as the hmac-sha256
+// keyed with it, since a plain sha256 of secrets would let short secrets of redacted
+// reports be brute forced.
+func findingFingerprint(repo, commit, file, ruleID string, line, column int, secret string) string {
+	h := sha256.New()
+	fields := []string{repo, commit, reportPath(file), ruleID, strconv.Itoa(line), strconv.Itoa(column)}
+	if opts != nil && opts.hashKey != nil {
+		h = hmac.New(sha256.New, opts.hashKey)
+		fields = append(fields, secret)
+	}
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package gitleaks
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+)
+
+// forkFingerprint identifies a leak regardless of the repo it was found in. Forks share
+// the commits of their upstream, so both report the same leak.
+func forkFingerprint(leak Leak) string {
+	h := sha256.New()
+	for _, field := range []string{leak.Commit, leak.File, leak.Rule, leak.Offender, leak.Line} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// dedupForks collapses leaks found in forks into the same leak of their upstream, or
+// of the first fork reporting it if the upstream was not audited. The collapsed
+// repos are listed in AlsoPresentIn, so an owner audit counts each exposed secret
+// once. forks holds the names of the audited repos which are forks.
+func dedupForks(leaks []Leak, forks map[string]bool) []Leak {
+	if len(forks) == 0 {
+		return leaks
+	}
+	var (
+		deduped     []Leak
+		primary     = make(map[string]int)
+		alsoPresent = make(map[int][]string)
+		kept        = make(map[int]int)
+	)
+	// leaks of upstreams first, so forks collapse into them regardless of audit order
+	for _, fork := range []bool{false, true} {
+		for i, leak := range leaks {
+			// leaks without a commit are not part of the shared history
+			if forks[leak.Repo] != fork || leak.Commit == "N/A" {
+				continue
+			}
+			if _, ok := primary[forkFingerprint(leak)]; !ok {
+				primary[forkFingerprint(leak)] = i
+			}
+		}
+	}
+	for i, leak := range leaks {
+		if forks[leak.Repo] && leak.Commit != "N/A" {
+			p := primary[forkFingerprint(leak)]
+			if leaks[p].Repo != leak.Repo {
+				if !contains(alsoPresent[p], leak.Repo) {
+					alsoPresent[p] = append(alsoPresent[p], leak.Repo)
+				}
+				continue
+			}
+		}
+		kept[i] = len(deduped)
+		deduped = append(deduped, leak)
+	}
+	for p, repos := range alsoPresent {
+		sort.Strings(repos)
+		deduped[kept[p]].AlsoPresentIn = repos
+	}
+	return deduped
+}
+
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
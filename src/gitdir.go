@@ -0,0 +1,196 @@
+package gitleaks
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zricethezav/gitleaks/src/detect"
+)
+
+// remoteURLRule is reported when a remote url in the git config embeds a password or token
+var remoteURLRule = &Rule{
+	ID:          "remote-url-credentials",
+	Description: "Credentials in remote URL",
+	Severity:    "high",
+	Tags:        []string{"key", "URL", "config"},
+}
+
+// gitDir returns the git directory of an on-disk repo, which is either <path>/.git or,
+// for bare repos, path itself. An empty string is returned if neither exists.
+func gitDir(repoPath string) string {
+	dotGit := filepath.Join(repoPath, ".git")
+	if info, err := os.Stat(dotGit); err == nil && info.IsDir() {
+		return dotGit
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, "HEAD")); err == nil {
+		if _, err := os.Stat(filepath.Join(repoPath, "config")); err == nil {
+			return repoPath
+		}
+	}
+	return ""
+}
+
+// auditGitDir audits the files in the git directory of an on-disk repo which are not
+// part of the history: the git config, including remote urls, and hook scripts. Tokens
+// baked into remote urls are a common leak that history audits never see.
+func (repo *Repo) auditGitDir() {
+	dir := gitDir(repo.path)
+	if dir == "" {
+		return
+	}
+
+	configPath := filepath.Join(dir, "config")
+	if content, err := ioutil.ReadFile(configPath); err == nil {
+		repo.auditFile(repo.relPath(configPath), content)
+	}
+	repo.auditRemoteURLs(repo.relPath(configPath))
+
+	hooks, err := ioutil.ReadDir(filepath.Join(dir, "hooks"))
+	if err != nil {
+		return
+	}
+	for _, hook := range hooks {
+		if hook.IsDir() || strings.HasSuffix(hook.Name(), ".sample") {
+			continue
+		}
+		hookPath := filepath.Join(dir, "hooks", hook.Name())
+		content, err := ioutil.ReadFile(hookPath)
+		if err != nil {
+			log.Debugf("unable to read hook %s: %v", hookPath, err)
+			continue
+		}
+		if bytes.IndexByte(content, 0) != -1 {
+			// binary hook
+			continue
+		}
+		repo.auditFile(repo.relPath(hookPath), content)
+	}
+}
+
+// relPath returns p relative to the repo so git dir files are reported like tracked files
+func (repo *Repo) relPath(p string) string {
+	if rel, err := filepath.Rel(repo.path, p); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return p
+}
+
+func (repo *Repo) auditFile(filePath string, content []byte) {
+	repo.auditFragment(filePath, string(content), 1)
+}
+
+// auditFragment audits content of filePath outside of any commit. startLine is the line
+// number of the first line of content, or 0 if unknown.
+func (repo *Repo) auditFragment(filePath string, content string, startLine int) {
+	repo.auditContent(&Commit{
+		repoName:  repo.name,
+		filePath:  filePath,
+		content:   content,
+		sha:       "N/A",
+		startLine: startLine,
+	})
+}
+
+// auditContent inspects the content of commit, a file outside of any git commit, unless
+// the file is whitelisted or larger than --max-file-size
+func (repo *Repo) auditContent(commit *Commit) {
+	if skipWhitelistedFile(commit) || skipLargeFile(commit, int64(len(commit.content))) {
+		return
+	}
+	repo.inspect(commit)
+}
+
+// skipWhitelistedFile returns true if the file of commit is whitelisted, unless
+// --show-suppressed is set, which marks its leaks as suppressed instead
+func skipWhitelistedFile(commit *Commit) bool {
+	if re := whitelistedFile(commit.filePath); re != nil {
+		log.Debugf("skipping whitelisted file (matched regex '%s'%s): %s", re.String(), re.describe(), commit.filePath)
+		if !opts.ShowSuppressed {
+			return true
+		}
+		commit.suppressedBy = re.suppression("file")
+	}
+	return false
+}
+
+// hasLeakInFile returns true if a leak was already reported for a line of filePath containing s
+func (repo *Repo) hasLeakInFile(filePath, s string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, leak := range repo.leaks {
+		if leak.File == filePath && strings.Contains(leak.Line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteURLTokenRe matches usernames of remote urls which are tokens of git hosts, like
+// github and gitlab tokens or azure devops personal access tokens
+var remoteURLTokenRe = regexp.MustCompile(`^(?:gh[pousr]_[0-9A-Za-z]{36,}|github_pat_[0-9A-Za-z_]{22,}|glpat-[0-9A-Za-z_-]{20,}|[0-9a-f]{40}|[a-z2-7]{52})$`)
+
+// minRemoteURLTokenEntropy and minRemoteURLTokenLength are the entropy and length above
+// which usernames without a password are taken for tokens of unknown hosts
+const (
+	minRemoteURLTokenEntropy = 4.0
+	minRemoteURLTokenLength  = 24
+)
+
+// remoteURLSecret returns the password of a remote url, or else its username if it is a
+// token, e.g. https://<token>@github.com/org/repo, which git hosts accept as well
+func remoteURLSecret(u *url.URL) string {
+	if password, ok := u.User.Password(); ok && password != "" {
+		return password
+	}
+	username := u.User.Username()
+	if remoteURLTokenRe.MatchString(username) ||
+		(len(username) >= minRemoteURLTokenLength && detect.ShannonEntropy(username) >= minRemoteURLTokenEntropy) {
+		return username
+	}
+	return ""
+}
+
+// auditRemoteURLs reports remote urls which carry a password or a token, regardless of
+// the rules in the gitleaks config
+func (repo *Repo) auditRemoteURLs(configPath string) {
+	if repo.repository == nil {
+		return
+	}
+	cfg, err := repo.repository.Config()
+	if err != nil {
+		return
+	}
+	for _, remote := range cfg.Remotes {
+		for _, remoteURL := range remote.URLs {
+			u, err := url.Parse(remoteURL)
+			if err != nil || u.User == nil {
+				continue
+			}
+			secret := remoteURLSecret(u)
+			if secret == "" {
+				continue
+			}
+			if whitelistedLine(remoteURL) != nil || repo.hasLeakInFile(configPath, remoteURL) || ignoredLeak("N/A", configPath, remoteURLRule.Description) != nil {
+				continue
+			}
+			if opts.CountOnly {
+				countMatch(repo.name, remoteURLRule.Description)
+				continue
+			}
+			leak := newLeak(remoteURL, "remote "+remote.Name+" url contains credentials", secret, remoteURLRule, &Commit{
+				repoName: repo.name,
+				filePath: configPath,
+				sha:      "N/A",
+			})
+			mutex.Lock()
+			repo.leaks = append(repo.leaks, *leak)
+			mutex.Unlock()
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package gitleaks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	gitHttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// giteaPages number of records per request
+const giteaPages = 50
+
+// giteaRepo is a repo listed by the Gitea API, which Forgejo shares
+type giteaRepo struct {
+	Name     string `json:"name"`
+	CloneURL string `json:"clone_url"`
+	SSHURL   string `json:"ssh_url"`
+	HTMLURL  string `json:"html_url"`
+	// Size is in kilobytes
+	Size int64 `json:"size"`
+	Fork bool  `json:"fork"`
+}
+
+// auditGiteaRepos kicks off audits if --gitea-user or --gitea-org options are set.
+// Repos are listed with the API of the Gitea or Forgejo instance at --gitea-url, cloned
+// and audited one at a time. If an error occurs during an audit of a repo, that error
+// is logged.
+func auditGiteaRepos() (int, error) {
+	var (
+		tempDir string
+		err     error
+		leaks   []Leak
+		forks   = make(map[string]bool)
+	)
+	owner := opts.GiteaOrg + opts.GiteaUser
+	guard, err := newDiscoveryGuard(owner)
+	if err != nil {
+		return NoLeaks, err
+	}
+
+	enumerateTrace := startTrace("enumerate", "").set("owner", owner)
+	listed, err := listGiteaRepos()
+	if err != nil {
+		return NoLeaks, err
+	}
+	var repos []giteaRepo
+	for _, p := range listed {
+		if !inShard(p.Name) {
+			continue
+		}
+		if err = guard.add(p.Size * 1024); err != nil {
+			return NoLeaks, err
+		}
+		repos = append(repos, p)
+	}
+	enumerateTrace.set("repos", strconv.Itoa(len(repos))).finish()
+	log.Debugf("found repositories: %s", guard)
+
+	if opts.Disk {
+		if tempDir, err = ownerCloneDir(owner); err != nil {
+			return NoLeaks, fmt.Errorf("error creating temp directory: %v", err)
+		}
+	}
+
+	for _, p := range repos {
+		if isInterrupted() {
+			break
+		}
+		repo, err := cloneGiteaRepo(tempDir, p)
+		if err != nil {
+			skipRepo(err)
+			continue
+		}
+
+		err = repo.audit()
+		if err != nil {
+			skipRepo(err)
+			continue
+		}
+
+		if opts.Disk {
+			removeClone(fmt.Sprintf("%s/%s", tempDir, p.Name))
+		}
+
+		repo.report()
+		leaks = append(leaks, repo.leaks...)
+		if repo.fork {
+			forks[repo.name] = true
+		}
+	}
+
+	leaks = dedupForks(leaks, forks)
+	if opts.writesReport() {
+		err = writeReport(leaks)
+		if err != nil {
+			return NoLeaks, err
+		}
+	}
+
+	return failingLeaks(leaks), nil
+}
+
+// listGiteaRepos lists the repos of --gitea-org or --gitea-user
+func listGiteaRepos() ([]giteaRepo, error) {
+	var repos []giteaRepo
+	reposURL := fmt.Sprintf("%s/api/v1/orgs/%s/repos", strings.TrimSuffix(opts.GiteaURL, "/"), url.PathEscape(opts.GiteaOrg))
+	if opts.GiteaUser != "" {
+		reposURL = fmt.Sprintf("%s/api/v1/users/%s/repos", strings.TrimSuffix(opts.GiteaURL, "/"), url.PathEscape(opts.GiteaUser))
+	}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: newAPITransport(nil)}
+	for page := 1; ; page++ {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s?limit=%d&page=%d", reposURL, giteaPages, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		if token := os.Getenv("GITEA_TOKEN"); token != "" {
+			req.Header.Set("Authorization", "token "+token)
+		}
+		req.Header.Set("Accept", "application/json")
+
+		var pagedRepos []giteaRepo
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error listing gitea repos: %v", err)
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			err = json.NewDecoder(resp.Body).Decode(&pagedRepos)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			err = fmt.Errorf("error listing gitea repos: %w", ErrInvalidAuth)
+		case http.StatusNotFound:
+			err = fmt.Errorf("error listing gitea repos: %w", ErrRepoNotFound)
+		default:
+			err = fmt.Errorf("error listing gitea repos: %s", resp.Status)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		repos = append(repos, pagedRepos...)
+		if len(pagedRepos) < giteaPages {
+			// exit when we've seen all pages
+			break
+		}
+	}
+	return repos, nil
+}
+
+func cloneGiteaRepo(tempDir string, p giteaRepo) (*Repo, error) {
+	var (
+		repo *git.Repository
+		err  error
+	)
+
+	giteaToken := os.Getenv("GITEA_TOKEN")
+
+	if opts.ExcludeForks && p.Fork {
+		return nil, fmt.Errorf("skipping %s, %w", p.Name, ErrExcludedFork)
+	}
+
+	if re := whitelistedRepo(p.Name, p.CloneURL, p.SSHURL, p.HTMLURL); re != nil {
+		return nil, fmt.Errorf("skipping %s, %w%s", p.Name, ErrWhitelisted, re.describe())
+	}
+
+	opt := &git.CloneOptions{
+		URL: p.CloneURL,
+	}
+
+	if sshAuth := config.sshAuthFor(p.SSHURL); sshAuth != nil && giteaToken == "" {
+		opt.URL = p.SSHURL
+		opt.Auth = sshAuth
+	} else if giteaToken != "" {
+		opt.Auth = &gitHttp.BasicAuth{
+			Username: "fakeUsername", // yes, this can be anything except an empty string
+			Password: giteaToken,
+		}
+	}
+
+	log.Infof("cloning: %s", p.Name)
+	cloneTrace := startTrace("clone", "").set("repo", p.Name)
+	defer cloneTrace.finish()
+
+	if opts.Disk {
+		repo, err = plainClone(fmt.Sprintf("%s/%s", tempDir, p.Name), opt)
+	} else {
+		repo, err = memoryClone(opt)
+	}
+
+	if err != nil {
+		return nil, cloneError(err)
+	}
+
+	return &Repo{
+		repository: repo,
+		name:       p.Name,
+		fork:       p.Fork,
+	}, nil
+}
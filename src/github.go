@@ -3,19 +3,18 @@ package gitleaks
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 	"gopkg.in/src-d/go-git.v4"
 	gitHttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
-	"gopkg.in/src-d/go-git.v4/storage/memory"
 )
 
 var githubPages = 100
@@ -24,7 +23,7 @@ var githubPages = 100
 func auditGithubPR() (int, error) {
 	var leaks []Leak
 	ctx := context.Background()
-	githubClient := github.NewClient(githubToken())
+	githubClient := newGithubClient()
 	splits := strings.Split(opts.GithubPR, "/")
 	owner := splits[len(splits)-4]
 	repo := splits[len(splits)-3]
@@ -35,9 +34,13 @@ func auditGithubPR() (int, error) {
 
 	page := 1
 	for {
-		commits, resp, err := githubClient.PullRequests.ListCommits(ctx, owner, repo, prNum, &github.ListOptions{
-			PerPage: githubPages,
-			Page:    page,
+		var commits []*github.RepositoryCommit
+		resp, err := githubRetry("listing the commits of "+opts.GithubPR, func() (resp *github.Response, err error) {
+			commits, resp, err = githubClient.PullRequests.ListCommits(ctx, owner, repo, prNum, &github.ListOptions{
+				PerPage: githubPages,
+				Page:    page,
+			})
+			return resp, err
 		})
 		if err != nil {
 			return NoLeaks, err
@@ -45,35 +48,38 @@ func auditGithubPR() (int, error) {
 
 		for _, c := range commits {
 			totalCommits = totalCommits + 1
-			c, _, err := githubClient.Repositories.GetCommit(ctx, owner, repo, *c.SHA)
+			sha := c.GetSHA()
+			_, err := githubRetry("getting commit "+sha, func() (resp *github.Response, err error) {
+				c, resp, err = githubClient.Repositories.GetCommit(ctx, owner, repo, sha)
+				return resp, err
+			})
 			if err != nil {
 				continue
 			}
 			files := c.Files
 			for _, f := range files {
-				skipFile := false
+				suppressedBy := ""
 				if f.Patch == nil || f.Filename == nil {
 					continue
 				}
-				for _, re := range config.WhiteList.files {
-					if re.FindString(f.GetFilename()) != "" {
-						log.Infof("skipping whitelisted file (matched regex '%s'): %s", re.String(), f.GetFilename())
-						skipFile = true
-						break
+				if re := whitelistedFile(f.GetFilename()); re != nil {
+					log.Infof("skipping whitelisted file (matched regex '%s'%s): %s", re.String(), re.describe(), f.GetFilename())
+					if !opts.ShowSuppressed {
+						continue
 					}
-				}
-				if skipFile {
-					continue
+					suppressedBy = re.suppression("file")
 				}
 
 				commit := &Commit{
-					sha:      c.GetSHA(),
-					content:  *f.Patch,
-					filePath: *f.Filename,
-					repoName: repo,
-					author:   c.GetCommitter().GetLogin(),
-					message:  *c.Commit.Message,
-					date:     *c.Commit.Committer.Date,
+					sha:           c.GetSHA(),
+					content:       *f.Patch,
+					filePath:      *f.Filename,
+					repoName:      repo,
+					author:        c.GetCommitter().GetLogin(),
+					message:       *c.Commit.Message,
+					date:          c.Commit.GetAuthor().GetDate(),
+					committerDate: c.Commit.GetCommitter().GetDate(),
+					suppressedBy:  suppressedBy,
 				}
 				leaks = append(leaks, inspect(commit)...)
 			}
@@ -84,18 +90,20 @@ func auditGithubPR() (int, error) {
 		}
 	}
 
+	leaks = filterBaseline(leaks)
+	notifyLeaks(opts.GithubPR, leaks)
 	if len(leaks) != 0 {
 		log.Warnf("%d leaks detected. %d commits inspected for PR: %s", len(leaks), totalCommits, opts.GithubPR)
 	}
 
-	if opts.Report != "" {
+	if opts.writesReport() {
 		err = writeReport(leaks)
 		if err != nil {
 			return NoLeaks, err
 		}
 	}
 
-	return len(leaks), nil
+	return failingLeaks(leaks), nil
 }
 
 // auditGithubRepos kicks off audits if --github-user or --github-org options are set.
@@ -113,24 +121,21 @@ func auditGithubRepos() (int, error) {
 		done             bool
 		ownerDir         string
 		leaks            []Leak
+		forks            = make(map[string]bool)
 	)
 	ctx := context.Background()
-	githubClient := github.NewClient(githubToken())
+	githubClient := newGithubClient()
+	guard, err := newDiscoveryGuard(opts.GithubOrg + opts.GithubUser)
+	if err != nil {
+		return NoLeaks, err
+	}
 
+	enumerateTrace := startTrace("enumerate", "").set("owner", opts.GithubOrg+opts.GithubUser)
 	if opts.GithubOrg != "" {
-		if opts.GithubURL != "" && opts.GithubURL != defaultGithubURL {
-			ghURL, _ := url.Parse(opts.GithubURL)
-			githubClient.BaseURL = ghURL
-		}
 		githubOrgOptions = &github.RepositoryListByOrgOptions{
 			ListOptions: github.ListOptions{PerPage: 100},
 		}
 	} else if opts.GithubUser != "" {
-		if opts.GithubURL != "" && opts.GithubURL != defaultGithubURL {
-			ghURL, _ := url.Parse(opts.GithubURL)
-			githubClient.BaseURL = ghURL
-		}
-
 		githubOptions = &github.RepositoryListOptions{
 			Affiliation: "owner",
 			ListOptions: github.ListOptions{
@@ -144,93 +149,123 @@ func auditGithubRepos() (int, error) {
 			break
 		}
 		if opts.GithubUser != "" {
-			pagedGithubRepos, resp, err = githubClient.Repositories.List(ctx, opts.GithubUser, githubOptions)
+			resp, err = githubRetry("listing the repos of "+opts.GithubUser, func() (resp *github.Response, err error) {
+				pagedGithubRepos, resp, err = githubClient.Repositories.List(ctx, opts.GithubUser, githubOptions)
+				return resp, err
+			})
 			if err != nil {
-				done = true
+				return NoLeaks, err
 			}
 			githubOptions.Page = resp.NextPage
-			githubRepos = append(githubRepos, pagedGithubRepos...)
 			if resp.NextPage == 0 {
 				done = true
 			}
 		} else if opts.GithubOrg != "" {
-			pagedGithubRepos, resp, err = githubClient.Repositories.ListByOrg(ctx, opts.GithubOrg, githubOrgOptions)
+			resp, err = githubRetry("listing the repos of "+opts.GithubOrg, func() (resp *github.Response, err error) {
+				pagedGithubRepos, resp, err = githubClient.Repositories.ListByOrg(ctx, opts.GithubOrg, githubOrgOptions)
+				return resp, err
+			})
 			if err != nil {
-				done = true
+				return NoLeaks, err
 			}
 			githubOrgOptions.Page = resp.NextPage
-			githubRepos = append(githubRepos, pagedGithubRepos...)
 			if resp.NextPage == 0 {
 				done = true
 			}
 		}
+		for _, githubRepo := range pagedGithubRepos {
+			if !inShard(githubRepo.GetName()) || !inTopics(githubRepo.Topics) {
+				continue
+			}
+			// github reports sizes in kilobytes
+			if err = guard.add(int64(githubRepo.GetSize()) * 1024); err != nil {
+				return NoLeaks, err
+			}
+			githubRepos = append(githubRepos, githubRepo)
+		}
+		if os.Getenv("GITHUB_TOKEN") == "" {
+			log.Infof("unauthenticated github api requests remaining: %d/%d, resets at %s",
+				resp.Rate.Remaining, resp.Rate.Limit, resp.Rate.Reset.Format(time.RFC3339))
+		}
 		if opts.Log == "Debug" || opts.Log == "debug" {
 			for _, githubRepo := range pagedGithubRepos {
 				log.Debugf("staging repos %s", *githubRepo.Name)
 			}
 		}
 	}
+	enumerateTrace.set("repos", strconv.Itoa(len(githubRepos))).finish()
+	log.Debugf("discovered %s", guard)
 	if opts.Disk {
-		ownerDir, _ = ioutil.TempDir(dir, opts.GithubUser)
+		owner := opts.GithubUser
+		if opts.GithubOrg != "" {
+			owner = opts.GithubOrg
+		}
+		ownerDir, err = ownerCloneDir(owner)
+		if err != nil {
+			return NoLeaks, fmt.Errorf("unable to generate owner clone dir: %v", err)
+		}
 	}
 	for _, githubRepo := range githubRepos {
-		repo, err := cloneGithubRepo(githubRepo)
+		if isInterrupted() {
+			break
+		}
+		repo, err := cloneGithubRepo(ownerDir, githubRepo)
 		if err != nil {
-			log.Warn(err)
+			skipRepo(err)
 			continue
 		}
 		err = repo.audit()
 		if err != nil {
-			log.Warnf("error occurred during audit of repo: %s, err: %v, continuing github audit", repo.name, err)
+			skipRepo(fmt.Errorf("error occurred during audit of repo: %s, err: %w, continuing github audit", repo.name, err))
 		}
 		if opts.Disk {
-			os.RemoveAll(fmt.Sprintf("%s/%s", ownerDir, *githubRepo.Name))
+			removeClone(fmt.Sprintf("%s/%s", ownerDir, *githubRepo.Name))
 		}
 
 		repo.report()
 
 		leaks = append(leaks, repo.leaks...)
+		if repo.fork {
+			forks[repo.name] = true
+		}
 	}
 
-	if opts.Report != "" {
+	leaks = dedupForks(leaks, forks)
+	if opts.writesReport() {
 		err = writeReport(leaks)
 		if err != nil {
 			return NoLeaks, err
 		}
 	}
 
-	return len(leaks), nil
+	return failingLeaks(leaks), nil
 }
 
 // cloneGithubRepo clones a repo from the url parsed from a github repo. The repo
-// will be cloned to disk if --disk is set.
-func cloneGithubRepo(githubRepo *github.Repository) (*Repo, error) {
+// will be cloned to ownerDir if --disk is set.
+func cloneGithubRepo(ownerDir string, githubRepo *github.Repository) (*Repo, error) {
 	var (
 		repo *git.Repository
 		err  error
 	)
 	githubToken := os.Getenv("GITHUB_TOKEN")
 	if opts.ExcludeForks && githubRepo.GetFork() {
-		return nil, fmt.Errorf("skipping %s, excluding forks", *githubRepo.Name)
+		return nil, fmt.Errorf("skipping %s, %w", *githubRepo.Name, ErrExcludedFork)
 	}
-	for _, re := range config.WhiteList.repos {
-		if re.FindString(*githubRepo.Name) != "" {
-			return nil, fmt.Errorf("skipping %s, whitelisted", *githubRepo.Name)
-		}
+	if re := whitelistedRepo(*githubRepo.Name, githubRepo.GetCloneURL(), githubRepo.GetSSHURL(), githubRepo.GetHTMLURL()); re != nil {
+		return nil, fmt.Errorf("skipping %s, %w%s", *githubRepo.Name, ErrWhitelisted, re.describe())
 	}
 	log.Infof("cloning: %s", *githubRepo.Name)
+	cloneTrace := startTrace("clone", "").set("repo", *githubRepo.Name)
+	defer cloneTrace.finish()
 	if opts.Disk {
-		ownerDir, err := ioutil.TempDir(dir, opts.GithubUser)
-		if err != nil {
-			return nil, fmt.Errorf("unable to generater owner temp dir: %v", err)
-		}
-		if config.sshAuth != nil && githubToken == "" {
-			repo, err = git.PlainClone(fmt.Sprintf("%s/%s", ownerDir, *githubRepo.Name), false, &git.CloneOptions{
+		if sshAuth := config.sshAuthFor(githubRepo.GetSSHURL()); sshAuth != nil && githubToken == "" {
+			repo, err = plainClone(fmt.Sprintf("%s/%s", ownerDir, *githubRepo.Name), &git.CloneOptions{
 				URL:  *githubRepo.SSHURL,
-				Auth: config.sshAuth,
+				Auth: sshAuth,
 			})
 		} else if githubToken != "" {
-			repo, err = git.PlainClone(fmt.Sprintf("%s/%s", ownerDir, *githubRepo.Name), false, &git.CloneOptions{
+			repo, err = plainClone(fmt.Sprintf("%s/%s", ownerDir, *githubRepo.Name), &git.CloneOptions{
 				URL: *githubRepo.CloneURL,
 				Auth: &gitHttp.BasicAuth{
 					Username: "fakeUsername", // yes, this can be anything except an empty string
@@ -238,18 +273,18 @@ func cloneGithubRepo(githubRepo *github.Repository) (*Repo, error) {
 				},
 			})
 		} else {
-			repo, err = git.PlainClone(fmt.Sprintf("%s/%s", ownerDir, *githubRepo.Name), false, &git.CloneOptions{
+			repo, err = plainClone(fmt.Sprintf("%s/%s", ownerDir, *githubRepo.Name), &git.CloneOptions{
 				URL: *githubRepo.CloneURL,
 			})
 		}
 	} else {
-		if config.sshAuth != nil && githubToken == "" {
-			repo, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		if sshAuth := config.sshAuthFor(githubRepo.GetSSHURL()); sshAuth != nil && githubToken == "" {
+			repo, err = memoryClone(&git.CloneOptions{
 				URL:  *githubRepo.SSHURL,
-				Auth: config.sshAuth,
+				Auth: sshAuth,
 			})
 		} else if githubToken != "" {
-			repo, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+			repo, err = memoryClone(&git.CloneOptions{
 				URL: *githubRepo.CloneURL,
 				Auth: &gitHttp.BasicAuth{
 					Username: "fakeUsername", // yes, this can be anything except an empty string
@@ -257,29 +292,71 @@ func cloneGithubRepo(githubRepo *github.Repository) (*Repo, error) {
 				},
 			})
 		} else {
-			repo, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+			repo, err = memoryClone(&git.CloneOptions{
 				URL: *githubRepo.CloneURL,
 			})
 		}
 	}
 	if err != nil {
-		return nil, err
+		return nil, cloneError(err)
 	}
 	return &Repo{
 		repository: repo,
 		name:       *githubRepo.Name,
+		fork:       githubRepo.GetFork(),
 	}, nil
 }
 
-// githubToken returns an oauth2 client for the github api to consume. This token is necessary
-// if you are running audits with --github-user or --github-org
+// githubToken returns an oauth2 client for the github api to consume, or an unauthenticated
+// client if GITHUB_TOKEN is not set. The token is necessary for private repos and raises the
+// rate limit of --github-user and --github-org audits.
 func githubToken() *http.Client {
+	// the token is added below the api cache, which keys responses by it
+	apiClient := &http.Client{Transport: newAPITransport(nil)}
 	githubToken := os.Getenv("GITHUB_TOKEN")
 	if githubToken == "" {
-		return nil
+		return apiClient
 	}
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: githubToken},
 	)
-	return oauth2.NewClient(context.Background(), ts)
+	return oauth2.NewClient(context.WithValue(context.Background(), oauth2.HTTPClient, apiClient), ts)
+}
+
+// newGithubClient returns a github api client. If GITHUB_TOKEN is not set the client is
+// unauthenticated, which is enough for auditing public organizations and users. Either
+// way, requests go through the transport of newAPITransport, whose --api-cache answers
+// listings repeated by later runs with conditional requests.
+func newGithubClient() *github.Client {
+	return newGithubClientFor(opts.GithubURL)
+}
+
+// newGithubClientFor returns a github api client of the api at baseURL, e.g. of
+// GitHub Enterprise
+func newGithubClientFor(baseURL string) *github.Client {
+	httpClient := githubToken()
+	githubClient := github.NewClient(httpClient)
+	if baseURL != "" && baseURL != defaultGithubURL {
+		ghURL, _ := url.Parse(baseURL)
+		githubClient.BaseURL = ghURL
+	}
+	return githubClient
+}
+
+// githubAPIError adds context to errors returned by the github api. Rate limit errors
+// are common when auditing without GITHUB_TOKEN so let the user know when the limit
+// resets and how to raise it.
+func githubAPIError(err error) error {
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		if os.Getenv("GITHUB_TOKEN") == "" {
+			return fmt.Errorf("github rate limit of %d requests exceeded, resets at %s. Set GITHUB_TOKEN to raise the limit",
+				e.Rate.Limit, e.Rate.Reset.Format(time.RFC3339))
+		}
+		return fmt.Errorf("github rate limit of %d requests exceeded, resets at %s",
+			e.Rate.Limit, e.Rate.Reset.Format(time.RFC3339))
+	case *github.AbuseRateLimitError:
+		return fmt.Errorf("github abuse rate limit triggered, retry after %s", e.GetRetryAfter())
+	}
+	return err
 }
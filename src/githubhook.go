@@ -0,0 +1,199 @@
+package gitleaks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// zeroSHA is the before or after of pushes creating or deleting a ref
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// githubHookRepo is the repository of a github webhook event
+type githubHookRepo struct {
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+}
+
+// githubPushEvent is the payload of push events
+type githubPushEvent struct {
+	Before     string         `json:"before"`
+	After      string         `json:"after"`
+	Deleted    bool           `json:"deleted"`
+	Commits    []struct{}     `json:"commits"`
+	Repository githubHookRepo `json:"repository"`
+}
+
+// githubPullRequestEvent is the payload of pull_request events
+type githubPullRequestEvent struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		Head struct {
+			SHA  string         `json:"sha"`
+			Repo githubHookRepo `json:"repo"`
+		} `json:"head"`
+		Base struct {
+			SHA  string         `json:"sha"`
+			Repo githubHookRepo `json:"repo"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+// githubStatusTarget is the commit a scan of a webhook event sets its status on
+type githubStatusTarget struct {
+	// repo is the full name of the repo, owner/name
+	repo string
+	sha  string
+}
+
+// githubWebhook handles POST /github/webhook. Push and pull request events signed with
+// GITHUB_WEBHOOK_SECRET queue a scan of the pushed commits, whose result is set as the
+// gitleaks commit status of the head commit.
+func (s *scanServer) githubWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use POST /github/webhook")
+		return
+	}
+	secret := os.Getenv("GITHUB_WEBHOOK_SECRET")
+	if secret == "" {
+		writeAPIError(w, http.StatusServiceUnavailable, "set GITHUB_WEBHOOK_SECRET to receive github webhooks")
+		return
+	}
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 25<<20))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !validGithubSignature(payload, r.Header.Get("X-Hub-Signature-256"), secret) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid X-Hub-Signature-256")
+		return
+	}
+
+	var (
+		req    scanRequest
+		target statusTarget
+	)
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		w.WriteHeader(http.StatusOK)
+		return
+	case "push":
+		var push githubPushEvent
+		if err := json.Unmarshal(payload, &push); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid push event: %v", err))
+			return
+		}
+		if push.Deleted || push.After == zeroSHA {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		req = scanRequest{RepoURL: push.Repository.CloneURL, CommitTo: push.After}
+		if push.Before != zeroSHA {
+			req.CommitFrom = push.Before
+		} else {
+			// new refs are scanned as deep as the commits pushed with them
+			req.Depth = int64(len(push.Commits))
+			if req.Depth == 0 {
+				req.Depth = 1
+			}
+		}
+		target = &githubStatusTarget{repo: push.Repository.FullName, sha: push.After}
+	case "pull_request":
+		var pr githubPullRequestEvent
+		if err := json.Unmarshal(payload, &pr); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid pull_request event: %v", err))
+			return
+		}
+		if pr.Action != "opened" && pr.Action != "synchronize" && pr.Action != "reopened" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// the head repo is cloned, pull requests of forks are not in the base repo
+		req = scanRequest{
+			RepoURL:    pr.PullRequest.Head.Repo.CloneURL,
+			CommitFrom: pr.PullRequest.Base.SHA,
+			CommitTo:   pr.PullRequest.Head.SHA,
+		}
+		target = &githubStatusTarget{repo: pr.PullRequest.Base.Repo.FullName, sha: pr.PullRequest.Head.SHA}
+	default:
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("unsupported event %q, only push and pull_request events are scanned", event))
+		return
+	}
+	s.queueScan(w, req, target)
+}
+
+// validGithubSignature returns true if signature, the X-Hub-Signature-256 header, is
+// the hmac of payload with secret
+func validGithubSignature(payload []byte, signature, secret string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// setStatus sets the gitleaks commit status of the commit of a scan of a webhook event.
+// Statuses need GITHUB_TOKEN, failures are only logged.
+func (target *githubStatusTarget) setStatus(s *scanServer, sc *scan) {
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		log.Warnf("GITHUB_TOKEN is not set, not setting the status of %s of %s", target.sha, target.repo)
+		return
+	}
+	state, description := githubStatus(sc)
+	status := &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		Context:     github.String("gitleaks"),
+	}
+	if s.sopts.PublicURL != "" {
+		// GET /scan/{id} requires the bearer token, see --public-url
+		status.TargetURL = github.String(strings.TrimSuffix(s.sopts.PublicURL, "/") + "/scan/" + sc.ID)
+	}
+	parts := strings.SplitN(target.repo, "/", 2)
+	if len(parts) != 2 {
+		log.Warnf("invalid github repo %s, not setting the status of %s", target.repo, target.sha)
+		return
+	}
+	client := newGithubClientFor(s.sopts.GithubURL)
+	if _, _, err := client.Repositories.CreateStatus(context.Background(), parts[0], parts[1], target.sha, status); err != nil {
+		log.Warnf("unable to set the status of %s of %s: %v", target.sha, target.repo, githubAPIError(err))
+	}
+}
+
+// githubStatus returns the state and description of the commit status of a scan
+func githubStatus(sc *scan) (string, string) {
+	switch sc.Status {
+	case scanQueued, scanRunning:
+		return "pending", "scanning for secrets"
+	case scanFailed:
+		description := "scan failed: " + sc.Error
+		// descriptions are limited to 140 characters
+		if len(description) > 140 {
+			description = description[:137] + "..."
+		}
+		return "error", description
+	}
+	if sc.Failing != 0 {
+		return "failure", strconv.Itoa(sc.Failing) + " leaks found"
+	}
+	if len(sc.Leaks) != 0 {
+		return "success", strconv.Itoa(len(sc.Leaks)) + " leaks found, none failing"
+	}
+	return "success", "no leaks found"
+}
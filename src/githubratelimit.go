@@ -0,0 +1,85 @@
+package gitleaks
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// githubSleep waits out rate limits of the github api
+var githubSleep = time.Sleep
+
+// githubRetry calls call, a request of the github api doing what, until it does not fail
+// on a rate limit. Rate limits are waited out, up to --github-rate-limit-wait each, so
+// audits resume with the page they were at instead of failing, e.g. unauthenticated
+// audits of large public organizations. Other errors are returned right away.
+func githubRetry(what string, call func() (*github.Response, error)) (*github.Response, error) {
+	// secondary rate limits without Retry-After are retried after a minute, then
+	// waiting twice as long each time, as github recommends
+	backoff := time.Minute
+	for {
+		resp, err := call()
+		if err == nil {
+			return resp, nil
+		}
+		wait, ok := githubRateLimitWait(err, backoff)
+		if !ok || wait > opts.GithubRateLimitWait {
+			return resp, githubAPIError(err)
+		}
+		log.Warnf("github rate limit reached %s, resuming in %s", what, wait.Round(time.Second))
+		githubSleep(wait)
+		backoff *= 2
+	}
+}
+
+// githubRateLimitWait returns how long to wait for the rate limit which err failed on,
+// false if err is not a rate limit. Primary rate limits are waited out until they reset,
+// secondary ones as long as their Retry-After header says, or else for backoff.
+func githubRateLimitWait(err error, backoff time.Duration) (time.Duration, bool) {
+	var resp *http.Response
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		return untilReset(e.Rate.Reset.Time), true
+	case *github.AbuseRateLimitError:
+		if e.RetryAfter != nil {
+			return *e.RetryAfter, true
+		}
+		return backoff, true
+	case *github.ErrorResponse:
+		// secondary rate limits of newer github versions are not recognized by the client
+		resp = e.Response
+		if resp == nil || (resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests) {
+			return 0, false
+		}
+		if !strings.Contains(strings.ToLower(e.Message), "rate limit") && resp.Header.Get("Retry-After") == "" &&
+			resp.StatusCode != http.StatusTooManyRequests {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return untilReset(time.Unix(reset, 0)), true
+		}
+	}
+	return backoff, true
+}
+
+// untilReset returns the time until reset, and a second more for the clock skew between
+// github and the host
+func untilReset(reset time.Time) time.Duration {
+	wait := time.Until(reset)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait + time.Second
+}
@@ -2,14 +2,14 @@ package gitleaks
 
 import (
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"os"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/xanzy/go-gitlab"
 	"gopkg.in/src-d/go-git.v4"
 	gitHttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
-	"gopkg.in/src-d/go-git.v4/storage/memory"
 )
 
 // gitlabPages number of records per request
@@ -20,95 +20,172 @@ const gitlabPages = 100
 // that error is logged.
 func auditGitlabRepos() (int, error) {
 	var (
-		ps      []*gitlab.Project
-		resp    *gitlab.Response
 		tempDir string
 		err     error
 		leaks   []Leak
+		forks   = make(map[string]bool)
 	)
 
-	repos := make([]*gitlab.Project, 0, gitlabPages)
-	page := 1
-	cl := gitlab.NewClient(nil, os.Getenv("GITLAB_TOKEN"))
+	guard, err := newDiscoveryGuard(opts.GitLabOrg + opts.GitLabUser)
+	if err != nil {
+		return NoLeaks, err
+	}
+	cl := gitlab.NewClient(&http.Client{Transport: newAPITransport(nil)}, os.Getenv("GITLAB_TOKEN"))
 
 	// if self hosted GitLab server
 	if url := os.Getenv("GITLAB_URL"); url != "" {
 		cl.SetBaseURL(url)
 	}
 
-	for {
-		if opts.GitLabOrg != "" {
-			opt := &gitlab.ListGroupProjectsOptions{
-				ListOptions: gitlab.ListOptions{
-					PerPage: gitlabPages,
-					Page:    page,
-				},
-			}
-
-			ps, resp, err = cl.Groups.ListGroupProjects(opts.GitLabOrg, opt)
-		} else if opts.GitLabUser != "" {
-			opt := &gitlab.ListProjectsOptions{
-				ListOptions: gitlab.ListOptions{
-					PerPage: gitlabPages,
-					Page:    page,
-				},
-			}
-
-			ps, resp, err = cl.Projects.ListUserProjects(opts.GitLabUser, opt)
+	enumerateTrace := startTrace("enumerate", "").set("owner", opts.GitLabOrg+opts.GitLabUser)
+	ps, err := listGitlabProjects(cl)
+	if err != nil {
+		enumerateTrace.finish()
+		return NoLeaks, err
+	}
+	repos := make([]*gitlab.Project, 0, len(ps))
+	for _, p := range ps {
+		// gitlab calls the topics of projects tags
+		if !inShard(gitlabRepoName(p)) || !inTopics(p.TagList) {
+			continue
 		}
-
-		if err != nil {
-			// exit when can't make API call
-			log.Fatal("error listing projects: ", err)
+		var size int64
+		if p.Statistics != nil {
+			size = p.Statistics.RepositorySize
 		}
-
-		repos = append(repos, ps...)
-
-		if page >= resp.TotalPages {
-			// exit when we've seen all pages
-			break
+		if err = guard.add(size); err != nil {
+			return NoLeaks, err
 		}
-
-		page = resp.NextPage
+		repos = append(repos, p)
 	}
 
-	log.Debugf("found projects: %d", len(repos))
+	enumerateTrace.set("repos", strconv.Itoa(len(repos))).finish()
+	log.Debugf("found projects: %s", guard)
 
 	if opts.Disk {
 		if tempDir, err = createGitlabTempDir(); err != nil {
-			log.Fatal("error creating temp directory: ", err)
+			return NoLeaks, fmt.Errorf("error creating temp directory: %v", err)
 		}
 	}
 
 	for _, p := range repos {
+		if isInterrupted() {
+			break
+		}
 		repo, err := cloneGitlabRepo(tempDir, p)
 		if err != nil {
-			log.Warn(err)
+			skipRepo(err)
 			continue
 		}
 
 		err = repo.audit()
 		if err != nil {
-			log.Warn(err)
+			skipRepo(err)
 			continue
 		}
 
 		if opts.Disk {
-			os.RemoveAll(fmt.Sprintf("%s/%d", tempDir, p.ID))
+			removeClone(fmt.Sprintf("%s/%d", tempDir, p.ID))
 		}
 
 		repo.report()
 		leaks = append(leaks, repo.leaks...)
+		if repo.fork {
+			forks[repo.name] = true
+		}
 	}
 
-	if opts.Report != "" {
+	leaks = dedupForks(leaks, forks)
+	if opts.writesReport() {
 		err = writeReport(leaks)
 		if err != nil {
 			return NoLeaks, err
 		}
 	}
 
-	return len(leaks), nil
+	return failingLeaks(leaks), nil
+}
+
+// listGitlabProjects returns the projects of --gitlab-user, or of --gitlab-org and with
+// --include-subgroups of all of its subgroups. Pages are followed until GitLab stops
+// sending X-Next-Page, as it omits the total count of large listings.
+func listGitlabProjects(cl *gitlab.Client) ([]*gitlab.Project, error) {
+	// sizes are only reported with statistics, which needs at least reporter access
+	var statistics *bool
+	if opts.MaxTotalSize != "" {
+		statistics = gitlab.Bool(true)
+	}
+	var projects []*gitlab.Project
+	if opts.GitLabUser != "" {
+		for page := 1; page != 0; {
+			ps, resp, err := cl.Projects.ListUserProjects(opts.GitLabUser, &gitlab.ListProjectsOptions{
+				ListOptions: gitlab.ListOptions{PerPage: gitlabPages, Page: page},
+				Statistics:  statistics,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error listing projects of %s: %v", opts.GitLabUser, err)
+			}
+			projects = append(projects, ps...)
+			page = resp.NextPage
+		}
+		return projects, nil
+	}
+
+	groups := []interface{}{opts.GitLabOrg}
+	if opts.IncludeSubgroups {
+		subgroups, err := listGitlabSubgroups(cl, opts.GitLabOrg)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, subgroups...)
+	}
+	for _, group := range groups {
+		for page := 1; page != 0; {
+			ps, resp, err := cl.Groups.ListGroupProjects(group, &gitlab.ListGroupProjectsOptions{
+				ListOptions: gitlab.ListOptions{PerPage: gitlabPages, Page: page},
+				Statistics:  statistics,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error listing projects of group %v: %v", group, err)
+			}
+			projects = append(projects, ps...)
+			page = resp.NextPage
+		}
+	}
+	return projects, nil
+}
+
+// listGitlabSubgroups returns the ids of the subgroups of group, recursively
+func listGitlabSubgroups(cl *gitlab.Client, group interface{}) ([]interface{}, error) {
+	var subgroups []interface{}
+	for page := 1; page != 0; {
+		gs, resp, err := cl.Groups.ListSubgroups(group, &gitlab.ListSubgroupsOptions{
+			ListOptions: gitlab.ListOptions{PerPage: gitlabPages, Page: page},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing subgroups of group %v: %v", group, err)
+		}
+		for _, g := range gs {
+			log.Debugf("found subgroup %s", g.FullPath)
+			subgroups = append(subgroups, g.ID)
+			nested, err := listGitlabSubgroups(cl, g.ID)
+			if err != nil {
+				return nil, err
+			}
+			subgroups = append(subgroups, nested...)
+		}
+		page = resp.NextPage
+	}
+	return subgroups, nil
+}
+
+// gitlabRepoName is the name projects are reported by. Projects of subgroups are named
+// by their path, as subgroups may hold projects of the same name.
+func gitlabRepoName(p *gitlab.Project) string {
+	if opts.IncludeSubgroups && p.PathWithNamespace != "" {
+		return p.PathWithNamespace
+	}
+	return p.Name
 }
 
 func createGitlabTempDir() (string, error) {
@@ -117,14 +194,7 @@ func createGitlabTempDir() (string, error) {
 		pathName = opts.GitLabOrg
 	}
 
-	os.RemoveAll(fmt.Sprintf("%s/%s", dir, pathName))
-
-	ownerDir, err := ioutil.TempDir(dir, pathName)
-	if err != nil {
-		return "", err
-	}
-
-	return ownerDir, nil
+	return ownerCloneDir(pathName)
 }
 
 func cloneGitlabRepo(tempDir string, p *gitlab.Project) (*Repo, error) {
@@ -135,23 +205,22 @@ func cloneGitlabRepo(tempDir string, p *gitlab.Project) (*Repo, error) {
 
 	gitLabToken := os.Getenv("GITLAB_TOKEN")
 
+	name := gitlabRepoName(p)
 	if opts.ExcludeForks && p.ForkedFromProject != nil {
-		return nil, fmt.Errorf("skipping %s, excluding forks", p.Name)
+		return nil, fmt.Errorf("skipping %s, %w", name, ErrExcludedFork)
 	}
 
-	for _, re := range config.WhiteList.repos {
-		if re.FindString(p.Name) != "" {
-			return nil, fmt.Errorf("skipping %s, whitelisted", p.Name)
-		}
+	if re := whitelistedRepo(name, p.HTTPURLToRepo, p.SSHURLToRepo, p.WebURL); re != nil {
+		return nil, fmt.Errorf("skipping %s, %w%s", name, ErrWhitelisted, re.describe())
 	}
 
 	opt := &git.CloneOptions{
 		URL: p.HTTPURLToRepo,
 	}
 
-	if config.sshAuth != nil && gitLabToken == "" {
+	if sshAuth := config.sshAuthFor(p.SSHURLToRepo); sshAuth != nil && gitLabToken == "" {
 		opt.URL = p.SSHURLToRepo
-		opt.Auth = config.sshAuth
+		opt.Auth = sshAuth
 	} else if gitLabToken != "" {
 		opt.Auth = &gitHttp.BasicAuth{
 			Username: "fakeUsername", // yes, this can be anything except an empty string
@@ -159,20 +228,23 @@ func cloneGitlabRepo(tempDir string, p *gitlab.Project) (*Repo, error) {
 		}
 	}
 
-	log.Infof("cloning: %s", p.Name)
+	log.Infof("cloning: %s", name)
+	cloneTrace := startTrace("clone", "").set("repo", name)
+	defer cloneTrace.finish()
 
 	if opts.Disk {
-		repo, err = git.PlainClone(fmt.Sprintf("%s/%d", tempDir, p.ID), false, opt)
+		repo, err = plainClone(fmt.Sprintf("%s/%d", tempDir, p.ID), opt)
 	} else {
-		repo, err = git.Clone(memory.NewStorage(), nil, opt)
+		repo, err = memoryClone(opt)
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, cloneError(err)
 	}
 
 	return &Repo{
 		repository: repo,
-		name:       p.Name,
+		name:       name,
+		fork:       p.ForkedFromProject != nil,
 	}, nil
 }
@@ -0,0 +1,61 @@
+package gitleaks
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// headOnlyOptions limits a clone to the tip of the default branch, without history or
+// tags, if --remote-head-only is set
+func headOnlyOptions(options *git.CloneOptions) *git.CloneOptions {
+	if opts.RemoteHeadOnly {
+		options.Depth = 1
+		options.SingleBranch = true
+		options.Tags = git.NoTags
+	}
+	return options
+}
+
+// cloneDepthOptions limits a clone to the latest --clone-depth commits of each branch
+func cloneDepthOptions(options *git.CloneOptions) *git.CloneOptions {
+	if opts.CloneDepth != 0 {
+		options.Depth = opts.CloneDepth
+	}
+	return options
+}
+
+// memoryClone clones a repo into memory, where it is discarded after the audit
+func memoryClone(options *git.CloneOptions) (*git.Repository, error) {
+	return git.Clone(memory.NewStorage(), nil, headOnlyOptions(cloneDepthOptions(options)))
+}
+
+// auditHead audits the files of the tip of the default branch for --remote-head-only.
+// Its parents were not fetched, so every file is audited as it is rather than diffed.
+func (repo *Repo) auditHead() error {
+	head, err := repo.repository.Head()
+	if err != nil {
+		return fmt.Errorf("unable to resolve HEAD of %s: %v", repo.name, err)
+	}
+	c, err := repo.repository.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	log.Debugf("auditing the files of %s at %s", repo.name, headName(head))
+	totalCommits = totalCommits + 1
+	repo.numCommits = 1
+	setProgressRef(headName(head))
+	commitWalked(c.Hash.String())
+	return repo.auditCommitFiles(c)
+}
+
+// headName names the branch HEAD resolved to, or its commit if it is detached
+func headName(head *plumbing.Reference) string {
+	if head.Name().IsBranch() {
+		return head.Name().Short()
+	}
+	return head.Hash().String()
+}
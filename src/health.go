@@ -0,0 +1,84 @@
+package gitleaks
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// checkHealth verifies the repo can be audited completely before its history is walked:
+// the clone is not shallow unless --allow-shallow is set, every ref resolves to an
+// object of the repo and HEAD points to a commit. Odd repo states otherwise surface as
+// confusing errors deep inside the history walk, or as silently incomplete audits.
+func (repo *Repo) checkHealth() error {
+	// repos of --repo-path are named by their path, their name may be "."
+	name := repo.name
+	if repo.path != "" {
+		name = repo.path
+	}
+	if repo.repository == nil {
+		return fmt.Errorf("skipping %s, %w: not opened", name, ErrUnhealthyRepo)
+	}
+	shallow, err := repo.repository.Storer.Shallow()
+	if err != nil {
+		return fmt.Errorf("skipping %s, %w: unable to read shallow commits: %v", name, ErrUnhealthyRepo, err)
+	}
+	// clones of --remote-head-only and --clone-depth are shallow on purpose
+	if len(shallow) != 0 && !opts.RemoteHeadOnly && opts.CloneDepth == 0 {
+		if !opts.AllowShallow {
+			return fmt.Errorf("skipping %s, %w: shallow clone with %d grafted commits, history before them is missing. Fetch with --unshallow or audit anyway with --allow-shallow", name, ErrUnhealthyRepo, len(shallow))
+		}
+		log.Warnf("%s is a shallow clone, history before %d grafted commits is not audited", name, len(shallow))
+	}
+
+	refs, err := repo.repository.Storer.IterReferences()
+	if err != nil {
+		return fmt.Errorf("skipping %s, %w: unable to list refs: %v", name, ErrUnhealthyRepo, err)
+	}
+	numRefs := 0
+	// refs of CI tags and changes often point to the same objects, each is looked up once
+	found := make(map[plumbing.Hash]bool)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() == plumbing.HEAD {
+			return nil
+		}
+		numRefs++
+		resolved := ref
+		if ref.Type() != plumbing.HashReference {
+			// looking up refs reads all packed refs, only symbolic refs are resolved
+			var err error
+			if resolved, err = storer.ResolveReference(repo.repository.Storer, ref.Name()); err != nil {
+				return fmt.Errorf("ref %s does not resolve: %v", ref.Name(), err)
+			}
+		}
+		if found[resolved.Hash()] {
+			return nil
+		}
+		if _, err := repo.repository.Storer.EncodedObject(plumbing.AnyObject, resolved.Hash()); err != nil {
+			return fmt.Errorf("ref %s points to missing object %s", ref.Name(), resolved.Hash())
+		}
+		found[resolved.Hash()] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("skipping %s, %w: %v", name, ErrUnhealthyRepo, err)
+	}
+
+	head, err := repo.repository.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return fmt.Errorf("skipping %s, %w: HEAD is missing", name, ErrUnhealthyRepo)
+	}
+	resolved, err := storer.ResolveReference(repo.repository.Storer, plumbing.HEAD)
+	if err != nil {
+		if numRefs == 0 {
+			return fmt.Errorf("skipping %s, %w", name, ErrEmptyRepo)
+		}
+		return fmt.Errorf("skipping %s, %w: HEAD points to %s, which does not exist", name, ErrUnhealthyRepo, head.Target())
+	}
+	if _, err := repo.repository.CommitObject(resolved.Hash()); err != nil {
+		return fmt.Errorf("skipping %s, %w: HEAD %s is not a commit of the repo", name, ErrUnhealthyRepo, resolved.Hash())
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package gitleaks
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+// hookMarker identifies hooks written by gitleaks install-hook, which may be overwritten
+const hookMarker = "# installed by gitleaks install-hook"
+
+// InstallHookOptions are the options of gitleaks install-hook
+type InstallHookOptions struct {
+	Hook      string `long:"hook" default:"pre-commit" choice:"pre-commit" choice:"pre-push" description:"hook to install. pre-commit audits the staged changes, pre-push the pushed commits"`
+	Global    bool   `long:"global" description:"install the hook into the global hooks directory, core.hooksPath of ~/.gitconfig, for every repo of the user. The hook runs the hook of the same name in .git/hooks of each repo, which git no longer runs with core.hooksPath set"`
+	HooksPath string `long:"hooks-path" description:"with --global, set core.hooksPath of ~/.gitconfig to this directory if it is not set. Example: ~/.git-hooks"`
+	Force     bool   `long:"force" description:"overwrite an existing hook which was not installed by gitleaks"`
+}
+
+// InstallHook is the entry point for gitleaks install-hook. It writes a hook which
+// audits changes with gitleaks and blocks the commit or push when leaks are found.
+func InstallHook(args []string) error {
+	var hopts InstallHookOptions
+	parser := flags.NewParser(&hopts, flags.Default&^flags.PrintErrors)
+	parser.Usage = "install-hook [OPTIONS]"
+	if _, err := parser.ParseArgs(args); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	var (
+		hooksDir string
+		err      error
+	)
+	if hopts.HooksPath != "" && !hopts.Global {
+		return fmt.Errorf("--hooks-path sets the global hooks directory, it requires --global")
+	}
+	if hopts.Global {
+		hooksDir, err = globalHooksDir(hopts.HooksPath)
+	} else {
+		var wd string
+		if wd, err = os.Getwd(); err == nil {
+			hooksDir, err = repoHooksDir(wd)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	hookPath := filepath.Join(hooksDir, hopts.Hook)
+	if err := writeHook(hookPath, hookScript(hopts.Hook, gitleaksPath(), hopts.Global), hopts.Force); err != nil {
+		return err
+	}
+	log.Infof("installed %s hook %s", hopts.Hook, hookPath)
+	if hopts.Global {
+		log.Warnf("git runs the hooks of %s instead of those in .git/hooks of every repo. The %s hook of gitleaks runs the %s hook of .git/hooks before its audit, other hooks of .git/hooks no longer run", hooksDir, hopts.Hook, hopts.Hook)
+	}
+	return nil
+}
+
+// writeHook writes script to hookPath. Hooks not written by gitleaks are only replaced
+// with force.
+func writeHook(hookPath, script string, force bool) error {
+	if existing, err := ioutil.ReadFile(hookPath); err == nil && !force && !strings.Contains(string(existing), hookMarker) {
+		return fmt.Errorf("%s exists and was not installed by gitleaks, rerun with --force to replace it", hookPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(hookPath), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(hookPath, []byte(script), 0755); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of existing files
+	return os.Chmod(hookPath, 0755)
+}
+
+// hookScript returns the script of hook, running the gitleaks binary at gitleaks. Leaks
+// block the commit or push. Errors of gitleaks are reported but do not block, so a
+// broken install does not stop all work. Global hooks first run the hook of the repo in
+// its .git/hooks, which git skips with core.hooksPath set.
+func hookScript(hook, gitleaks string, global bool) string {
+	var audit string
+	switch hook {
+	case "pre-push":
+		audit = `zero=0000000000000000000000000000000000000000
+status=0
+while read -r local_ref local_sha remote_ref remote_sha; do
+	if [ -z "$local_sha" ] || [ "$local_sha" = "$zero" ]; then
+		# no refs, or a deleted ref
+		continue
+	fi
+	if [ "$remote_sha" = "$zero" ]; then
+		"$GITLEAKS" --repo-path . --commit-to "$local_sha"
+	else
+		"$GITLEAKS" --repo-path . --commit-from "$remote_sha" --commit-to "$local_sha"
+	fi
+	code=$?
+	if [ $code -ne 0 ]; then
+		status=$code
+	fi
+done <<EOF
+$refs
+EOF
+`
+	default:
+		audit = `"$GITLEAKS" --repo-path . --staged
+status=$?
+`
+	}
+	// the refs pushed are read from stdin once, for the hook of the repo and the audit
+	stdin, runRepoHook := "", `"$repo_hook" "$@"`
+	if hook == "pre-push" {
+		stdin = "refs=$(cat)\n"
+		runRepoHook = `printf '%s\n' "$refs" | ` + runRepoHook
+	}
+	chain := ""
+	if global {
+		chain = `repo_hook="$(git rev-parse --git-common-dir)/hooks/` + hook + `"
+if [ -x "$repo_hook" ]; then
+	` + runRepoHook + ` || exit $?
+fi
+`
+	}
+	return fmt.Sprintf(`#!/bin/sh
+%s
+# Set GITLEAKS to the gitleaks binary to run, or skip this hook with --no-verify.
+
+GITLEAKS="${GITLEAKS:-%s}"
+%s%s%sif [ $status -eq %d ]; then
+	echo "gitleaks: leaks detected, %s blocked. Remove the secrets, or whitelist them if they are not secrets." >&2
+	exit 1
+elif [ $status -ne 0 ]; then
+	echo "gitleaks: audit failed with exit code $status, %s not blocked" >&2
+fi
+exit 0
+`, hookMarker, gitleaks, stdin, chain, audit, LeakExit, hookAction(hook), hookAction(hook))
+}
+
+func hookAction(hook string) string {
+	if hook == "pre-push" {
+		return "push"
+	}
+	return "commit"
+}
+
+// gitleaksPath returns the path of the running gitleaks binary, or else gitleaks so the
+// hook finds it on the PATH
+func gitleaksPath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "gitleaks"
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe
+}
+
+// repoHooksDir returns the hooks directory of the repo containing dir, its
+// core.hooksPath or else the hooks directory of its git dir
+func repoHooksDir(dir string) (string, error) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			gitDir := dotGit
+			if !info.IsDir() {
+				// worktrees and submodules point to their git dir
+				if gitDir, err = readGitDirFile(dotGit); err != nil {
+					return "", err
+				}
+			}
+			if hooksPath := gitConfigValue(filepath.Join(gitDir, "config"), "core", "hookspath"); hooksPath != "" {
+				if !filepath.IsAbs(hooksPath) {
+					hooksPath = filepath.Join(dir, hooksPath)
+				}
+				return hooksPath, nil
+			}
+			return filepath.Join(gitDir, "hooks"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("not in a git repository, run install-hook from a repo or with --global")
+		}
+		dir = parent
+	}
+}
+
+// readGitDirFile returns the git dir of a .git file, like those of worktrees
+func readGitDirFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	content := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(content, "gitdir: ") {
+		return "", fmt.Errorf("%s does not point to a git dir", path)
+	}
+	gitDir := strings.TrimPrefix(content, "gitdir: ")
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	// the hooks of a worktree are those of its main repo
+	if common, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		gitDir = commonDir
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+// globalHooksDir returns core.hooksPath of ~/.gitconfig. If it is not set, it is set to
+// hooksPath, appending a [core] section so the rest of the file is left untouched. It is
+// never set implicitly, as git then ignores the .git/hooks of every repo.
+func globalHooksDir(hooksPath string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	expand := func(p string) string {
+		if strings.HasPrefix(p, "~/") {
+			return filepath.Join(home, p[2:])
+		}
+		return p
+	}
+	gitconfig := filepath.Join(home, ".gitconfig")
+	if current := gitConfigValue(gitconfig, "core", "hookspath"); current != "" {
+		if hooksPath != "" && filepath.Clean(expand(hooksPath)) != filepath.Clean(expand(current)) {
+			return "", fmt.Errorf("core.hooksPath of %s is %s already, rerun without --hooks-path to install the hook there", gitconfig, current)
+		}
+		return expand(current), nil
+	}
+	if hooksPath == "" {
+		return "", fmt.Errorf("core.hooksPath of %s is not set. Setting it makes git ignore .git/hooks of every repo, rerun with --hooks-path to set it, e.g. --hooks-path=~/.git-hooks", gitconfig)
+	}
+	hooksPath, err = filepath.Abs(expand(hooksPath))
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(gitconfig, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "\n[core]\n\thooksPath = %s\n", hooksPath); err != nil {
+		return "", err
+	}
+	log.Warnf("set core.hooksPath of %s to %s", gitconfig, hooksPath)
+	return hooksPath, nil
+}
+
+// gitConfigValue returns the last value of key in section of the git config at path,
+// or "" if it is not set. Section and key are matched case insensitively.
+func gitConfigValue(path, section, key string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var (
+		value   string
+		current string
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			current = strings.ToLower(strings.Trim(line, "[] "))
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if current != section || len(parts) != 2 || strings.ToLower(strings.TrimSpace(parts[0])) != key {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	}
+	return value
+}
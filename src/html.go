@@ -0,0 +1,134 @@
+package gitleaks
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// htmlLeak is a leak of an html report
+type htmlLeak struct {
+	Leak
+	CommitURL string
+	FileURL   string
+	// LineBefore and LineAfter surround the offender in the line, so it can be masked
+	LineBefore string
+	LineAfter  string
+	Masked     bool
+}
+
+// htmlRule groups the leaks of a rule in an html report
+type htmlRule struct {
+	Rule     string
+	RuleID   string
+	Severity string
+	Leaks    []htmlLeak
+}
+
+// writeHTMLReport writes leaks to w as a standalone html page, grouped by rule. Secrets
+// are masked until the reviewer reveals them.
+func writeHTMLReport(w io.Writer, leaks []Leak) error {
+	byRule := make(map[string]*htmlRule)
+	var rules []*htmlRule
+	for _, leak := range leaks {
+		rule, ok := byRule[leak.Rule]
+		if !ok {
+			rule = &htmlRule{Rule: leak.Rule, RuleID: leak.RuleID, Severity: leak.Severity}
+			byRule[leak.Rule] = rule
+			rules = append(rules, rule)
+		}
+		rule.Leaks = append(rule.Leaks, newHTMLLeak(leak))
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if len(rules[i].Leaks) != len(rules[j].Leaks) {
+			return len(rules[i].Leaks) > len(rules[j].Leaks)
+		}
+		return rules[i].Rule < rules[j].Rule
+	})
+	var suppressed []htmlLeak
+	for _, leak := range suppressedLeaks {
+		suppressed = append(suppressed, newHTMLLeak(leak))
+	}
+
+	return htmlReport.Execute(w, struct {
+		RunID       string
+		Generated   string
+		Total       int
+		Rules       []*htmlRule
+		Suppressed  []htmlLeak
+		ExtraFields map[string]string
+	}{
+		RunID:       runID,
+		Generated:   time.Now().Format(time.RFC3339),
+		Total:       len(leaks),
+		Rules:       rules,
+		Suppressed:  suppressed,
+		ExtraFields: extraFields(),
+	})
+}
+
+func newHTMLLeak(leak Leak) htmlLeak {
+	l := htmlLeak{Leak: leak, LineBefore: leak.Line}
+	// truncated offenders are masked up to their ellipsis
+	offender := strings.TrimSuffix(leak.Offender, ellipsis)
+	if i := strings.Index(leak.Line, offender); offender != "" && i != -1 {
+		l.LineBefore, l.LineAfter = leak.Line[:i], leak.Line[i+len(offender):]
+		l.Masked = true
+	}
+	mutex.Lock()
+	remoteURL := repoRemoteURLs[leak.Repo]
+	mutex.Unlock()
+	if remoteURL != "" && leak.Commit != "" && leak.Commit != "N/A" {
+		l.CommitURL = commitLink(remoteURL, leak.Commit)
+		l.FileURL = fileLink(remoteURL, leak.Commit, leak.File)
+	}
+	return l
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>gitleaks report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292e; }
+h2 { border-bottom: 1px solid #e1e4e8; padding-bottom: .3em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; font-size: 14px; }
+th, td { border: 1px solid #e1e4e8; padding: 6px 10px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+code { font-family: SFMono-Regular, Consolas, monospace; word-break: break-all; }
+.severity { font-size: 12px; padding: 2px 6px; border-radius: 3px; background: #e1e4e8; }
+.redacted .secret { color: transparent; background: #24292e; border-radius: 2px; }
+</style>
+</head>
+<body class="redacted">
+<h1>gitleaks report</h1>
+<p>{{.Total}} leaks, run {{.RunID}}, generated {{.Generated}}</p>
+{{if .ExtraFields}}<p>{{range $name, $value := .ExtraFields}}{{$name}}: {{$value}} {{end}}</p>{{end}}
+<p><label><input type="checkbox" onchange="document.body.classList.toggle('redacted', !this.checked)"> Show secrets</label></p>
+{{range .Rules}}
+<h2>{{.Rule}} {{if .Severity}}<span class="severity">{{.Severity}}</span>{{end}} ({{len .Leaks}}){{if .RuleID}} <small><code>{{.RuleID}}</code></small>{{end}}</h2>
+{{template "leaks" .Leaks}}
+{{end}}
+{{if .Suppressed}}
+<h2>Suppressed by whitelists ({{len .Suppressed}})</h2>
+{{template "leaks" .Suppressed}}
+{{end}}
+</body>
+</html>
+{{define "leaks"}}<table>
+<tr><th>Repo</th><th>File</th><th>Commit</th><th>Author</th><th>Date</th><th>Line</th><th>Secret</th>{{if (index . 0).SuppressedBy}}<th>Suppressed by</th>{{end}}</tr>
+{{range .}}<tr id="{{.Fingerprint}}">
+<td>{{.Repo}}{{if .AlsoPresentIn}}<br><small>also in {{range $i, $r := .AlsoPresentIn}}{{if $i}}, {{end}}{{$r}}{{end}}</small>{{end}}</td>
+<td>{{if .FileURL}}<a href="{{.FileURL}}"><code>{{.File}}</code></a>{{else}}<code>{{.File}}</code>{{end}}</td>
+<td>{{if .CommitURL}}<a href="{{.CommitURL}}"><code>{{.Commit}}</code></a>{{else}}<code>{{.Commit}}</code>{{end}}<br><small>{{.Message}}</small>{{if .Refs}}<br><small>on {{range $i, $r := .Refs}}{{if $i}}, {{end}}{{$r}}{{end}}</small>{{end}}</td>
+<td>{{.Author}}<br><small>{{.Email}}</small></td>
+<td>{{.Date.Format "2006-01-02"}}</td>
+<td><code>{{.LineBefore}}{{if .Masked}}<span class="secret">{{.Offender}}</span>{{.LineAfter}}{{end}}</code></td>
+<td><code class="secret">{{.Offender}}</code></td>
+{{if .SuppressedBy}}<td>{{.SuppressedBy}}</td>{{end}}
+</tr>
+{{end}}</table>{{end}}
+`))
@@ -0,0 +1,318 @@
+package gitleaks
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hako/durafmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// imageFileMaxSize is the size of the largest file of an image layer which is audited.
+// Larger files are mostly binaries and archives.
+const imageFileMaxSize = 10 << 20
+
+// imageLayer is a layer of a container image. open returns the layer as a tar, which
+// may be gzip compressed.
+type imageLayer struct {
+	digest string
+	open   func() (io.ReadCloser, error)
+}
+
+// ociManifest is an image manifest, in the OCI or the Docker v2 format
+type ociManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+	// Manifests are set for indexes, which list the manifests of an image per platform
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+// auditImage audits the files of every layer of --image, either a tarball written by
+// docker save or in the OCI layout, or the reference of an image in a registry. Leaks
+// are reported with "N/A" as the commit and the digest of their layer. Files deleted by
+// later layers are audited too, as they are still part of the image.
+func auditImage() ([]Leak, error) {
+	var (
+		layers []imageLayer
+		err    error
+		start  = time.Now()
+	)
+	repo := &Repo{name: opts.Image}
+	repo.startSpan()
+	setProgressRef("layers of " + opts.Image)
+	if info, statErr := os.Stat(opts.Image); statErr == nil && !info.IsDir() {
+		repo.name = path.Base(opts.Image)
+		layers, err = tarballLayers(opts.Image)
+	} else {
+		layers, err = registryLayers(opts.Image)
+	}
+	if err != nil {
+		repo.trace.finish()
+		repo.trace = nil
+		return nil, fmt.Errorf("unable to read image %s: %w", opts.Image, err)
+	}
+
+	for _, layer := range layers {
+		if err := repo.auditLayer(layer); err != nil {
+			log.Warnf("unable to audit layer %s of %s: %v", layer.digest, opts.Image, err)
+			degrade()
+		}
+	}
+	repo.trace.finish()
+	repo.trace = nil
+
+	if opts.CountOnly {
+		repoReported(repo)
+		reportCounts(repo.name)
+		return nil, nil
+	}
+	repo.leaks = filterBaseline(repo.leaks)
+	repoReported(repo)
+	duration := durafmt.Parse(time.Now().Sub(start)).String()
+	if len(repo.leaks) != 0 {
+		log.Warnf("%d leaks detected. %d layers (%s) inspected in %s", len(repo.leaks), len(layers), formatSize(repo.Stats().Bytes), duration)
+	} else {
+		log.Infof("No leaks detected. %d layers (%s) inspected in %s", len(layers), formatSize(repo.Stats().Bytes), duration)
+	}
+	return repo.leaks, nil
+}
+
+// auditLayer audits the text files of layer
+func (repo *Repo) auditLayer(layer imageLayer) error {
+	log.Debugf("auditing layer %s", layer.digest)
+	rc, err := layer.open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	r, err := decompressLayer(rc)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if strings.HasPrefix(path.Base(hdr.Name), ".wh.") {
+			// whiteout of a file deleted by this layer
+			continue
+		}
+		if hdr.Size > imageFileMaxSize {
+			log.Debugf("skipping %s of layer %s, larger than %s", hdr.Name, layer.digest, formatSize(imageFileMaxSize))
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(content, 0) != -1 {
+			// binary file
+			continue
+		}
+		repo.auditContent(&Commit{
+			repoName:  repo.name,
+			filePath:  strings.TrimPrefix(path.Clean("/"+hdr.Name), "/"),
+			content:   string(content),
+			sha:       "N/A",
+			startLine: 1,
+			layer:     layer.digest,
+		})
+	}
+}
+
+// decompressLayer returns the tar of a layer, which is gunzipped if needed
+func decompressLayer(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return gzip.NewReader(br)
+	case len(magic) == 4 && bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, fmt.Errorf("zstd compressed layers are not supported")
+	}
+	return br, nil
+}
+
+// tarballLayers returns the layers of the image tarball at tarPath. Both the format of
+// docker save and the OCI image layout are read.
+func tarballLayers(tarPath string) ([]imageLayer, error) {
+	files, err := readTarFiles(tarPath, map[string]bool{"manifest.json": true, "index.json": true})
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := files["index.json"]; ok {
+		return ociLayoutLayers(tarPath, b)
+	}
+	b, ok := files["manifest.json"]
+	if !ok {
+		return nil, fmt.Errorf("%s is neither a docker save tarball nor an OCI image layout", tarPath)
+	}
+
+	// docker save: layers are tars named in manifest.json, the config lists their digests
+	var manifests []struct {
+		Config string
+		Layers []string
+	}
+	if err := json.Unmarshal(b, &manifests); err != nil {
+		return nil, fmt.Errorf("invalid manifest.json: %v", err)
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("manifest.json lists no images")
+	}
+	manifest := manifests[0]
+	files, err = readTarFiles(tarPath, map[string]bool{manifest.Config: true})
+	if err != nil {
+		return nil, err
+	}
+	var imageConfig struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	json.Unmarshal(files[manifest.Config], &imageConfig)
+	var layers []imageLayer
+	for i, name := range manifest.Layers {
+		digest := name
+		if i < len(imageConfig.RootFS.DiffIDs) {
+			digest = imageConfig.RootFS.DiffIDs[i]
+		}
+		layers = append(layers, imageLayer{digest: digest, open: tarFileOpener(tarPath, name)})
+	}
+	return layers, nil
+}
+
+// ociLayoutLayers returns the layers of the image of an OCI image layout with the
+// index index
+func ociLayoutLayers(tarPath string, index []byte) ([]imageLayer, error) {
+	var manifest ociManifest
+	for depth := 0; ; depth++ {
+		if err := json.Unmarshal(index, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid image index: %v", err)
+		}
+		if len(manifest.Manifests) == 0 {
+			break
+		}
+		if depth == 3 {
+			return nil, fmt.Errorf("image indexes are nested too deep")
+		}
+		blob := ociBlobPath(selectManifest(manifest.Manifests).Digest)
+		files, err := readTarFiles(tarPath, map[string]bool{blob: true})
+		if err != nil {
+			return nil, err
+		}
+		if index = files[blob]; index == nil {
+			return nil, fmt.Errorf("image layout is missing %s", blob)
+		}
+		manifest = ociManifest{}
+	}
+	var layers []imageLayer
+	for _, layer := range manifest.Layers {
+		layers = append(layers, imageLayer{digest: layer.Digest, open: tarFileOpener(tarPath, ociBlobPath(layer.Digest))})
+	}
+	return layers, nil
+}
+
+// selectManifest returns the manifest of an index for the linux/amd64 platform, or
+// else the first one
+func selectManifest(manifests []ociDescriptor) ociDescriptor {
+	for _, m := range manifests {
+		if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+			return m
+		}
+	}
+	return manifests[0]
+}
+
+// ociBlobPath returns the path of the blob of digest in an OCI image layout
+func ociBlobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// readTarFiles returns the content of the files of the tar at tarPath named in names
+func readTarFiles(tarPath string, names map[string]bool) (map[string][]byte, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	files := make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for len(files) < len(names) {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		name := path.Clean(hdr.Name)
+		if !names[name] {
+			continue
+		}
+		if files[name], err = ioutil.ReadAll(tr); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// tarFileOpener returns a function opening the file name of the tar at tarPath
+func tarFileOpener(tarPath, name string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		f, err := os.Open(tarPath)
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				f.Close()
+				return nil, fmt.Errorf("%s is missing %s", tarPath, name)
+			} else if err != nil {
+				f.Close()
+				return nil, err
+			}
+			if path.Clean(hdr.Name) == name {
+				return struct {
+					io.Reader
+					io.Closer
+				}{tr, f}, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package gitleaks
+
+import (
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// interrupted is set once the audit is interrupted. Audits stop at the next commit and
+	// the leaks found until then are reported.
+	interrupted int32
+	// cloneTempDir is the temporary directory of the --disk clones of the run, if any
+	cloneTempDir string
+)
+
+// watchInterrupt stops the audit gracefully when the process is interrupted, so the
+// report has the leaks found so far and the temporary clones are removed. A second
+// interrupt exits right away, still removing the clones. The returned func stops
+// watching. Scans of Scanners leave the signals to the program embedding gitleaks,
+// they are canceled through their context.
+func watchInterrupt() func() {
+	atomic.StoreInt32(&interrupted, 0)
+	if scanContext != nil {
+		return func() {}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range sigs {
+			if atomic.CompareAndSwapInt32(&interrupted, 0, 1) {
+				log.Warn("interrupted, reporting the leaks found so far, interrupt again to exit without a report")
+				continue
+			}
+			log.Warn("interrupted again, exiting without a report")
+			removeCloneTempDir()
+			os.Exit(ErrExit)
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
+
+// isInterrupted returns whether the audit is interrupted
+func isInterrupted() bool {
+	return atomic.LoadInt32(&interrupted) == 1
+}
+
+// removeCloneTempDir removes the temporary directory of the --disk clones of the run,
+// unless --no-cleanup is set
+func removeCloneTempDir() {
+	if cloneTempDir == "" {
+		return
+	}
+	if opts.NoCleanup {
+		log.Infof("keeping the clones of the audit in %s", cloneTempDir)
+		return
+	}
+	os.RemoveAll(cloneTempDir)
+}
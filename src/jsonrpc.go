@@ -0,0 +1,273 @@
+package gitleaks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+// JSON-RPC 2.0 error codes, see https://www.jsonrpc.org/specification#error_object
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	// rpcScanFailed is the code of scans whose audit fails, e.g. of repos which can not
+	// be cloned
+	rpcScanFailed = -32000
+)
+
+// rpcNullID is the id of responses to requests which can not be parsed
+var rpcNullID = json.RawMessage("null")
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// rpcScanParams are the params of the scan method, gitleaks options as on the command
+// line, e.g. ["--repo-path=.", "--uncommitted"]. They are added to the options
+// gitleaks --jsonrpc is started with, which are shared by every scan.
+type rpcScanParams struct {
+	Args []string `json:"args"`
+}
+
+// rpcLeakParams are the params of leak notifications. ID is the id of the scan request
+// the leak is found by.
+type rpcLeakParams struct {
+	ID   json.RawMessage `json:"id"`
+	Leak Leak            `json:"leak"`
+}
+
+// rpcScanResult is the result of the scan method, once its audit finishes. Leaks is the
+// number of leaks notified by the scan, not counting those suppressed by whitelists,
+// failing those which fail the audit.
+type rpcScanResult struct {
+	RunID   string `json:"run_id"`
+	Leaks   int    `json:"leaks"`
+	Failing int    `json:"failing"`
+}
+
+// rpcServer reads JSON-RPC requests from stdin and writes responses and notifications
+// to stdout. Scans run one at a time, as audits share the state of the package.
+type rpcServer struct {
+	baseArgs []string
+	// audit runs the audit of a scan and returns its failing count, see Run
+	audit func(*Options) (int, error)
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// rpcScan is the scan running, a sink of its report which notifies the leaks written to
+// it. Nil when no scan runs.
+var rpcScan *rpcScanState
+
+type rpcScanState struct {
+	server *rpcServer
+	id     json.RawMessage
+	leaks  int
+}
+
+func (scan *rpcScanState) String() string       { return "json-rpc" }
+func (scan *rpcScanState) reportFormat() string { return "json" }
+
+// writeLeaks notifies the leaks of the report, those left once leaks of forks, of
+// several refs and of the --baseline are deduplicated, and with --show-suppressed those
+// suppressed by whitelists
+func (scan *rpcScanState) writeLeaks(leaks []Leak) error {
+	scan.leaks = len(leaks)
+	for _, leak := range withSuppressed(leaks) {
+		scan.server.write(rpcNotification{JSONRPC: "2.0", Method: "leak", Params: rpcLeakParams{ID: scan.id, Leak: leak}})
+	}
+	return nil
+}
+
+// ServeJSONRPC is the entry point for gitleaks --jsonrpc, with args the command line it
+// is started with. It reads JSON-RPC 2.0 requests from stdin, one per line, until
+// stdin closes or the shutdown method is called. The scan method audits a repo and
+// notifies every leak of its report as a leak notification with the id of the scan,
+// before the response to the scan. This lets editor plugins and tools which are not written in Go
+// drive scans without the api of gitleaks serve. Logs are written to stderr.
+func ServeJSONRPC(args []string, stdin io.Reader, stdout io.Writer) error {
+	log.SetOutput(os.Stderr)
+	cloneProgress = os.Stderr
+	s := &rpcServer{
+		baseArgs: jsonRPCBaseArgs(args),
+		audit:    Run,
+		encoder:  json.NewEncoder(stdout),
+	}
+	return s.serve(stdin)
+}
+
+// jsonRPCBaseArgs returns args without --jsonrpc, the options shared by every scan
+func jsonRPCBaseArgs(args []string) []string {
+	var base []string
+	for _, arg := range args {
+		if arg != "--jsonrpc" {
+			base = append(base, arg)
+		}
+	}
+	return base
+}
+
+func (s *rpcServer) serve(stdin io.Reader) error {
+	reader := bufio.NewReader(stdin)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) != 0 {
+			if s.handle(line) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers the request of line, returning true once the server shuts down
+func (s *rpcServer) handle(line []byte) bool {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			s.respondError(rpcNullID, rpcParseError, fmt.Sprintf("parse error: %v", err))
+		} else {
+			s.respondError(rpcNullID, rpcInvalidRequest, "invalid request, batches are not supported")
+		}
+		return false
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		if req.ID == nil {
+			req.ID = rpcNullID
+		}
+		s.respondError(req.ID, rpcInvalidRequest, `invalid request, must have "jsonrpc": "2.0" and a method`)
+		return false
+	}
+
+	switch req.Method {
+	case "scan":
+		var params rpcScanParams
+		if len(req.Params) != 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				s.respondError(req.ID, rpcInvalidParams, fmt.Sprintf("invalid params: %v", err))
+				return false
+			}
+		}
+		s.scan(req.ID, params)
+	case "version":
+		s.respond(req.ID, version)
+	case "shutdown":
+		s.respond(req.ID, true)
+		return true
+	default:
+		s.respondError(req.ID, rpcMethodNotFound, fmt.Sprintf("no method %s, must be scan, version or shutdown", req.Method))
+	}
+	return false
+}
+
+// scan runs the audit of params, notifying its leaks once it finishes
+func (s *rpcServer) scan(id json.RawMessage, params rpcScanParams) {
+	scanOpts, err := s.scanOptions(params)
+	if err != nil {
+		s.respondError(id, rpcInvalidParams, err.Error())
+		return
+	}
+
+	auditMu.Lock()
+	state := &rpcScanState{server: s, id: id}
+	rpcScan = state
+	failing, err := s.audit(scanOpts)
+	rpcScan = nil
+	auditMu.Unlock()
+	if err != nil {
+		s.respondError(id, rpcScanFailed, err.Error())
+		return
+	}
+	s.respond(id, rpcScanResult{RunID: runID, Leaks: state.leaks, Failing: failing})
+}
+
+// scanOptions returns the options of a scan, those gitleaks --jsonrpc is started with
+// followed by the args of the scan
+func (s *rpcServer) scanOptions(params rpcScanParams) (*Options, error) {
+	args := append(append([]string{}, s.baseArgs...), params.Args...)
+	var scanOpts Options
+	if _, err := flags.NewParser(&scanOpts, flags.None).ParseArgs(args); err != nil {
+		return nil, err
+	}
+	// leaks are notified on stdout, nothing else may be written to it
+	if scanOpts.Verbose {
+		return nil, fmt.Errorf("--verbose can not be used with --jsonrpc, leaks are notified instead")
+	}
+	if scanOpts.CountOnly {
+		return nil, fmt.Errorf("--count-only can not be used with --jsonrpc, leaks are notified instead")
+	}
+	for _, spec := range scanOpts.Sinks {
+		if spec == "stdout" || strings.HasPrefix(spec, "stdout:") {
+			return nil, fmt.Errorf("--sink %s can not be used with --jsonrpc, stdout carries the notifications", spec)
+		}
+	}
+	if err := scanOpts.guard(); err != nil {
+		return nil, err
+	}
+	return &scanOpts, nil
+}
+
+// respond answers a request with its result. Requests without an id are notifications,
+// which are not answered.
+func (s *rpcServer) respond(id json.RawMessage, result interface{}) {
+	if id == nil {
+		return
+	}
+	s.write(rpcResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+// respondError answers a request with an error. Invalid requests, whose id is unknown,
+// are answered with rpcNullID.
+func (s *rpcServer) respondError(id json.RawMessage, code int, message string) {
+	if id == nil {
+		return
+	}
+	s.write(rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}})
+}
+
+// write writes a message to stdout, one per line, locked as leaks are notified by the
+// goroutines of the audit
+func (s *rpcServer) write(v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(v); err != nil {
+		log.Errorf("unable to write json-rpc message: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package gitleaks
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// junitTestSuites is the root of a JUnit XML report
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Failures  []junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// writeJUnitReport writes leaks to w as JUnit XML, so CI servers list them in their
+// test tabs. Every rule is a test case, which fails with one failure per leak.
+func writeJUnitReport(w io.Writer, leaks []Leak) error {
+	var (
+		rules  []string
+		byRule = make(map[string][]junitFailure)
+	)
+	if config != nil {
+		for _, rule := range config.Rules {
+			if _, ok := byRule[rule.Description]; !ok {
+				byRule[rule.Description] = nil
+				rules = append(rules, rule.Description)
+			}
+		}
+	}
+	for _, leak := range leaks {
+		if _, ok := byRule[leak.Rule]; !ok {
+			rules = append(rules, leak.Rule)
+		}
+		byRule[leak.Rule] = append(byRule[leak.Rule], junitFailure{
+			Message:  fmt.Sprintf("%s in %s of %s", leak.Rule, leak.File, leak.Repo),
+			Type:     leak.Severity,
+			Contents: junitLeakDetails(leak),
+		})
+	}
+
+	suite := junitTestSuite{
+		Name:  "gitleaks",
+		Tests: len(rules),
+		Time:  "0",
+	}
+	for _, rule := range rules {
+		if len(byRule[rule]) != 0 {
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			Name:      rule,
+			ClassName: "gitleaks",
+			Failures:  byRule[rule],
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	if err := encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitLeakDetails describes a leak in the body of its failure
+func junitLeakDetails(leak Leak) string {
+	details := []string{
+		"repo: " + leak.Repo,
+		"file: " + leak.File,
+	}
+	if leak.LineNumber != 0 {
+		details[1] += fmt.Sprintf(":%d", leak.LineNumber)
+		if leak.StartColumn != 0 {
+			details[1] += fmt.Sprintf(":%d", leak.StartColumn)
+		}
+	}
+	details = append(details,
+		"commit: "+leak.Commit,
+		"author: "+leak.Author+" <"+leak.Email+">",
+		"line: "+leak.Line,
+		"offender: "+leak.Offender,
+	)
+	if leak.Info != "" {
+		details = append(details, "info: "+leak.Info)
+	}
+	details = append(details,
+		"rule id: "+leak.RuleID,
+		"fingerprint: "+leak.Fingerprint,
+	)
+	return strings.Join(details, "\n")
+}
@@ -0,0 +1,205 @@
+package gitleaks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// lfsOidRe and lfsSizeRe match the lines of a Git LFS pointer file. Only the changed
+// lines of a pointer may be part of a diff, so the version line is not required.
+var (
+	lfsOidRe  = regexp.MustCompile(`(?m)^oid sha256:([0-9a-f]{64})\r?$`)
+	lfsSizeRe = regexp.MustCompile(`(?m)^size (\d+)\r?$`)
+)
+
+// lfsPointerMaxSize is the size of the largest pointer file git lfs writes
+const lfsPointerMaxSize = 1024
+
+// lfsPointer is the object a Git LFS pointer file stands for
+type lfsPointer struct {
+	oid  string
+	size int64
+}
+
+// parseLFSPointer returns the object of the pointer in content, if content is one
+func parseLFSPointer(content string) (lfsPointer, bool) {
+	if len(content) > lfsPointerMaxSize {
+		return lfsPointer{}, false
+	}
+	oid := lfsOidRe.FindStringSubmatch(content)
+	size := lfsSizeRe.FindStringSubmatch(content)
+	if oid == nil || size == nil {
+		return lfsPointer{}, false
+	}
+	n, err := strconv.ParseInt(size[1], 10, 64)
+	if err != nil {
+		return lfsPointer{}, false
+	}
+	return lfsPointer{oid: oid[1], size: n}, true
+}
+
+// inspectLFS inspects the LFS object commit points to if --include-lfs is set and
+// commit is a Git LFS pointer. Leaks in the object are reported with the path of
+// the pointer.
+func (repo *Repo) inspectLFS(commit *Commit) {
+	if !opts.IncludeLFS || repo.repository == nil {
+		return
+	}
+	p, ok := parseLFSPointer(commit.content)
+	if !ok {
+		return
+	}
+	maxSize, _ := parseSize(opts.LFSMaxSize)
+	if p.size > maxSize {
+		log.Debugf("skipping lfs object %s of %s, %s is above --lfs-max-size", p.oid, commit.filePath, formatSize(p.size))
+		return
+	}
+	content, err := repo.lfsObject(p)
+	if err != nil {
+		log.Warnf("unable to fetch lfs object %s of %s: %v", p.oid, commit.filePath, err)
+		degrade()
+		return
+	}
+	if bytes.IndexByte(content, 0) != -1 {
+		// binary object
+		return
+	}
+	object := *commit
+	object.content = string(content)
+	repo.inspect(&object)
+}
+
+// lfsObject returns the content of the LFS object of p, read from the lfs directory of
+// the repo if it was fetched already, or else downloaded from the LFS server of the
+// origin remote.
+func (repo *Repo) lfsObject(p lfsPointer) ([]byte, error) {
+	if storage, ok := repo.repository.Storer.(*filesystem.Storage); ok {
+		objectPath := filepath.Join(storage.Filesystem().Root(), "lfs", "objects", p.oid[0:2], p.oid[2:4], p.oid)
+		if content, err := ioutil.ReadFile(objectPath); err == nil {
+			return content, nil
+		}
+	}
+
+	remote, err := repo.repository.Remote("origin")
+	if err != nil {
+		return nil, err
+	}
+	if len(remote.Config().URLs) == 0 {
+		return nil, fmt.Errorf("origin has no url")
+	}
+	content, err := downloadLFSObject(remote.Config().URLs[0], p)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	if fmt.Sprintf("%x", sum) != p.oid {
+		return nil, fmt.Errorf("lfs object does not match its oid")
+	}
+	return content, nil
+}
+
+// downloadLFSObject downloads the object of p with the basic transfer of the LFS batch
+// API of remoteURL. Credentials in remoteURL or GITHUB_TOKEN are used, if set.
+func downloadLFSObject(remoteURL string, p lfsPointer) ([]byte, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("lfs objects can only be downloaded from http(s) remotes")
+	}
+	user := u.User
+	u.User = nil
+	batchURL := strings.TrimSuffix(u.String(), "/")
+	if !strings.HasSuffix(batchURL, ".git") {
+		batchURL += ".git"
+	}
+	batchURL += "/info/lfs/objects/batch"
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"operation": "download",
+		"transfers": []string{"basic"},
+		"objects":   []map[string]interface{}{{"oid": p.oid, "size": p.size}},
+	})
+	req, err := http.NewRequest("POST", batchURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if password, ok := user.Password(); ok {
+		req.SetBasicAuth(user.Username(), password)
+	} else if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.SetBasicAuth("fakeUsername", token)
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lfs batch request: %s", resp.Status)
+	}
+	var batch struct {
+		Objects []struct {
+			Actions struct {
+				Download struct {
+					Href   string            `json:"href"`
+					Header map[string]string `json:"header"`
+				} `json:"download"`
+			} `json:"actions"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return nil, err
+	}
+	if len(batch.Objects) == 0 {
+		return nil, fmt.Errorf("lfs batch response has no objects")
+	}
+	object := batch.Objects[0]
+	if object.Error != nil {
+		return nil, fmt.Errorf("lfs batch response: %s", object.Error.Message)
+	}
+
+	req, err = http.NewRequest("GET", object.Actions.Download.Href, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range object.Actions.Download.Header {
+		req.Header.Set(k, v)
+	}
+	download, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer download.Body.Close()
+	if download.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lfs download: %s", download.Status)
+	}
+	// read one byte more than the pointer's size to detect oversized objects
+	content, err := ioutil.ReadAll(io.LimitReader(download.Body, p.size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) != p.size {
+		return nil, fmt.Errorf("lfs object is %d bytes, pointer says %d", len(content), p.size)
+	}
+	return content, nil
+}
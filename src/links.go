@@ -0,0 +1,125 @@
+package gitleaks
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// repoRemoteURLs maps the names of the audited repos to the url they were cloned from,
+// used to link the commits and files of leaks in reports
+var repoRemoteURLs = make(map[string]string)
+
+// linkTemplate holds the url templates of commits and files of the hosts matching host.
+// Templates can use {host}, {path} (e.g. owner/name), {owner}, {repo}, {commit} and {file}.
+type linkTemplate struct {
+	host   *regexp.Regexp
+	commit string
+	file   string
+}
+
+// recordRemoteURL remembers the remote url of repo, if it has one hosted on the web
+func (repo *Repo) recordRemoteURL() {
+	for _, u := range repo.remoteURLs() {
+		if _, _, ok := parseRemoteURL(u); ok {
+			mutex.Lock()
+			repoRemoteURLs[repo.name] = u
+			mutex.Unlock()
+			return
+		}
+	}
+}
+
+// parseRemoteURL returns the host and the path of the repo cloned from remoteURL, e.g.
+// github.com and owner/name for git@github.com:owner/name.git. ok is false if
+// remoteURL is not an http(s) or ssh url.
+func parseRemoteURL(remoteURL string) (host string, path string, ok bool) {
+	if i := strings.Index(remoteURL, ":"); i != -1 && !strings.Contains(remoteURL[:i], "/") && !strings.Contains(remoteURL, "://") {
+		// scp-like ssh url, e.g. git@github.com:owner/name.git
+		remoteURL = "ssh://" + remoteURL[:i] + "/" + strings.TrimPrefix(remoteURL[i+1:], "/")
+	}
+	u, err := url.Parse(remoteURL)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		host = u.Host
+	case "ssh":
+		host = u.Hostname()
+	default:
+		return "", "", false
+	}
+	return host, strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), true
+}
+
+// webURL returns the page of the repo cloned from cloneURL, e.g. https://github.com/owner/name
+// for git@github.com:owner/name.git, or "" if cloneURL is not an http(s) or ssh url.
+func webURL(cloneURL string) string {
+	host, path, ok := parseRemoteURL(cloneURL)
+	if !ok {
+		return ""
+	}
+	scheme := "https"
+	if strings.HasPrefix(cloneURL, "http://") {
+		scheme = "http"
+	}
+	return scheme + "://" + host + "/" + path
+}
+
+// commitLink returns the url of commit in the repo cloned from remoteURL. The first
+// [[links]] template matching the host of remoteURL is used, or else the commit page
+// of GitHub, GitLab, Gitea, Bitbucket and Azure DevOps.
+func commitLink(remoteURL, commit string) string {
+	if t := findLinkTemplate(remoteURL); t != nil {
+		return expandLink(t.commit, remoteURL, commit, "")
+	}
+	return webURL(remoteURL) + "/commit/" + commit
+}
+
+// fileLink returns the url of file at commit in the repo cloned from remoteURL, like
+// commitLink.
+func fileLink(remoteURL, commit, file string) string {
+	if t := findLinkTemplate(remoteURL); t != nil {
+		return expandLink(t.file, remoteURL, commit, file)
+	}
+	web := webURL(remoteURL)
+	if strings.Contains(web, "/_git/") {
+		// azure devops
+		return web + "?path=" + url.QueryEscape("/"+file) + "&version=GC" + commit
+	}
+	return web + "/blob/" + commit + "/" + (&url.URL{Path: file}).EscapedPath()
+}
+
+func findLinkTemplate(remoteURL string) *linkTemplate {
+	if config == nil {
+		return nil
+	}
+	host, _, _ := parseRemoteURL(remoteURL)
+	for _, t := range config.links {
+		if t.host.MatchString(host) {
+			return t
+		}
+	}
+	return nil
+}
+
+// expandLink fills in the placeholders of template. An empty template yields no link.
+func expandLink(template, remoteURL, commit, file string) string {
+	if template == "" {
+		return ""
+	}
+	host, path, _ := parseRemoteURL(remoteURL)
+	owner, repo := "", path
+	if i := strings.LastIndex(path, "/"); i != -1 {
+		owner, repo = path[:i], path[i+1:]
+	}
+	return strings.NewReplacer(
+		"{host}", host,
+		"{path}", path,
+		"{owner}", owner,
+		"{repo}", repo,
+		"{commit}", commit,
+		"{file}", (&url.URL{Path: file}).EscapedPath(),
+	).Replace(template)
+}
@@ -0,0 +1,62 @@
+package gitleaks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	log "github.com/sirupsen/logrus"
+)
+
+// localAllowFile is the name of a developer's personal whitelist in the info directory
+// of a git dir, next to info/exclude. It is never committed, so false positives can be
+// suppressed without touching the shared config.
+const localAllowFile = "gitleaks-allow"
+
+// withLocalWhitelist returns a copy of the config extended with the [whitelist] of
+// the info/gitleaks-allow file of the on-disk repo at repoPath. The config itself is
+// returned if the repo has no such file.
+func (config *Config) withLocalWhitelist(repoPath string) (*Config, error) {
+	var tomlConfig TomlConfig
+	dir := gitDir(repoPath)
+	if dir == "" {
+		return config, nil
+	}
+	allowPath := filepath.Join(dir, "info", localAllowFile)
+	if _, err := os.Stat(allowPath); err != nil {
+		return config, nil
+	}
+	if _, err := toml.DecodeFile(allowPath, &tomlConfig); err != nil {
+		return nil, fmt.Errorf("problem loading %s: %v", allowPath, err)
+	}
+	if len(tomlConfig.Rules) != 0 {
+		log.Warnf("ignoring rules in %s, only whitelists are read from it", allowPath)
+		degrade()
+		tomlConfig.Rules = nil
+	}
+	tomlConfig.Links = nil
+
+	local := *config
+	local.WhiteList.commits = make(map[string]*whitelistEntry)
+	for commit, entry := range config.WhiteList.commits {
+		local.WhiteList.commits[commit] = entry
+	}
+	local.WhiteList.fingerprints = make(map[string]*whitelistEntry)
+	for fingerprint, entry := range config.WhiteList.fingerprints {
+		local.WhiteList.fingerprints[fingerprint] = entry
+	}
+	// full slice expressions so appending never writes to the shared config
+	local.Rules = local.Rules[:len(local.Rules):len(local.Rules)]
+	local.FileRules = local.FileRules[:len(local.FileRules):len(local.FileRules)]
+	local.WhiteList.regexes = local.WhiteList.regexes[:len(local.WhiteList.regexes):len(local.WhiteList.regexes)]
+	local.WhiteList.files = local.WhiteList.files[:len(local.WhiteList.files):len(local.WhiteList.files)]
+	local.WhiteList.repos = local.WhiteList.repos[:len(local.WhiteList.repos):len(local.WhiteList.repos)]
+	local.WhiteList.authors = local.WhiteList.authors[:len(local.WhiteList.authors):len(local.WhiteList.authors)]
+	local.WhiteList.messages = local.WhiteList.messages[:len(local.WhiteList.messages):len(local.WhiteList.messages)]
+	if err := local.update(tomlConfig); err != nil {
+		return nil, fmt.Errorf("problem loading %s: %v", allowPath, err)
+	}
+	log.Infof("loaded local whitelist %s", allowPath)
+	return &local, nil
+}
@@ -0,0 +1,347 @@
+package gitleaks
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+	"github.com/zricethezav/gitleaks/src/detect"
+)
+
+// LSPOptions are the options of gitleaks lsp
+type LSPOptions struct {
+	ConfigPath string `long:"config" description:"path to the gitleaks config, defaults to the .gitleaks.toml of the workspace, then GITLEAKS_CONFIG, then the default config"`
+	Log        string `short:"l" long:"log" default:"warn" description:"log level, logs are written to stderr"`
+}
+
+// language server protocol codes, see
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/
+const (
+	lspServerNotInitialized = -32002
+	// lspSyncFull asks clients to send the whole text of documents on every change
+	lspSyncFull = 1
+
+	lspSeverityError       = 1
+	lspSeverityWarning     = 2
+	lspSeverityInformation = 3
+)
+
+// lspPosition is a position in a document. Characters are counted in UTF-16 code units,
+// as the protocol requires.
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// lspDiagnostic is a leak in a document, shown by editors as it is typed
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspPublishDiagnostics struct {
+	URI         string          `json:"uri"`
+	Diagnostics []lspDiagnostic `json:"diagnostics"`
+}
+
+// lspDocumentParams are the params of the didOpen, didChange and didClose
+// notifications. Documents are synced in full, so changes carry the whole text.
+type lspDocumentParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type lspInitializeParams struct {
+	RootURI  string `json:"rootUri"`
+	RootPath string `json:"rootPath"`
+}
+
+// lspServer is a language server publishing the leaks of the documents open in an
+// editor as diagnostics, matched by the rules of the gitleaks config as they are typed
+type lspServer struct {
+	lopts LSPOptions
+	// root is the directory of the workspace, paths of documents are relative to it
+	// so the path rules and file whitelists of the config match them as in audits
+	root     string
+	ready    bool
+	shutdown bool
+	w        io.Writer
+}
+
+// LSP is the entry point for gitleaks lsp. It speaks the language server protocol on
+// stdin and stdout, so editor plugins can show secrets as diagnostics of the documents
+// they are typed in, before they are ever saved or committed. Documents are matched
+// with the rules and whitelists of the gitleaks config of the workspace.
+func LSP(args []string) error {
+	var lopts LSPOptions
+	parser := flags.NewParser(&lopts, flags.Default&^flags.PrintErrors)
+	parser.Usage = "lsp [OPTIONS]"
+	if _, err := parser.ParseArgs(args); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	(&Options{Log: lopts.Log}).setLogs()
+	// stdout carries the protocol
+	log.SetOutput(os.Stderr)
+	if lopts.ConfigPath != "" {
+		if _, err := os.Stat(lopts.ConfigPath); err != nil {
+			return fmt.Errorf("no gitleaks config at %s", lopts.ConfigPath)
+		}
+	}
+	return (&lspServer{lopts: lopts, w: os.Stdout}).serve(os.Stdin)
+}
+
+// serve answers the messages of r until the exit notification or the end of r
+func (s *lspServer) serve(r io.Reader) error {
+	reader := textproto.NewReader(bufio.NewReader(r))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to read lsp message: %v", err)
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil || length < 0 {
+			return fmt.Errorf("lsp message without a valid Content-Length")
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			return fmt.Errorf("unable to read lsp message: %v", err)
+		}
+		if exit := s.handle(body); exit {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+	}
+}
+
+// handle answers the message of body, returning true on the exit notification
+func (s *lspServer) handle(body []byte) bool {
+	var req rpcRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.respondError(rpcNullID, rpcParseError, fmt.Sprintf("parse error: %v", err))
+		return false
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params lspInitializeParams
+		json.Unmarshal(req.Params, &params)
+		if err := s.initialize(params); err != nil {
+			s.respondError(req.ID, rpcInternalError, err.Error())
+			return false
+		}
+		s.respond(req.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{"openClose": true, "change": lspSyncFull},
+			},
+			"serverInfo": map[string]string{"name": "gitleaks", "version": version},
+		})
+		return false
+	case "shutdown":
+		s.shutdown = true
+		s.respond(req.ID, json.RawMessage("null"))
+		return false
+	case "exit":
+		return true
+	}
+
+	if !s.ready {
+		// requests before initialize fail, notifications are dropped
+		s.respondError(req.ID, lspServerNotInitialized, "server not initialized")
+		return false
+	}
+	var params lspDocumentParams
+	switch req.Method {
+	case "initialized", "textDocument/didSave":
+	case "textDocument/didOpen":
+		json.Unmarshal(req.Params, &params)
+		s.publish(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		json.Unmarshal(req.Params, &params)
+		if n := len(params.ContentChanges); n != 0 {
+			s.publish(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+	case "textDocument/didClose":
+		json.Unmarshal(req.Params, &params)
+		s.notify("textDocument/publishDiagnostics", lspPublishDiagnostics{URI: params.TextDocument.URI, Diagnostics: []lspDiagnostic{}})
+	default:
+		// unknown notifications, like $/cancelRequest, are dropped
+		s.respondError(req.ID, rpcMethodNotFound, fmt.Sprintf("no method %s", req.Method))
+	}
+	return false
+}
+
+// initialize loads the gitleaks config of the workspace
+func (s *lspServer) initialize(params lspInitializeParams) error {
+	s.root = params.RootPath
+	if params.RootURI != "" {
+		s.root = uriPath(params.RootURI)
+	}
+	opts = &Options{ConfigPath: s.lopts.ConfigPath}
+	if opts.ConfigPath == "" && s.root != "" {
+		if _, err := os.Stat(filepath.Join(s.root, ".gitleaks.toml")); err == nil {
+			opts.ConfigPath = filepath.Join(s.root, ".gitleaks.toml")
+		}
+	}
+	c, err := newConfig()
+	if err != nil {
+		return err
+	}
+	config = c
+	s.ready = true
+	log.Infof("language server ready for %s with %d rules", s.root, len(config.Rules))
+	return nil
+}
+
+// publish publishes the diagnostics of the document of uri
+func (s *lspServer) publish(uri, text string) {
+	s.notify("textDocument/publishDiagnostics", lspPublishDiagnostics{URI: uri, Diagnostics: s.diagnostics(uri, text)})
+}
+
+// diagnostics returns a diagnostic for each finding of the rules in text, the content of
+// the document of uri, unless its file is whitelisted
+func (s *lspServer) diagnostics(uri, text string) []lspDiagnostic {
+	diagnostics := []lspDiagnostic{}
+	filePath := uriPath(uri)
+	if s.root != "" {
+		if rel, err := filepath.Rel(s.root, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+			filePath = filepath.ToSlash(rel)
+		}
+	}
+	if re := whitelistedFile(filePath); re != nil {
+		log.Debugf("skipping whitelisted file (matched regex '%s'%s): %s", re.String(), re.describe(), filePath)
+		return diagnostics
+	}
+
+	findings := config.detector.Detect(detect.Fragment{Content: text, FilePath: filePath, StartLine: 1})
+	lines := strings.Split(text, "\n")
+	for _, finding := range findings {
+		line := finding.LineNumber - 1
+		if line < 0 || line >= len(lines) {
+			continue
+		}
+		// a finding without columns spans its line
+		r := lspRange{Start: lspPosition{Line: line}, End: lspPosition{Line: line, Character: utf16Len(lines[line])}}
+		if runes := []rune(lines[line]); finding.StartColumn != 0 && finding.StartColumn <= len(runes) {
+			start := utf16Len(string(runes[:finding.StartColumn-1]))
+			r = lspRange{
+				Start: lspPosition{Line: line, Character: start},
+				End:   lspPosition{Line: line, Character: start + utf16Len(finding.Offender)},
+			}
+		}
+		code := finding.Rule.ID
+		if code == "" {
+			code = ruleID(finding.Rule.Description)
+		}
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range:    r,
+			Severity: lspSeverity(finding.Rule.Severity),
+			Code:     code,
+			Source:   "gitleaks",
+			Message:  fmt.Sprintf("%s detected, remove the secret before committing it", finding.Rule.Description),
+		})
+	}
+	return diagnostics
+}
+
+// lspSeverity returns the diagnostic severity of a rule severity. Rules without a
+// severity are warnings.
+func lspSeverity(severity string) int {
+	switch strings.ToLower(severity) {
+	case "critical", "high":
+		return lspSeverityError
+	case "low":
+		return lspSeverityInformation
+	}
+	return lspSeverityWarning
+}
+
+// windowsDriveRe matches the path of a file uri on windows, e.g. /c:/src
+var windowsDriveRe = regexp.MustCompile(`^/[A-Za-z]:`)
+
+// uriPath returns the path of a file uri, or uri itself if it is not a file uri, like
+// the untitled: uris of unsaved documents
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	if windowsDriveRe.MatchString(u.Path) {
+		return filepath.FromSlash(u.Path[1:])
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// respond answers a request with its result
+func (s *lspServer) respond(id json.RawMessage, result interface{}) {
+	if id == nil {
+		return
+	}
+	s.write(rpcResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+// respondError answers a request with an error, notifications are not answered
+func (s *lspServer) respondError(id json.RawMessage, code int, message string) {
+	if id == nil {
+		return
+	}
+	s.write(rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}})
+}
+
+func (s *lspServer) notify(method string, params interface{}) {
+	s.write(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// write writes a message with the Content-Length header of the protocol
+func (s *lspServer) write(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("unable to write lsp message: %v", err)
+		return
+	}
+	if _, err := fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(b), b); err != nil {
+		log.Errorf("unable to write lsp message: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package gitleaks
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// leakFingerprint identifies a leak independently of the audit which found it. Jobs
+// of a --ref-shard audit report the same leak when their refs share commits, the
+// fingerprint lets --merge-reports count it once.
+func leakFingerprint(leak Leak) string {
+	h := sha256.New()
+	for _, field := range []string{leak.Repo, leak.Commit, leak.File, leak.Rule, leak.Offender, leak.Line} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// readReport reads the leaks and suppressed leaks of a json report written by gitleaks.
+// Suppressed leaks are those with suppressedBy, reported with --show-suppressed.
+func readReport(reportPath string) ([]Leak, []Leak, error) {
+	var all, leaks, suppressed []Leak
+	b, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = json.Unmarshal(b, &all); err != nil {
+		return nil, nil, fmt.Errorf("unable to read report %s: %v", reportPath, err)
+	}
+	for _, leak := range all {
+		if leak.SuppressedBy != "" {
+			suppressed = append(suppressed, leak)
+		} else {
+			leaks = append(leaks, leak)
+		}
+	}
+	return leaks, suppressed, nil
+}
+
+// mergeReports merges the json reports listed in --merge-reports into --report, keeping
+// a single copy of leaks found by more than one report.
+func mergeReports() (int, error) {
+	var (
+		leaks []Leak
+		seen  = make(map[string]bool)
+	)
+	for _, reportPath := range strings.Split(opts.MergeReports, ",") {
+		reportPath = strings.TrimSpace(reportPath)
+		if reportPath == "" {
+			continue
+		}
+		reportLeaks, suppressed, err := readReport(reportPath)
+		if err != nil {
+			return NoLeaks, err
+		}
+		for _, leak := range reportLeaks {
+			fingerprint := leakFingerprint(leak)
+			if seen[fingerprint] {
+				continue
+			}
+			seen[fingerprint] = true
+			leak.Date, leak.CommitDate = reportTime(leak.Date), reportTime(leak.CommitDate)
+			leaks = append(leaks, leak)
+		}
+		for _, leak := range suppressed {
+			fingerprint := leakFingerprint(leak)
+			if seen[fingerprint] {
+				continue
+			}
+			seen[fingerprint] = true
+			suppressedLeaks = append(suppressedLeaks, leak)
+		}
+		log.Infof("merged %s, %d leaks", reportPath, len(reportLeaks))
+	}
+	if len(suppressedLeaks) != 0 {
+		opts.ShowSuppressed = true
+	}
+	return failingLeaks(leaks), writeReport(leaks)
+}
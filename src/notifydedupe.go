@@ -0,0 +1,144 @@
+package gitleaks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// notifyDedupeConfig is the dedupe window of the [notify] section of the config
+type notifyDedupeConfig struct {
+	// window is how long a leak which is still present is not notified again
+	window time.Duration
+	// state is the file recording when the present leaks were notified, across runs
+	state string
+}
+
+// notifyState is the content of the state file of the dedupe window: when each leak of
+// a repo was last notified, by repo and fingerprint. Leaks of a repo missing from its
+// latest audit are resolved and dropped.
+type notifyState struct {
+	Repos map[string]map[string]time.Time `json:"repos"`
+}
+
+// notifyStateMutex serializes the updates of the state file by concurrent repo audits
+var notifyStateMutex sync.Mutex
+
+// newNotifyDedupeConfig validates the dedupe window of the [notify] section of a config
+func newNotifyDedupeConfig(tomlConfig TomlConfig) (notifyDedupeConfig, error) {
+	var cfg notifyDedupeConfig
+	if tomlConfig.Notify.DedupeWindow == "" {
+		return cfg, nil
+	}
+	window, err := time.ParseDuration(tomlConfig.Notify.DedupeWindow)
+	if err != nil || window <= 0 {
+		return cfg, fmt.Errorf("invalid dedupeWindow of [notify], must be a positive duration like 168h")
+	}
+	if tomlConfig.Notify.State == "" {
+		return cfg, fmt.Errorf("dedupeWindow of [notify] needs a state file to remember notified leaks in")
+	}
+	cfg.window, cfg.state = window, os.ExpandEnv(tomlConfig.Notify.State)
+	return cfg, nil
+}
+
+// notifyLeaks sends the leaks of a repo to the webhook and slack. With a dedupe window,
+// leaks notified within the window which are still present are left out, so nightly
+// audits do not alert on the same unresolved leak every night. Leaks which were
+// resolved, absent from an audit of their repo, are notified again when they return.
+func notifyLeaks(repoName string, leaks []Leak) {
+	if opts.CountOnly || config == nil || config.notifyDedupe.window == 0 {
+		notifyWebhook(repoName, leaks)
+		notifySlack(repoName, leaks)
+		return
+	}
+	notifyStateMutex.Lock()
+	defer notifyStateMutex.Unlock()
+	state, err := readNotifyState(config.notifyDedupe.state)
+	if err != nil {
+		log.Warnf("unable to read the notification state %s, notifying all leaks of %s: %v", config.notifyDedupe.state, repoName, err)
+		degrade()
+		notifyWebhook(repoName, leaks)
+		notifySlack(repoName, leaks)
+		return
+	}
+
+	now := time.Now()
+	notified := state.Repos[repoName]
+	present := make(map[string]time.Time)
+	var pending []Leak
+	for _, leak := range leaks {
+		if at, ok := notified[leak.Fingerprint]; ok && now.Sub(at) < config.notifyDedupe.window {
+			present[leak.Fingerprint] = at
+			continue
+		}
+		present[leak.Fingerprint] = now
+		pending = append(pending, leak)
+	}
+	if len(pending) != len(leaks) {
+		log.Infof("not notifying %d leaks of %s again, notified within the last %s", len(leaks)-len(pending), repoName, config.notifyDedupe.window)
+	}
+
+	// leaks are remembered only once they were delivered, failed ones are retried the next run
+	delivered := notifyWebhook(repoName, pending)
+	delivered = notifySlack(repoName, pending) && delivered
+	if !delivered {
+		return
+	}
+	if len(present) == 0 {
+		delete(state.Repos, repoName)
+	} else {
+		state.Repos[repoName] = present
+	}
+	if err := writeNotifyState(config.notifyDedupe.state, state); err != nil {
+		log.Warnf("unable to write the notification state %s: %v", config.notifyDedupe.state, err)
+		degrade()
+	}
+}
+
+// readNotifyState reads the state file at path. A missing file is an empty state.
+func readNotifyState(path string) (*notifyState, error) {
+	state := &notifyState{}
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, state); err != nil {
+			return nil, err
+		}
+	}
+	if state.Repos == nil {
+		state.Repos = make(map[string]map[string]time.Time)
+	}
+	return state, nil
+}
+
+// writeNotifyState replaces the state file at path, through a temporary file so it is
+// never left half written
+func writeNotifyState(path string, state *notifyState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -24,36 +24,132 @@ type Options struct {
 	GithubURL  string `long:"github-url" default:"https://api.github.com/" description:"GitHub API Base URL, use for GitHub Enterprise. Example: https://github.example.com/api/v3/"`
 	GithubPR   string `long:"github-pr" description:"Github PR url to audit. This does not clone the repo. GITHUB_TOKEN must be set"`
 
-	GitLabUser string `long:"gitlab-user" description:"GitLab user ID to audit"`
-	GitLabOrg  string `long:"gitlab-org" description:"GitLab group ID to audit"`
+	GitLabUser       string `long:"gitlab-user" description:"GitLab user ID to audit"`
+	GitLabOrg        string `long:"gitlab-org" description:"GitLab group ID to audit"`
+	GitLabGroup      string `long:"gitlab-group" description:"GitLab group ID or path to audit, same as --gitlab-org"`
+	IncludeSubgroups bool   `long:"include-subgroups" description:"also audit the projects of all subgroups of --gitlab-org, recursively"`
 
 	AzdevOrg string `long:"azdev-org" description:"Azure DevOps organization to audit"`
+	AzdevSSH bool   `long:"azdev-ssh" description:"clone the repos of --azdev-org over ssh with the key of --ssh-key or [[auth.ssh]], e.g. when AZURE_DEVOPS_TOKEN is scoped to the api"`
+
+	BitbucketUser string `long:"bitbucket-user" description:"Bitbucket user to audit"`
+	BitbucketOrg  string `long:"bitbucket-org" description:"Bitbucket workspace, or project key on Bitbucket Server, to audit"`
+
+	GiteaURL  string `long:"gitea-url" description:"Gitea or Forgejo url. Example: https://gitea.example.com"`
+	GiteaUser string `long:"gitea-user" description:"Gitea user to audit"`
+	GiteaOrg  string `long:"gitea-org" description:"Gitea organization to audit"`
 
 	CommitStop string `long:"commit-stop" description:"sha of commit to stop at"`
 	Commit     string `long:"commit" description:"sha of commit to audit"`
 	Depth      int64  `long:"depth" description:"maximum commit depth"`
+	CommitFrom string `long:"commit-from" description:"only audit commits after this commit, e.g. the base of a pull request"`
+	CommitTo   string `long:"commit-to" description:"only audit commits up to and including this commit. Defaults to HEAD"`
+	Commits    string `long:"commits" description:"range of commits to audit, like git log. Example: A..B"`
 
 	// local target option
-	RepoPath  string `long:"repo-path" description:"Path to repo"`
-	OwnerPath string `long:"owner-path" description:"Path to owner directory (repos discovered)"`
+	RepoPath    string `long:"repo-path" description:"Path to repo, a working tree or a bare or mirror clone"`
+	OwnerPath   string `long:"owner-path" description:"Path to owner directory (repos discovered)"`
+	Path        string `long:"path" description:"Path to a plain directory to audit, no git history required"`
+	Uncommitted bool   `long:"uncommitted" description:"Only audit staged and unstaged changes of --repo-path, e.g. from a pre-commit hook"`
+	Staged      bool   `long:"staged" description:"Only audit staged changes of --repo-path, e.g. from a pre-commit hook"`
+	Stdin       bool   `long:"stdin" description:"Audit text read from stdin. Of unified diffs, e.g. from git diff, only added lines are audited"`
+	StdinName   string `long:"stdin-name" default:"stdin" description:"file name of the text read by --stdin, if it is not a diff"`
+	Bundle      string `long:"bundle" description:"Audit the history of a git bundle, e.g. of git bundle create repo.bundle --all"`
+	Image       string `long:"image" description:"Audit the layers of a container image, a tarball from docker save or an OCI layout, or a reference pulled from its registry"`
 
 	// Process options
-	Threads      int    `long:"threads" description:"Maximum number of threads gitleaks spawns"`
-	Disk         bool   `long:"disk" description:"Clones repo(s) to disk"`
-	ConfigPath   string `long:"config" description:"path to gitleaks config"`
-	SSHKey       string `long:"ssh-key" description:"path to ssh key"`
-	ExcludeForks bool   `long:"exclude-forks" description:"exclude forks for organization/user audits"`
-	RepoConfig   bool   `long:"repo-config" description:"Load config from target repo. Config file must be \".gitleaks.toml\""`
-	Branch       string `long:"branch" description:"Branch to audit"`
+	Threads            int    `long:"threads" description:"Maximum number of threads gitleaks spawns"`
+	Disk               bool   `long:"disk" description:"Clones repo(s) to disk"`
+	KeepClones         string `long:"keep-clones" description:"Clones repo(s) to this directory, at <host>/<owner>/<name>, and keeps them after the audit. Implies --disk"`
+	NoCleanup          bool   `long:"no-cleanup" description:"Keeps the temporary directory of the clones after the audit, or when it is interrupted, for debugging. Implies --disk"`
+	ReferenceDir       string `long:"reference-dir" description:"Directory of local mirrors used as alternates when cloning. Implies --disk"`
+	Dissociate         bool   `long:"dissociate" description:"Copy objects borrowed from --reference-dir mirrors into the clone"`
+	ConfigPath         string `long:"config" description:"path to gitleaks config"`
+	SSHKey             string `long:"ssh-key" description:"path to ssh key, for hosts without a key of [[auth.ssh]] of the config"`
+	ExcludeForks       bool   `long:"exclude-forks" description:"exclude forks for organization/user audits"`
+	MaxRepos           int    `long:"max-repos" description:"fail if an organization/user audit discovers more than this many repos"`
+	MaxTotalSize       string `long:"max-total-size" description:"fail if the repos discovered by an organization/user audit exceed this total size. Example: 20GB"`
+	Shard              string `long:"shard" description:"only audit shard i of n of the discovered repos, selected by a hash of the repo name. Example: 3/10"`
+	RefShard           string `long:"ref-shard" description:"only audit commits reachable from shard i of n of the refs of a repo. Combine the reports with --merge-reports. Example: 3/10"`
+	Strict             bool   `long:"strict" description:"fail the run on warnings which leave the audit incomplete, like skipped rules or repos which could not be audited"`
+	RepoConfig         bool   `long:"repo-config" description:"Load config from target repo. Config file must be \".gitleaks.toml\""`
+	Branch             string `long:"branch" description:"Branch to audit"`
+	IncludeReflog      bool   `long:"include-reflog" description:"Also audit commits only reachable from the reflog. Requires --repo-path or --owner-path"`
+	IncludeUnreachable bool   `long:"include-unreachable" description:"Also audit commits and blobs not reachable from any ref, like git fsck --lost-found"`
+	CloneDepth         int    `long:"clone-depth" description:"Only fetch and audit the latest N commits of each branch of remote repos. Much cheaper for repos with long histories"`
+	RemoteHeadOnly     bool   `long:"remote-head-only" description:"Only fetch and audit the files of the tip of the default branch of remote repos, without history. Much cheaper for sweeps of the current state of many repos"`
+	DedupeRefs         bool   `long:"dedupe-refs" description:"Report a secret added to the same blob once, e.g. when merged or cherry-picked into several branches, and list the branches and tags containing it"`
+	AllowShallow       bool   `long:"allow-shallow" description:"Audit shallow clones, e.g. CI checkouts, instead of skipping them. History before the shallow commits is not audited"`
+	IncludeLFS         bool   `long:"include-lfs" description:"Also audit the objects of Git LFS pointer files, read from the repo or downloaded from the LFS server of origin"`
+	LFSMaxSize         string `long:"lfs-max-size" default:"10MB" description:"maximum size of the LFS objects audited with --include-lfs"`
+	ScanArchives       bool   `long:"scan-archives" description:"Also audit the files of zip, jar, tar and gzip archives, reported as <archive>!<file>, up to 50MB per file and 200MB for all the files of an archive"`
+	MaxArchiveDepth    int    `long:"max-archive-depth" default:"2" description:"maximum depth of nested archives audited with --scan-archives"`
 	// TODO: IncludeMessages  string `long:"messages" description:"include commit messages in audit"`
 
+	// Caching of the responses of provider apis between runs
+	APICache    string        `long:"api-cache" description:"directory to cache the responses of the github, gitlab, bitbucket and gitea apis in between runs, so repeated organization/user audits do not list unchanged repos again"`
+	APICacheTTL time.Duration `long:"api-cache-ttl" default:"1h" description:"age up to which --api-cache responses are used without asking the api, older ones are revalidated with their ETag"`
+
 	// Output options
-	Log          string `short:"l" long:"log" description:"log level"`
-	Verbose      bool   `short:"v" long:"verbose" description:"Show verbose output from gitleaks audit"`
-	Report       string `long:"report" description:"path to write report file. Needs to be csv or json"`
-	Redact       bool   `long:"redact" description:"redact secrets from log messages and report"`
-	Version      bool   `long:"version" description:"version number"`
-	SampleConfig bool   `long:"sample-config" description:"prints a sample config file"`
+	Log            string `short:"l" long:"log" description:"log level"`
+	OTLPEndpoint   string `long:"otlp-endpoint" description:"OTLP/HTTP url to export traces to, defaults to OTEL_EXPORTER_OTLP_ENDPOINT. Example: http://localhost:4318/v1/traces"`
+	Verbose        bool   `short:"v" long:"verbose" description:"Show verbose output from gitleaks audit"`
+	Context        int    `long:"context" description:"report this many lines before and after the line of each leak, as far as they were audited with it, e.g. the lines its commit added"`
+	Report         string `long:"report" description:"path to write report file. Needs to be csv, json or html. csv columns are set by --csv-columns"`
+	ReportFormat   string `long:"report-format" description:"format of --report, one of json, csv, html, junit or ndjson. ndjson streams leaks as they are found. Defaults to the extension of --report"`
+	ReportTemplate string `long:"report-template" description:"Go text/template rendering the leaks into --report, e.g. a markdown summary. Helpers: groupBy, redact, join and truncate"`
+	CSVColumns     string `long:"csv-columns" description:"comma separated columns of csv reports, e.g. commit,file,rule,offender. Defaults to all columns"`
+	CSVNoLine      bool   `long:"csv-no-line" description:"leave the line of leaks out of csv reports"`
+	EntropyReport  string `long:"entropy-report" description:"path to write a histogram of the entropy of the candidate secrets of each rule to, e.g. to choose entropy thresholds. Candidates are not reported as leaks"`
+	Timezone       string `long:"timezone" default:"UTC" description:"timezone of the dates in reports. Example: Europe/Berlin or Local"`
+	Redact         bool   `long:"redact" description:"redact secrets from log messages and report"`
+	Mask           string `long:"mask" default:"full" description:"how --redact masks secrets, full replaces them with REDACTED, partial keeps their first and last 4 characters to tell which key leaked, e.g. AKIA************MPLE, hash replaces them with their sha256 to correlate them with credential inventories. partial and hash imply --redact"`
+	HashKey        string `long:"hash-key" description:"file of the key of --mask=hash, which then reports the hmac-sha256 of secrets, so hashes of short secrets can not be brute forced without the key"`
+	CountOnly      bool   `long:"count-only" description:"only count matches per repo and rule, e.g. to size an estate. --report is written as a csv of counts"`
+	FailOn         string `long:"fail-on" description:"only exit with the leak exit code for leaks of rules at or above this severity, or without one. Example: high"`
+	Baseline       string `long:"baseline" description:"json report of known leaks. Leaks in it are not reported again"`
+	Verify         bool   `long:"verify" description:"check with their providers whether secrets are live, like aws keys with sts GetCallerIdentity or slack tokens with auth.test, and report them as verified true or false. Sends the secrets to their providers, github tokens only to github.com or the --github-url of the host of their repo"`
+	RevokedFeed    string `long:"revoked-feed" description:"file or url listing the sha256 of revoked secrets, one per line, or a json report of rotated leaks written with --mask=hash. Leaks of these secrets are reported as revoked, so they are not investigated again"`
+	MergeReports   string `long:"merge-reports" description:"comma separated list of json reports, e.g. from --ref-shard jobs, to merge into --report without duplicate leaks"`
+	ShowSuppressed bool   `long:"show-suppressed" description:"report matches suppressed by whitelists, marked with the whitelist suppressing them in suppressedBy"`
+	Policy         string `long:"policy" description:"rego policy deciding which leaks fail the audit. Leaks fail it through deny messages of package gitleaks"`
+	Attest         string `long:"attest" description:"path to write a signed in-toto attestation of the audit to, e.g. for supply chain policies requiring a passed secret scan"`
+	AttestKey      string `long:"attest-key" description:"PEM encoded ed25519 or ecdsa private key signing --attest"`
+	WebhookURL     string `long:"webhook-url" description:"url to post the new leaks of each audited repo to as json, e.g. of SOAR tooling. Overrides the url of [notify.webhook] of the config"`
+	TelemetryURL   string `long:"telemetry-url" description:"opt-in url to post aggregate counts of the run to, like repos audited and leaks per rule. Never sends leaks, repo names or paths"`
+	Version        bool   `long:"version" description:"version number"`
+	SampleConfig   bool   `long:"sample-config" description:"prints a sample config file"`
+
+	// Repos with huge numbers of refs, e.g. Gerrit refs/changes or CI tags
+	MaxRefs    int      `long:"max-refs" default:"50000" description:"skip repos with more refs than this instead of walking them all. Select refs with --exclude-ref, --ref-sample or --ref-shard. 0 walks any number of refs"`
+	ExcludeRef []string `long:"exclude-ref" description:"do not audit commits only reachable from refs matching this glob, or below it if it ends with a slash. Repeatable. Example: refs/changes/ or refs/tags/ci-*"`
+	RefSample  int      `long:"ref-sample" description:"audit the branches and a sample of this many of the other refs of repos, like tags or refs/changes, picked by a hash of their names so runs sample the same refs"`
+
+	// Rate limits of the github api, e.g. of unauthenticated audits of public organizations
+	GithubRateLimitWait time.Duration `long:"github-rate-limit-wait" default:"1h" description:"longest wait for a rate limit of the github api to reset before the audit fails, so audits resume where they stopped. Unauthenticated limits reset hourly. 0 fails right away"`
+
+	// Driving scans from editor plugins and other tools, see ServeJSONRPC
+	JSONRPC bool `long:"jsonrpc" description:"read scan requests from stdin and write the leaks of their reports to stdout as JSON-RPC 2.0 notifications, one message per line. The scan method takes the args of other options, like --repo-path=., added to those gitleaks --jsonrpc is started with"`
+
+	// Destinations of the report besides --report, each in its own format
+	Sinks []string `long:"sink" description:"also write the report to this sink, as kind[:format][=target]. Kinds are stdout, file, webhook, s3 (credentials from the AWS_* environment) and es, indexing leaks into Elasticsearch. Repeatable. Example: stdout:csv, file:junit=gitleaks.xml, s3=bucket/gitleaks/report.json, es=http://localhost:9200/gitleaks"`
+
+	// Safeguards of the runtime and memory of audits, e.g. of lockfiles and minified bundles
+	MaxFileSize       string `long:"max-file-size" description:"skip files larger than this, like lockfiles or vendored bundles, logged with --log=debug. Example: 1MB"`
+	MaxScanLineLength int    `long:"max-scan-line-length" description:"skip lines longer than this many bytes, like those of minified bundles, logged with --log=debug. 0 audits all lines"`
+
+	// Report truncation, e.g. of matches in minified bundles
+	MaxLineLength     int `long:"max-line-length" description:"truncate reported lines longer than this many characters around the offender. The original length is reported. 0 keeps lines whole"`
+	MaxOffenderLength int `long:"max-offender-length" description:"truncate reported offenders longer than this many characters. The original length is reported. 0 keeps offenders whole"`
+
+	// Repo selection of github and gitlab organization/user audits by topics
+	Topic        []string `long:"topic" description:"only audit repos with this topic, or GitLab projects with this tag, in github and gitlab organization/user audits. Repeat to audit repos with any of them. Example: production"`
+	ExcludeTopic []string `long:"exclude-topic" description:"skip repos with this topic, or GitLab projects with this tag, in github and gitlab organization/user audits. Repeatable. Example: sandbox"`
+
+	// hashKey is the key of --hash-key, read by guardMask. It is kept with the options
+	// of each audit rather than in a global, as serve and Scanners guard the options of
+	// their audits concurrently.
+	hashKey []byte
 }
 
 // ParseOpts parses the options
@@ -79,7 +175,7 @@ func ParseOpts() *Options {
 		os.Exit(0)
 	}
 	if opts.SampleConfig {
-		fmt.Println(defaultConfig)
+		fmt.Print(defaultConfig)
 		os.Exit(0)
 	}
 
@@ -102,6 +198,61 @@ func (opts *Options) guard() error {
 		return fmt.Errorf("github user set and local owner path")
 	}
 
+	if opts.GitLabGroup != "" {
+		if opts.GitLabOrg != "" && opts.GitLabOrg != opts.GitLabGroup {
+			return fmt.Errorf("--gitlab-group and --gitlab-org set")
+		}
+		opts.GitLabOrg = opts.GitLabGroup
+	}
+	if opts.GitLabOrg != "" && opts.GitLabUser != "" {
+		return fmt.Errorf("gitlab user and group set")
+	} else if opts.IncludeSubgroups && opts.GitLabOrg == "" {
+		return fmt.Errorf("--include-subgroups requires --gitlab-org or --gitlab-group")
+	}
+	if opts.AzdevSSH && opts.AzdevOrg == "" {
+		return fmt.Errorf("--azdev-ssh requires --azdev-org")
+	}
+	if (len(opts.Topic) != 0 || len(opts.ExcludeTopic) != 0) &&
+		opts.GithubOrg == "" && opts.GithubUser == "" && opts.GitLabOrg == "" && opts.GitLabUser == "" {
+		return fmt.Errorf("--topic and --exclude-topic require a github or gitlab organization/user audit")
+	}
+
+	if opts.BitbucketOrg != "" && opts.BitbucketUser != "" {
+		return fmt.Errorf("bitbucket user and organization set")
+	} else if (opts.BitbucketOrg != "" || opts.BitbucketUser != "") && opts.OwnerPath != "" {
+		return fmt.Errorf("bitbucket user or organization set and local owner path")
+	}
+
+	if opts.GiteaOrg != "" && opts.GiteaUser != "" {
+		return fmt.Errorf("gitea user and organization set")
+	} else if (opts.GiteaOrg != "" || opts.GiteaUser != "") && opts.GiteaURL == "" {
+		return fmt.Errorf("--gitea-user and --gitea-org require --gitea-url")
+	} else if (opts.GiteaOrg != "" || opts.GiteaUser != "") && opts.OwnerPath != "" {
+		return fmt.Errorf("gitea user or organization set and local owner path")
+	}
+
+	if opts.Path != "" && (opts.Repo != "" || opts.RepoPath != "" || opts.OwnerPath != "") {
+		return fmt.Errorf("--path can not be combined with --repo, --repo-path or --owner-path")
+	}
+
+	if opts.Stdin && (opts.Repo != "" || opts.RepoPath != "" || opts.OwnerPath != "" || opts.Path != "") {
+		return fmt.Errorf("--stdin can not be combined with --repo, --repo-path, --owner-path or --path")
+	}
+
+	if opts.Bundle != "" && (opts.Repo != "" || opts.RepoPath != "" || opts.OwnerPath != "" || opts.Path != "" || opts.Stdin) {
+		return fmt.Errorf("--bundle can not be combined with --repo, --repo-path, --owner-path, --path or --stdin")
+	}
+
+	if opts.Image != "" && (opts.Repo != "" || opts.RepoPath != "" || opts.OwnerPath != "" || opts.Path != "" || opts.Stdin) {
+		return fmt.Errorf("--image can not be combined with --repo, --repo-path, --owner-path, --path or --stdin")
+	}
+
+	if (opts.Uncommitted || opts.Staged) && opts.RepoPath == "" {
+		return fmt.Errorf("--uncommitted and --staged require --repo-path")
+	} else if opts.Uncommitted && opts.Staged {
+		return fmt.Errorf("--uncommitted and --staged can not be combined")
+	}
+
 	if opts.Threads > runtime.GOMAXPROCS(0) {
 		return fmt.Errorf("%d available threads", runtime.GOMAXPROCS(0))
 	}
@@ -127,9 +278,218 @@ func (opts *Options) guard() error {
 		}
 	}
 
+	if opts.MaxTotalSize != "" {
+		if _, err := parseSize(opts.MaxTotalSize); err != nil {
+			return err
+		}
+	}
+
+	if opts.IncludeLFS {
+		if _, err := parseSize(opts.LFSMaxSize); err != nil {
+			return err
+		}
+	}
+
+	if opts.MaxFileSize != "" {
+		if _, err := parseSize(opts.MaxFileSize); err != nil {
+			return err
+		}
+	}
+	if opts.Context < 0 {
+		return fmt.Errorf("--context can not be negative")
+	}
+	if opts.MaxScanLineLength < 0 {
+		return fmt.Errorf("--max-scan-line-length can not be negative")
+	}
+
+	if opts.ScanArchives && opts.MaxArchiveDepth < 1 {
+		return fmt.Errorf("--max-archive-depth must be at least 1")
+	}
+
+	if opts.Shard != "" {
+		if _, err := parseShard(opts.Shard); err != nil {
+			return err
+		}
+	}
+
+	if opts.RefShard != "" {
+		if _, err := parseShard(opts.RefShard); err != nil {
+			return err
+		}
+		if opts.Branch != "" || opts.Commit != "" {
+			return fmt.Errorf("--ref-shard can not be combined with --branch or --commit")
+		}
+	}
+
+	if opts.Commits != "" {
+		if opts.CommitFrom != "" || opts.CommitTo != "" {
+			return fmt.Errorf("--commits can not be combined with --commit-from or --commit-to")
+		}
+		from, to, err := parseCommitRange(opts.Commits)
+		if err != nil {
+			return err
+		}
+		opts.CommitFrom, opts.CommitTo = from, to
+	}
+	if (opts.CommitFrom != "" || opts.CommitTo != "") && (opts.Commit != "" || opts.Branch != "" || opts.RefShard != "") {
+		return fmt.Errorf("commit ranges can not be combined with --commit, --branch or --ref-shard")
+	}
+	if opts.MaxRefs < 0 || opts.RefSample < 0 {
+		return fmt.Errorf("--max-refs and --ref-sample can not be negative")
+	}
+	if (len(opts.ExcludeRef) != 0 || opts.RefSample != 0) && (opts.Commit != "" || opts.Branch != "" || opts.CommitFrom != "" || opts.CommitTo != "") {
+		return fmt.Errorf("--exclude-ref and --ref-sample select refs, they can not be combined with --commit, --branch or commit ranges")
+	}
+
+	if opts.CountOnly && opts.Report != "" && opts.reportFormat() != "csv" {
+		return fmt.Errorf("--count-only writes a .csv --report")
+	}
+
+	if opts.MaxLineLength < 0 || opts.MaxOffenderLength < 0 {
+		return fmt.Errorf("--max-line-length and --max-offender-length can not be negative")
+	}
+
+	if opts.FailOn != "" {
+		if _, err := parseSeverity(opts.FailOn); err != nil {
+			return fmt.Errorf("--fail-on: %v", err)
+		}
+	}
+
+	if opts.Baseline != "" && !strings.HasSuffix(opts.Baseline, ".json") {
+		return fmt.Errorf("--baseline should be a .json report")
+	}
+
+	if opts.MergeReports != "" && !strings.HasSuffix(opts.Report, ".json") {
+		return fmt.Errorf("--merge-reports requires a .json --report")
+	} else if opts.MergeReports != "" && opts.EntropyReport != "" {
+		return fmt.Errorf("--entropy-report needs an audit, --merge-reports only merges reports")
+	}
+
+	if opts.IncludeReflog && opts.RepoPath == "" && opts.OwnerPath == "" {
+		return fmt.Errorf("--include-reflog requires --repo-path or --owner-path")
+	}
+
+	if opts.KeepClones != "" || opts.ReferenceDir != "" || opts.NoCleanup {
+		opts.Disk = true
+	}
+	if err := opts.guardMask(); err != nil {
+		return err
+	}
+	if opts.Dissociate && opts.ReferenceDir == "" {
+		return fmt.Errorf("--dissociate requires --reference-dir")
+	}
+	if opts.ReferenceDir != "" {
+		if info, err := os.Stat(opts.ReferenceDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("reference dir %s does not exist", opts.ReferenceDir)
+		}
+	}
+
+	if opts.Policy != "" {
+		if _, err := os.Stat(opts.Policy); err != nil {
+			return fmt.Errorf("--policy %s does not exist", opts.Policy)
+		}
+		if opts.CountOnly || opts.ReportFormat == "ndjson" {
+			return fmt.Errorf("--policy needs the leaks of the audit, which --count-only and --report-format ndjson do not keep")
+		}
+	}
+
+	if opts.RemoteHeadOnly {
+		if opts.RepoPath != "" || opts.OwnerPath != "" || opts.Path != "" || opts.Bundle != "" || opts.Stdin || opts.Image != "" || opts.GithubPR != "" {
+			return fmt.Errorf("--remote-head-only audits cloned repos, it can not be combined with local paths, --bundle, --stdin, --image or --github-pr")
+		}
+		if opts.Commit != "" || opts.CommitFrom != "" || opts.CommitTo != "" || opts.CommitStop != "" || opts.Branch != "" || opts.Depth != 0 ||
+			opts.selectsRefs() || opts.IncludeUnreachable || opts.DedupeRefs || opts.ReferenceDir != "" {
+			return fmt.Errorf("--remote-head-only fetches no history, it can not be combined with options selecting commits or refs")
+		}
+	}
+
+	if opts.CloneDepth < 0 {
+		return fmt.Errorf("--clone-depth must not be negative")
+	} else if opts.CloneDepth != 0 {
+		if opts.RemoteHeadOnly {
+			return fmt.Errorf("--clone-depth and --remote-head-only set, --remote-head-only already fetches a single commit")
+		}
+		if opts.RepoPath != "" || opts.OwnerPath != "" || opts.Path != "" || opts.Bundle != "" || opts.Stdin || opts.Image != "" || opts.GithubPR != "" {
+			return fmt.Errorf("--clone-depth limits clones of remote repos, it can not be combined with local paths, --bundle, --stdin, --image or --github-pr")
+		}
+		if opts.ReferenceDir != "" {
+			// repos with a mirror in --reference-dir borrow its whole history
+			return fmt.Errorf("--clone-depth can not be combined with --reference-dir, which clones the whole history of repos with a mirror")
+		}
+	}
+
+	if opts.DedupeRefs && (opts.CountOnly || opts.ReportFormat == "ndjson") {
+		return fmt.Errorf("--dedupe-refs needs the leaks of the audit, which --count-only and --report-format ndjson do not keep")
+	}
+	if opts.Verify && (opts.CountOnly || opts.ReportFormat == "ndjson") {
+		return fmt.Errorf("--verify verifies the leaks of the report once the audit finishes, which --count-only and --report-format ndjson do not keep")
+	}
+
+	if err := opts.guardAttest(); err != nil {
+		return err
+	}
+
+	if opts.WebhookURL != "" {
+		if err := validateWebhookURL(opts.WebhookURL); err != nil {
+			return err
+		}
+	}
+
+	if opts.TelemetryURL != "" {
+		if u, err := url.Parse(opts.TelemetryURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("--telemetry-url %s must be an http or https url", opts.TelemetryURL)
+		}
+	}
+
+	if _, err := time.LoadLocation(opts.Timezone); err != nil {
+		return fmt.Errorf("unknown --timezone %s: %v", opts.Timezone, err)
+	}
+
+	if opts.ReportFormat != "" {
+		switch opts.ReportFormat {
+		case "json", "csv", "html", "junit", "ndjson":
+		default:
+			return fmt.Errorf("unknown --report-format %s, must be json, csv, html, junit or ndjson", opts.ReportFormat)
+		}
+		if opts.Report == "" {
+			return fmt.Errorf("--report-format requires --report")
+		}
+	}
+
+	if opts.CSVColumns != "" || opts.CSVNoLine {
+		if opts.CSVColumns != "" && opts.CSVNoLine {
+			return fmt.Errorf("--csv-columns and --csv-no-line set, leave line out of --csv-columns instead")
+		} else if opts.Report == "" || opts.reportFormat() != "csv" || opts.CountOnly {
+			return fmt.Errorf("--csv-columns and --csv-no-line require a csv --report")
+		}
+		if _, err := opts.reportCSVColumns(); err != nil {
+			return err
+		}
+	}
+
+	if opts.ReportTemplate != "" {
+		if opts.Report == "" && len(opts.Sinks) == 0 {
+			return fmt.Errorf("--report-template requires --report or a template --sink")
+		} else if opts.ReportFormat != "" {
+			return fmt.Errorf("--report-template and --report-format set, the template is the format")
+		}
+		if _, err := parseReportTemplate(opts.ReportTemplate); err != nil {
+			return err
+		}
+	}
+
+	for _, spec := range opts.Sinks {
+		if opts.CountOnly {
+			return fmt.Errorf("--sink can not be used with --count-only, counts are written to --report")
+		}
+		if _, err := parseSink(spec); err != nil {
+			return err
+		}
+	}
+
 	if opts.Report != "" {
-		if !strings.HasSuffix(opts.Report, ".json") && !strings.HasSuffix(opts.Report, ".csv") {
-			return fmt.Errorf("Report should be a .json or .csv file")
+		if opts.ReportFormat == "" && opts.ReportTemplate == "" && !strings.HasSuffix(opts.Report, ".json") && !strings.HasSuffix(opts.Report, ".csv") && !strings.HasSuffix(opts.Report, ".html") {
+			return fmt.Errorf("Report should be a .json, .csv or .html file")
 		}
 		dirPath := filepath.Dir(opts.Report)
 		if _, err := os.Stat(dirPath); os.IsNotExist(err) {
@@ -140,6 +500,24 @@ func (opts *Options) guard() error {
 	return nil
 }
 
+// writesReport returns true if the run writes a report, to --report, a --sink or the
+// memory of a Scanner, gitleaks serve or a json-rpc scan
+func (opts *Options) writesReport() bool {
+	return opts.Report != "" || len(opts.Sinks) != 0 || collectSink != nil || rpcScan != nil
+}
+
+// reportFormat returns the format of --report, set by --report-format, "template" for
+// --report-template or else by the extension of the report
+func (opts *Options) reportFormat() string {
+	if opts.ReportFormat != "" {
+		return opts.ReportFormat
+	}
+	if opts.ReportTemplate != "" {
+		return "template"
+	}
+	return formatOfPath(opts.Report)
+}
+
 // setLogLevel sets log level for gitleaks. Default is Warning
 func (opts *Options) setLogs() {
 	switch opts.Log {
@@ -0,0 +1,133 @@
+package gitleaks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hako/durafmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+// auditPath audits the files of a plain directory, like build artifacts or unpacked
+// archives, with the configured rules. No git history is needed. Git directories
+// found under the path are skipped and binary files are ignored. Leaks are reported
+// with "N/A" as the commit.
+func auditPath() ([]Leak, error) {
+	var (
+		fileWg    sync.WaitGroup
+		numFiles  int64
+		start     = time.Now()
+		semaphore chan bool
+	)
+	if info, err := os.Stat(opts.Path); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("path %s is not a directory", opts.Path)
+	}
+
+	repo := &Repo{
+		name: filepath.Base(opts.Path),
+		path: opts.Path,
+	}
+	repo.startSpan()
+	walkTrace := startTrace("path walk", repo.spanID).set("path", opts.Path)
+
+	if opts.Threads != 0 {
+		threads = opts.Threads
+	}
+	semaphore = make(chan bool, threads)
+	setProgressRef("files under " + opts.Path)
+
+	err := filepath.Walk(opts.Path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Debugf("unable to read %s: %v", p, err)
+			return nil
+		}
+		if isInterrupted() {
+			// files being audited finish, so their leaks are reported
+			return ErrInterrupted
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		numFiles++
+		fileWg.Add(1)
+		semaphore <- true
+		go func(p string) {
+			defer func() {
+				fileWg.Done()
+				<-semaphore
+			}()
+			if err := repo.auditPathFile(p); err != nil {
+				log.Debugf("unable to read %s: %v", p, err)
+			}
+		}(p)
+		return nil
+	})
+	fileWg.Wait()
+	walkTrace.set("files", strconv.FormatInt(numFiles, 10)).finish()
+	repo.trace.finish()
+	repo.trace = nil
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+
+	if opts.CountOnly {
+		repoReported(repo)
+		reportCounts(repo.name)
+		return nil, nil
+	}
+	repo.leaks = filterBaseline(repo.leaks)
+	repoReported(repo)
+	duration := durafmt.Parse(time.Now().Sub(start)).String()
+	if len(repo.leaks) != 0 {
+		log.Warnf("%d leaks detected. %d files inspected in %s", len(repo.leaks), numFiles, duration)
+	} else {
+		log.Infof("No leaks detected. %d files inspected in %s", numFiles, duration)
+	}
+	return repo.leaks, nil
+}
+
+// auditPathFile audits the file at p, only against the file rules if it is binary. Files
+// are read in windows, so huge ones do not have to fit into memory.
+func (repo *Repo) auditPathFile(p string) error {
+	commit := &Commit{
+		repoName:  repo.name,
+		filePath:  repo.relPath(p),
+		sha:       "N/A",
+		startLine: 1,
+	}
+	if skipWhitelistedFile(commit) {
+		return nil
+	}
+	repo.auditFileRules(commit)
+	if repo.auditArchive(commit, func() (io.ReadCloser, error) { return os.Open(p) }) {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if bin, err := binary.IsBinary(f); bin || err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return repo.inspectReader(f, info.Size(), commit)
+}
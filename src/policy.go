@@ -0,0 +1,160 @@
+package gitleaks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync/atomic"
+
+	"github.com/open-policy-agent/opa/rego"
+	log "github.com/sirupsen/logrus"
+)
+
+// policyQuery is the package --policy defines its rules in. A policy fails the audit
+// with deny messages and logs warn messages, e.g.
+//
+//	package gitleaks
+//
+//	deny[msg] {
+//		leak := input.leaks[_]
+//		leak.severity == "critical"
+//		startswith(leak.file, "deploy/prod/")
+//		input.run.heads[leak.repo] == leak.commit
+//		msg := sprintf("%s in %s at HEAD of %s", [leak.rule, leak.file, leak.repo])
+//	}
+const policyQuery = "data.gitleaks"
+
+var (
+	// policy is the compiled --policy, which decides which leaks fail the audit
+	policy *rego.PreparedEvalQuery
+	// policyErr is set if --policy could not be evaluated, which fails the run
+	policyErr error
+	// repoHeads maps the names of the audited repos to their HEAD commits, so policies
+	// can tell leaks of HEAD from leaks in history
+	repoHeads map[string]string
+)
+
+// policyInput is the input of --policy
+type policyInput struct {
+	Leaks []Leak   `json:"leaks"`
+	Run   runInput `json:"run"`
+}
+
+type runInput struct {
+	RunID        string            `json:"runID"`
+	Version      string            `json:"version"`
+	Heads        map[string]string `json:"heads"`
+	Degradations int64             `json:"degradations"`
+}
+
+// loadPolicy compiles the rego policy at path
+func loadPolicy(path string) (*rego.PreparedEvalQuery, error) {
+	module, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read --policy: %v", err)
+	}
+	query, err := rego.New(
+		rego.Query(policyQuery),
+		rego.Module(path, string(module)),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile --policy %s: %v", path, err)
+	}
+	return &query, nil
+}
+
+// recordHead remembers the HEAD commit of repo for --policy
+func (repo *Repo) recordHead() {
+	if policy == nil || repo.repository == nil {
+		return
+	}
+	head, err := repo.repository.Head()
+	if err != nil {
+		return
+	}
+	mutex.Lock()
+	if repoHeads == nil {
+		repoHeads = make(map[string]string)
+	}
+	repoHeads[repo.name] = head.Hash().String()
+	mutex.Unlock()
+}
+
+// policyFailingLeaks evaluates --policy over leaks and returns the number of deny
+// messages, which fail the audit like failing leaks do
+func policyFailingLeaks(leaks []Leak) int {
+	deny, warn, err := evalPolicy(leaks)
+	if err != nil {
+		// fail closed, the run fails with policyErr
+		policyErr = err
+		return len(leaks)
+	}
+	for _, msg := range warn {
+		log.Warnf("policy: %s", msg)
+	}
+	for _, msg := range deny {
+		log.Errorf("policy: %s", msg)
+	}
+	if len(deny) == 0 && len(leaks) != 0 {
+		log.Infof("%d leaks allowed by policy %s", len(leaks), opts.Policy)
+	}
+	return len(deny)
+}
+
+// evalPolicy returns the deny and warn messages of --policy for leaks, sorted
+func evalPolicy(leaks []Leak) (deny []string, warn []string, err error) {
+	if leaks == nil {
+		leaks = []Leak{}
+	}
+	mutex.Lock()
+	heads := make(map[string]string)
+	for repo, head := range repoHeads {
+		heads[repo] = head
+	}
+	mutex.Unlock()
+	// round trip through json, so policies see the field names of json reports
+	b, err := json.Marshal(policyInput{
+		Leaks: leaks,
+		Run: runInput{
+			RunID:        runID,
+			Version:      version,
+			Heads:        heads,
+			Degradations: atomic.LoadInt64(&degradations),
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var input interface{}
+	if err := json.Unmarshal(b, &input); err != nil {
+		return nil, nil, err
+	}
+
+	rs, err := policy.Eval(context.Background(), rego.EvalInput(input))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to evaluate --policy %s: %v", opts.Policy, err)
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return nil, nil, fmt.Errorf("--policy %s defines no rules in package gitleaks", opts.Policy)
+	}
+	rules, _ := rs[0].Expressions[0].Value.(map[string]interface{})
+	return policyMessages(rules["deny"]), policyMessages(rules["warn"]), nil
+}
+
+// policyMessages returns the messages of a deny or warn rule, a set of strings or values
+func policyMessages(v interface{}) []string {
+	var messages []string
+	values, _ := v.([]interface{})
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			messages = append(messages, s)
+		} else {
+			b, _ := json.Marshal(value)
+			messages = append(messages, string(b))
+		}
+	}
+	sort.Strings(messages)
+	return messages
+}
@@ -0,0 +1,46 @@
+package gitleaks
+
+// rule sources, where the rules of leaks are defined
+const (
+	// ruleSourceDefault is the default config of gitleaks
+	ruleSourceDefault = "default"
+	// ruleSourceConfig is the config file of --config or GITLEAKS_CONFIG
+	ruleSourceConfig = "config"
+	// ruleSourceRepo is the .gitleaks.toml of the audited repo, with --repo-config
+	ruleSourceRepo = "repo"
+)
+
+// ruleProvenance is where a rule is defined, reported with its leaks so leaks found
+// before and after an update of the rules, e.g. mid-remediation, are told apart
+type ruleProvenance struct {
+	source string
+	// version is the version of the config, if it declares one
+	version string
+	// digest is the sha256 of the config
+	digest string
+}
+
+// stampRules records p as the provenance of the rules of config without one, the rules
+// added by the config p describes
+func (config *Config) stampRules(p ruleProvenance) {
+	if config.ruleProvenance == nil {
+		config.ruleProvenance = make(map[*Rule]ruleProvenance)
+	}
+	for _, rule := range config.Rules {
+		if _, ok := config.ruleProvenance[rule]; !ok {
+			config.ruleProvenance[rule] = p
+		}
+	}
+}
+
+// stampRule sets the provenance of rule on leak
+func (leak *Leak) stampRule(rule *Rule) {
+	if config == nil {
+		return
+	}
+	p, ok := config.ruleProvenance[rule]
+	if !ok {
+		return
+	}
+	leak.RuleSource, leak.RuleVersion, leak.RuleDigest = p.source, p.version, "sha256:"+p.digest
+}
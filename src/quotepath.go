@@ -0,0 +1,39 @@
+package gitleaks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// reportPath returns the path reported for a leak in filePath. Paths quoted by git
+// because of core.quotepath, e.g. "caf\303\251.txt", are decoded and paths committed
+// from macOS in decomposed form are normalized, so the same file always yields the
+// same path and leak fingerprints match across repos, reports and baselines. Bytes
+// which are not valid UTF-8 are escaped the way git quotes them rather than replaced
+// when reports are encoded.
+func reportPath(filePath string) string {
+	if len(filePath) > 1 && strings.HasPrefix(filePath, `"`) && strings.HasSuffix(filePath, `"`) {
+		if unquoted, err := strconv.Unquote(filePath); err == nil {
+			filePath = unquoted
+		}
+	}
+	if utf8.ValidString(filePath) {
+		return norm.NFC.String(filePath)
+	}
+
+	var b strings.Builder
+	for len(filePath) > 0 {
+		r, size := utf8.DecodeRuneInString(filePath)
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, `\%03o`, filePath[0])
+		} else {
+			b.WriteString(filePath[:size])
+		}
+		filePath = filePath[size:]
+	}
+	return norm.NFC.String(b.String())
+}
@@ -0,0 +1,210 @@
+package gitleaks
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	gitConfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// referencePrefix is where the refs of a reference mirror are temporarily stored so
+// that go-git advertises them as "haves" while fetching from the remote.
+const referencePrefix = "refs/gitleaks-reference/"
+
+// findReference looks for a local mirror of the repo at url in --reference-dir. Mirrors
+// are matched by repo name and may be bare (<name>.git) or have a worktree (<name>).
+// The path of the mirror and its objects directory are returned, or empty strings if
+// no mirror exists.
+func findReference(url string) (string, string) {
+	name := strings.TrimSuffix(filepath.Base(strings.TrimSuffix(url, "/")), ".git")
+	for _, candidate := range []string{name + ".git", name} {
+		mirrorPath := filepath.Join(opts.ReferenceDir, candidate)
+		for _, objectsDir := range []string{
+			filepath.Join(mirrorPath, "objects"),
+			filepath.Join(mirrorPath, ".git", "objects"),
+		} {
+			if info, err := os.Stat(objectsDir); err == nil && info.IsDir() {
+				return mirrorPath, objectsDir
+			}
+		}
+	}
+	return "", ""
+}
+
+// referenceClone clones options.URL to path borrowing objects from the mirror at
+// mirrorPath, similar to `git clone --reference`. The mirror's object directory is
+// registered as an alternate and its refs are advertised during the fetch so only
+// objects missing from the mirror are transferred. If --dissociate is set the mirror's
+// objects are copied into the clone and the alternate is dropped afterwards.
+func referenceClone(path, mirrorPath, objectsDir string, options *git.CloneOptions) (*git.Repository, error) {
+	log.Infof("cloning %s using reference %s", options.URL, mirrorPath)
+	repository, err := git.PlainInit(path, false)
+	if err != nil {
+		return nil, err
+	}
+	alternates := filepath.Join(path, ".git", "objects", "info", "alternates")
+	if err = os.MkdirAll(filepath.Dir(alternates), 0755); err != nil {
+		return nil, err
+	}
+	absObjectsDir, err := filepath.Abs(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(alternates, []byte(absObjectsDir+"\n"), 0644); err != nil {
+		return nil, err
+	}
+
+	mirror, err := git.PlainOpen(mirrorPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open reference %s: %v", mirrorPath, err)
+	}
+	refs, err := mirror.References()
+	if err != nil {
+		return nil, err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		name := plumbing.ReferenceName(referencePrefix + strings.TrimPrefix(ref.Name().String(), "refs/"))
+		return repository.Storer.SetReference(plumbing.NewHashReference(name, ref.Hash()))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = repository.CreateRemote(&gitConfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{options.URL},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = repository.Fetch(&git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		Auth:       options.Auth,
+		Progress:   options.Progress,
+		Tags:       git.AllTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+
+	if err = removeReferenceRefs(repository); err != nil {
+		return nil, err
+	}
+	if err = checkoutDefaultBranch(repository); err != nil {
+		return nil, err
+	}
+
+	if opts.Dissociate {
+		if err = copyDir(objectsDir, filepath.Join(path, ".git", "objects")); err != nil {
+			return nil, fmt.Errorf("unable to dissociate from reference %s: %v", mirrorPath, err)
+		}
+		if err = os.Remove(alternates); err != nil {
+			return nil, err
+		}
+		return git.PlainOpen(path)
+	}
+	return repository, nil
+}
+
+// removeReferenceRefs deletes the mirror refs once the fetch is done so they are not audited
+func removeReferenceRefs(repository *git.Repository) error {
+	refs, err := repository.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+	var names []plumbing.ReferenceName
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		if strings.HasPrefix(ref.Name().String(), referencePrefix) {
+			names = append(names, ref.Name())
+		}
+		return nil
+	})
+	for _, name := range names {
+		if err := repository.Storer.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutDefaultBranch points HEAD at a local branch created from the fetched remote
+// branches, preferring master. go-git needs a resolvable HEAD to walk all commits.
+func checkoutDefaultBranch(repository *git.Repository) error {
+	refs, err := repository.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+	remotePrefix := "refs/remotes/" + git.DefaultRemoteName + "/"
+	var branch *plumbing.Reference
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if !strings.HasPrefix(ref.Name().String(), remotePrefix) || ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		if branch == nil || strings.TrimPrefix(ref.Name().String(), remotePrefix) == "master" {
+			branch = ref
+		}
+		if strings.TrimPrefix(branch.Name().String(), remotePrefix) == "master" {
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if branch == nil {
+		return fmt.Errorf("no branches fetched")
+	}
+	local := plumbing.NewBranchReferenceName(strings.TrimPrefix(branch.Name().String(), remotePrefix))
+	if err = repository.Storer.SetReference(plumbing.NewHashReference(local, branch.Hash())); err != nil {
+		return err
+	}
+	return repository.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, local))
+}
+
+// copyDir copies the files under src into dst, skipping files that already exist in dst
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if rel == filepath.Join("info", "alternates") {
+			return nil
+		}
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0444)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -0,0 +1,172 @@
+package gitleaks
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// reflogHashes returns every commit hash recorded in the reflogs of an on-disk repo,
+// in the order they are first seen. go-git does not read reflogs so the files under
+// <git dir>/logs are parsed directly. Each line has the form
+// "<old sha> <new sha> <author> <timestamp> <tz>\t<message>".
+func reflogHashes(repoPath string) ([]plumbing.Hash, error) {
+	var hashes []plumbing.Hash
+	seen := make(map[plumbing.Hash]bool)
+	dir := gitDir(repoPath)
+	if dir == "" {
+		return nil, nil
+	}
+	logsDir := filepath.Join(dir, "logs")
+	if _, err := os.Stat(logsDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	err := filepath.Walk(logsDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		for _, h := range parseReflog(f) {
+			if !seen[h] {
+				seen[h] = true
+				hashes = append(hashes, h)
+			}
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+// parseReflog returns the old and new hashes of every entry in a reflog
+func parseReflog(r io.Reader) []plumbing.Hash {
+	var hashes []plumbing.Hash
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[:2] {
+			if len(field) != 40 {
+				continue
+			}
+			h := plumbing.NewHash(field)
+			if !h.IsZero() {
+				hashes = append(hashes, h)
+			}
+		}
+	}
+	return hashes
+}
+
+// extraCommitIter yields the commits of a base iterator followed by the history of
+// every extra tip (reflog entries, dangling commits) the base iterator did not already
+// visit. This picks up commits that were amended or rebased away and are no longer
+// reachable from any ref.
+type extraCommitIter struct {
+	base     object.CommitIter
+	repo     *Repo
+	tips     []plumbing.Hash
+	visited  map[plumbing.Hash]bool
+	current  object.CommitIter
+	baseDone bool
+	// walked counts the tips walked besides base, onTip is called with it, if set,
+	// before walking each tip
+	walked int
+	onTip  func(walked int)
+}
+
+func newExtraCommitIter(repo *Repo, base object.CommitIter, tips []plumbing.Hash) *extraCommitIter {
+	return &extraCommitIter{
+		base:    base,
+		repo:    repo,
+		tips:    tips,
+		visited: make(map[plumbing.Hash]bool),
+	}
+}
+
+// Next implements object.CommitIter
+func (iter *extraCommitIter) Next() (*object.Commit, error) {
+	if !iter.baseDone {
+		c, err := iter.base.Next()
+		if err == nil {
+			iter.visited[c.Hash] = true
+			return c, nil
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+		iter.baseDone = true
+	}
+	for {
+		if iter.current != nil {
+			c, err := iter.current.Next()
+			if err == nil {
+				iter.visited[c.Hash] = true
+				return c, nil
+			}
+			if err != io.EOF {
+				return nil, err
+			}
+			iter.current = nil
+		}
+		if len(iter.tips) == 0 {
+			return nil, io.EOF
+		}
+		tip := iter.tips[0]
+		iter.tips = iter.tips[1:]
+		iter.walked++
+		if iter.onTip != nil {
+			iter.onTip(iter.walked)
+		}
+		if iter.visited[tip] {
+			continue
+		}
+		c, err := iter.repo.repository.CommitObject(tip)
+		if err != nil {
+			// pruned by gc
+			log.Debugf("commit %s no longer exists", tip.String())
+			continue
+		}
+		log.Debugf("walking history of commit %s", tip.String())
+		iter.current = object.NewCommitPreorderIter(c, iter.visited, nil)
+	}
+}
+
+// ForEach implements object.CommitIter
+func (iter *extraCommitIter) ForEach(cb func(*object.Commit) error) error {
+	defer iter.Close()
+	for {
+		c, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = cb(c); err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Close implements object.CommitIter
+func (iter *extraCommitIter) Close() {
+	iter.base.Close()
+	if iter.current != nil {
+		iter.current.Close()
+	}
+}
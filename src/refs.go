@@ -0,0 +1,135 @@
+package gitleaks
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// refBatch is the number of refs above which the refs of a repo are walked one after the
+// other instead of all at once, logging progress every refBatch refs, e.g. for Gerrit
+// refs/changes or CI tags
+const refBatch = 1000
+
+// selectsRefs returns true if only some refs of repos are audited, see refTips
+func (opts *Options) selectsRefs() bool {
+	return opts.RefShard != "" || len(opts.ExcludeRef) != 0 || opts.RefSample != 0
+}
+
+// refTips returns the commits pointed to by the refs of the repo selected by --ref-shard,
+// --exclude-ref and --ref-sample, sorted by ref name. Annotated tags are peeled to their
+// commit, refs to other objects are left out.
+func (repo *Repo) refTips() ([]plumbing.Hash, error) {
+	refs, err := repo.repository.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		branches, others []*plumbing.Reference
+		excluded         int
+	)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		if ref.Type() != plumbing.HashReference || !inRefShard(name) {
+			return nil
+		}
+		if excludedRef(name) {
+			excluded++
+			return nil
+		}
+		if ref.Name().IsBranch() || ref.Name().IsRemote() {
+			branches = append(branches, ref)
+		} else {
+			others = append(others, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if excluded != 0 {
+		log.Infof("%d refs of %s excluded by --exclude-ref", excluded, repo.name)
+	}
+	if opts.RefSample != 0 && len(others) > opts.RefSample {
+		log.Infof("auditing the branches and %d of %d other refs of %s, sampled by --ref-sample", opts.RefSample, len(others), repo.name)
+		others = sampleRefs(others, opts.RefSample)
+	}
+
+	selected := append(branches, others...)
+	if opts.MaxRefs != 0 && len(selected) > opts.MaxRefs {
+		return nil, fmt.Errorf("skipping %s, %w: %d refs are more than --max-refs %d. Select refs with --exclude-ref, --ref-sample or --ref-shard, or raise --max-refs",
+			repo.name, ErrTooManyRefs, len(selected), opts.MaxRefs)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Name() < selected[j].Name()
+	})
+	// refs of CI tags and changes often point to the same commits
+	peeled := make(map[plumbing.Hash]plumbing.Hash)
+	tips := make([]plumbing.Hash, 0, len(selected))
+	for _, ref := range selected {
+		hash, ok := peeled[ref.Hash()]
+		if !ok {
+			hash = repo.peelRef(ref.Hash())
+			peeled[ref.Hash()] = hash
+		}
+		if !hash.IsZero() {
+			tips = append(tips, hash)
+		}
+	}
+	if opts.RefShard != "" {
+		log.Debugf("%d refs of %s are in ref shard %s", len(tips), repo.name, opts.RefShard)
+	}
+	return tips, nil
+}
+
+// peelRef returns the commit of the object hash a ref points to, peeling annotated tags,
+// or a zero hash for refs to trees and blobs
+func (repo *Repo) peelRef(hash plumbing.Hash) plumbing.Hash {
+	if _, err := repo.repository.CommitObject(hash); err == nil {
+		return hash
+	}
+	tag, err := repo.repository.TagObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+	return commit.Hash
+}
+
+// excludedRef returns true if the ref called name matches a pattern of --exclude-ref.
+// Patterns ending with a slash match the refs below them, e.g. refs/changes/, others are
+// globs, e.g. refs/tags/ci-*.
+func excludedRef(name string) bool {
+	for _, pattern := range opts.ExcludeRef {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(name, pattern) {
+				return true
+			}
+		} else if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleRefs returns n of refs, picked by the hash of their names, so audits of the
+// same repo sample the same refs and a ref stays sampled as refs are added
+func sampleRefs(refs []*plumbing.Reference, n int) []*plumbing.Reference {
+	keys := make(map[plumbing.ReferenceName]string, len(refs))
+	for _, ref := range refs {
+		keys[ref.Name()] = fmt.Sprintf("%x", sha256.Sum256([]byte(ref.Name())))
+	}
+	sampled := append([]*plumbing.Reference(nil), refs...)
+	sort.Slice(sampled, func(i, j int) bool {
+		return keys[sampled[i].Name()] < keys[sampled[j].Name()]
+	})
+	return sampled[:n]
+}
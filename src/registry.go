@@ -0,0 +1,238 @@
+package gitleaks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	// manifestAccept lists the media types of the image manifests and indexes which
+	// are read from registries
+	manifestAccept = "application/vnd.oci.image.index.v1+json, " +
+		"application/vnd.oci.image.manifest.v1+json, " +
+		"application/vnd.docker.distribution.manifest.list.v2+json, " +
+		"application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// authParamRe matches the parameters of a WWW-Authenticate header, e.g. realm="..."
+var authParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// registryClient pulls the manifests and layers of an image repository of a registry,
+// implementing just enough of the distribution API for --image
+type registryClient struct {
+	scheme     string
+	registry   string
+	repository string
+	token      string
+	client     *http.Client
+}
+
+// imageReference is a parsed image reference, e.g. ghcr.io/org/app:1.0
+type imageReference struct {
+	registry   string
+	repository string
+	// reference is a tag or a digest
+	reference string
+}
+
+// parseImageReference parses ref like docker pull does. The registry defaults to
+// Docker Hub, and the tag to latest.
+func parseImageReference(ref string) (imageReference, error) {
+	var image imageReference
+	name := ref
+	if i := strings.Index(name, "@"); i != -1 {
+		image.reference = name[i+1:]
+		name = name[:i]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		image.reference = name[i+1:]
+		name = name[:i]
+	}
+	if image.reference == "" {
+		image.reference = "latest"
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		image.registry, image.repository = parts[0], parts[1]
+	} else {
+		image.registry, image.repository = dockerHubRegistry, name
+		if !strings.Contains(name, "/") {
+			image.repository = "library/" + name
+		}
+	}
+	if image.repository == "" || strings.ContainsAny(image.repository, " \t") {
+		return image, fmt.Errorf("invalid image reference %s", ref)
+	}
+	if image.registry == "docker.io" || image.registry == "index.docker.io" {
+		image.registry = dockerHubRegistry
+	}
+	return image, nil
+}
+
+// registryLayers returns the layers of the image ref of a registry. Indexes resolve to
+// the linux/amd64 image.
+func registryLayers(ref string) ([]imageLayer, error) {
+	image, err := parseImageReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	r := &registryClient{
+		scheme:     "https",
+		registry:   image.registry,
+		repository: image.repository,
+		client:     &http.Client{},
+	}
+	host := strings.Split(image.registry, ":")[0]
+	if host == "localhost" || host == "127.0.0.1" {
+		r.scheme = "http"
+	}
+
+	reference := image.reference
+	var manifest ociManifest
+	for depth := 0; ; depth++ {
+		b, err := r.get("manifests/"+reference, manifestAccept, 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		manifest = ociManifest{}
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest of %s: %v", ref, err)
+		}
+		if len(manifest.Manifests) == 0 {
+			break
+		}
+		if depth == 3 {
+			return nil, fmt.Errorf("image indexes are nested too deep")
+		}
+		reference = selectManifest(manifest.Manifests).Digest
+	}
+
+	var layers []imageLayer
+	for _, layer := range manifest.Layers {
+		digest := layer.Digest
+		layers = append(layers, imageLayer{digest: digest, open: func() (io.ReadCloser, error) {
+			return r.open("blobs/"+digest, "", 0)
+		}})
+	}
+	log.Debugf("image %s has %d layers", ref, len(layers))
+	return layers, nil
+}
+
+// get returns the body of the registry resource path
+func (r *registryClient) get(path, accept string, timeout time.Duration) ([]byte, error) {
+	body, err := r.open(path, accept, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// open requests the registry resource path, e.g. manifests/latest. Registries asking
+// for a bearer token are sent one, requested with REGISTRY_USERNAME and
+// REGISTRY_PASSWORD if set.
+func (r *registryClient) open(path, accept string, timeout time.Duration) (io.ReadCloser, error) {
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", r.scheme, r.registry, r.repository, path)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		} else if user := os.Getenv("REGISTRY_USERNAME"); user != "" {
+			req.SetBasicAuth(user, os.Getenv("REGISTRY_PASSWORD"))
+		}
+		client := *r.client
+		client.Timeout = timeout
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error pulling %s: %v", u, err)
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return resp.Body, nil
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+				return nil, fmt.Errorf("error pulling %s: %w", u, ErrInvalidAuth)
+			}
+			if r.token, err = r.fetchToken(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return nil, fmt.Errorf("error pulling %s: %w", u, ErrInvalidAuth)
+		case http.StatusNotFound:
+			return nil, fmt.Errorf("error pulling %s: %w", u, ErrRepoNotFound)
+		}
+		return nil, fmt.Errorf("error pulling %s: %s", u, resp.Status)
+	}
+}
+
+// fetchToken returns a bearer token for the WWW-Authenticate challenge of a registry
+func (r *registryClient) fetchToken(challenge string) (string, error) {
+	params := make(map[string]string)
+	for _, m := range authParamRe.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid registry challenge %q", challenge)
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + r.repository + ":pull"
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if user := os.Getenv("REGISTRY_USERNAME"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("REGISTRY_PASSWORD"))
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting registry token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error requesting registry token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error requesting registry token: %v", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return token.Token, nil
+}
@@ -3,11 +3,14 @@ package gitleaks
 import (
 	"crypto/md5"
 	"fmt"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hako/durafmt"
@@ -19,7 +22,6 @@ import (
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	gitHttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
-	"gopkg.in/src-d/go-git.v4/storage/memory"
 	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
 )
 
@@ -34,6 +36,27 @@ type Commit struct {
 	author   string
 	email    string
 	date     time.Time
+	// committerDate differs from date, the author date, for rebased or cherry-picked commits
+	committerDate time.Time
+	// suppressedBy is set when a whitelist would normally have skipped the content
+	// but --show-suppressed asks for its matches to be reported anyway
+	suppressedBy string
+	// startLine is the line number of the first line of content in its file, 0 if it
+	// is unknown. lineNumber, startColumn and endColumn locate a leak in content.
+	startLine   int
+	lineNumber  int
+	startColumn int
+	endColumn   int
+	// contextBefore and contextAfter are the lines of content around a leak, see --context
+	contextBefore []string
+	contextAfter  []string
+	// overlap is the number of bytes at the start of content which end the window
+	// before, see inspectReader. Leaks within them were found in that window.
+	overlap int
+	// layer is the digest of the image layer content was read from, for --image
+	layer string
+	// blob is the hash of the blob content was added to, for --dedupe-refs
+	blob string
 }
 
 // Leak represents a leaked secret or regex match.
@@ -49,27 +72,88 @@ type Leak struct {
 	File     string    `json:"file"`
 	Repo     string    `json:"repo"`
 	Date     time.Time `json:"date"`
-	Tags     string    `json:"tags"`
-	Severity string    `json:"severity"`
+	// CommitDate is the committer date, Date the author date. Both are in UTC or --timezone.
+	CommitDate time.Time `json:"commitDate"`
+	Tags       string    `json:"tags"`
+	Severity   string    `json:"severity"`
+	RunID      string    `json:"runID"`
+	SpanID     string    `json:"spanID"`
+	// RuleID is the stable id of Rule, which keeps working when rules are reworded.
+	// Fingerprint is a hash of the repo, commit, file, rule id and secret, the same in
+	// every run, to track leaks across runs and build suppression lists.
+	RuleID      string `json:"ruleID"`
+	Fingerprint string `json:"fingerprint"`
+	// LineNumber is the line of the leak in File, if known. StartColumn and EndColumn
+	// are the first and last character of Offender in Line, counted from 1.
+	LineNumber  int `json:"lineNumber,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+	// ContextBefore and ContextAfter are up to --context lines before and after Line,
+	// as far as they were audited with it, e.g. the lines a commit added around it
+	ContextBefore []string `json:"contextBefore,omitempty"`
+	ContextAfter  []string `json:"contextAfter,omitempty"`
+	// LineLength and OffenderLength are the number of characters of Line and Offender
+	// before they were truncated by --max-line-length and --max-offender-length
+	LineLength     int `json:"lineLength,omitempty"`
+	OffenderLength int `json:"offenderLength,omitempty"`
+	// Layer is the digest of the image layer File is in, for audits of --image
+	Layer string `json:"layer,omitempty"`
+	// SuppressedBy names the whitelist entry which suppressed this match. Only
+	// set for matches reported with --show-suppressed.
+	SuppressedBy string `json:"suppressedBy,omitempty"`
+	// AlsoPresentIn lists the forks of Repo in which an owner audit found the same leak
+	AlsoPresentIn []string `json:"alsoPresentIn,omitempty"`
+	// Refs lists the branches and tags containing the leak, set with --dedupe-refs
+	Refs []string `json:"refs,omitempty"`
+	// Revoked is set for secrets in --revoked-feed, which were revoked already, e.g.
+	// rotated in a past incident
+	Revoked bool `json:"revoked,omitempty"`
+	// Verified is whether the provider of the secret accepts it, with --verify. Unset
+	// if the rule has no verifier or its verifier could not tell.
+	Verified *bool `json:"verified,omitempty"`
+	// RuleSource is where Rule is defined, default, config for --config or
+	// GITLEAKS_CONFIG, or repo for the .gitleaks.toml of --repo-config. RuleVersion is
+	// the version declared by that config, if any, and RuleDigest its sha256.
+	RuleSource  string `json:"ruleSource,omitempty"`
+	RuleVersion string `json:"ruleVersion,omitempty"`
+	RuleDigest  string `json:"ruleDigest,omitempty"`
+	// ExtraFields are the fields of [report.extraFields] of the config, like the team
+	// owning the repo, for routing by downstream systems
+	ExtraFields map[string]string `json:"extraFields,omitempty"`
+
+	// blob is the hash of the blob the leak was added to, if known
+	blob string
+	// verifier is the verifier of the rule with --verify, which verifies secret, the
+	// offender before --redact, once the audit finishes. content is the file or diff
+	// the secret is found in, see verifier.
+	verifier string
+	secret   string
+	content  string
 }
 
 // Repo contains a src-d git repository and other data about the repo
 type Repo struct {
-	leaks         []Leak
-	path          string
-	url           string
-	name          string
-	repository    *git.Repository
-	err           error
-	auditDuration string
-	numCommits    int64
+	leaks      []Leak
+	path       string
+	url        string
+	name       string
+	repository *git.Repository
+	err        error
+	duration   time.Duration
+	numCommits int64
+	numBytes   int64
+	spanID     string
+	trace      *traceSpan
+	// fork is set for repos of owner audits which are forks of another repo
+	fork bool
 }
 
 func newRepo() (*Repo, error) {
-	for _, re := range config.WhiteList.repos {
-		if re.FindString(opts.Repo) != "" {
-			return nil, fmt.Errorf("skipping %s, whitelisted", opts.Repo)
-		}
+	if opts.Bundle != "" {
+		return &Repo{name: bundleName(opts.Bundle)}, nil
+	}
+	if re := whitelistedRepo(filepath.Base(opts.Repo), opts.Repo); re != nil {
+		return nil, fmt.Errorf("skipping %s, %w%s", opts.Repo, ErrWhitelisted, re.describe())
 	}
 	return &Repo{
 		path: opts.RepoPath,
@@ -84,77 +168,184 @@ func (repo *Repo) clone() error {
 		err        error
 		repository *git.Repository
 	)
-
-	// check if cloning to disk
-	if opts.Disk {
+	repo.startSpan()
+	cloneTrace := startTrace("clone", repo.spanID).set("repo", opts.Repo)
+	defer cloneTrace.finish()
+
+	// local repos are opened in place, even with options implying --disk
+	if opts.Bundle != "" {
+		log.Infof("reading bundle %s", opts.Bundle)
+		repository, err = openBundle(opts.Bundle)
+	} else if repo.path != "" {
+		log.Infof("opening %s", repo.path)
+		repository, err = git.PlainOpen(repo.path)
+		if err != nil {
+			log.Errorf("unable to open %s", repo.path)
+		}
+	} else if opts.Disk {
 		log.Infof("cloning %s to disk", opts.Repo)
-		cloneTarget := fmt.Sprintf("%s/%x", dir, md5.Sum([]byte(fmt.Sprintf("%s%s", opts.GithubUser, opts.Repo))))
+		cloneTarget := repo.cloneTarget()
 		if strings.HasPrefix(opts.Repo, "git") {
 			// private
-			repository, err = git.PlainClone(cloneTarget, false, &git.CloneOptions{
+			repository, err = plainClone(cloneTarget, &git.CloneOptions{
 				URL:      opts.Repo,
-				Progress: os.Stdout,
-				Auth:     config.sshAuth,
+				Progress: cloneProgress,
+				Auth:     config.sshAuthFor(opts.Repo),
 			})
 		} else {
 			// public
 			options := &git.CloneOptions{
 				URL:      opts.Repo,
-				Progress: os.Stdout,
+				Progress: cloneProgress,
 			}
 			if os.Getenv("GITHUB_TOKEN") != "" {
 				options.Auth = &gitHttp.BasicAuth{
 					Username: "fakeUsername", // yes, this can be anything except an empty string
 					Password: os.Getenv("GITHUB_TOKEN"),
 				}
+			} else if auth := azureDevOpsAuth(); auth != nil {
+				options.Auth = auth
 			}
-			repository, err = git.PlainClone(cloneTarget, false, options)
+			repository, err = plainClone(cloneTarget, options)
 		}
-	} else if repo.path != "" {
-		log.Infof("opening %s", repo.path)
-		repository, err = git.PlainOpen(repo.path)
-		if err != nil {
-			log.Errorf("unable to open %s", repo.path)
-		}
-	} else if os.Getenv("AZURE_DEVOPS_TOKEN") != "" {
-		cloneTarget := fmt.Sprintf("%s/%x", dir, md5.Sum([]byte(fmt.Sprintf("%s%s", opts.GithubUser, opts.Repo))))
-		fmt.Println(cloneTarget)
-		auth := "https://" + "fakeUsername:" + os.Getenv("AZURE_DEVOPS_TOKEN") + "@"
-		repo := strings.Replace(opts.Repo, "https://", auth, 1)
-		cmdOutput, err := exec.Command("git", "clone", repo, cloneTarget).Output()
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Printf("%s", cmdOutput)
-		repository, err = git.PlainOpen(cloneTarget)
 	} else {
 		// cloning to memory
 		log.Infof("cloning %s", opts.Repo)
 		if strings.HasPrefix(opts.Repo, "git") {
-			repository, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+			repository, err = memoryClone(&git.CloneOptions{
 				URL:      opts.Repo,
-				Progress: os.Stdout,
-				Auth:     config.sshAuth,
+				Progress: cloneProgress,
+				Auth:     config.sshAuthFor(opts.Repo),
 			})
 		} else {
 			options := &git.CloneOptions{
 				URL:      opts.Repo,
-				Progress: os.Stdout,
+				Progress: cloneProgress,
 			}
 			if os.Getenv("GITHUB_TOKEN") != "" {
 				options.Auth = &gitHttp.BasicAuth{
 					Username: "fakeUsername", // yes, this can be anything except an empty string
 					Password: os.Getenv("GITHUB_TOKEN"),
 				}
+			} else if auth := azureDevOpsAuth(); auth != nil {
+				options.Auth = auth
 			}
-			repository, err = git.Clone(memory.NewStorage(), nil, options)
+			repository, err = memoryClone(options)
 		}
 	}
+	err = cloneError(err)
 	repo.repository = repository
 	repo.err = err
 	return err
 }
 
+// cloneTarget returns the directory a single repo is cloned to when cloning to disk.
+// Clones kept with --keep-clones are at keptClonePath instead, see plainClone.
+func (repo *Repo) cloneTarget() string {
+	if opts.KeepClones != "" {
+		return keptClonePath(opts.Repo)
+	}
+	return fmt.Sprintf("%s/%x", dir, md5.Sum([]byte(fmt.Sprintf("%s%s", opts.GithubUser, opts.Repo))))
+}
+
+// keptClonePath returns the directory the repo of rawURL is kept in with --keep-clones,
+// <keep-clones>/<host>/<owner>/<name>, so repos of the same name of other owners or hosts
+// never share a clone. Repos of local paths are kept under localhost.
+func keptClonePath(rawURL string) string {
+	host, repoPath := "localhost", rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host, repoPath = u.Hostname(), u.Path
+	} else if sshHost(rawURL) != "" && !filepath.IsAbs(rawURL) {
+		host, repoPath = sshHost(rawURL), rawURL[strings.Index(rawURL, ":")+1:]
+	}
+	repoPath = strings.TrimSuffix(strings.TrimSuffix(filepath.ToSlash(repoPath), "/"), ".git")
+	// cleaned as an absolute path so .. can not leave the directory of the host
+	repoPath = strings.TrimPrefix(filepath.Clean("/"+strings.Replace(repoPath, ":", "", -1)), string(filepath.Separator))
+	return filepath.Join(dir, host, repoPath)
+}
+
+// sameRemote returns true if the clone urls a and b are of the same repo, ignoring a
+// .git suffix and trailing slash
+func sameRemote(a, b string) bool {
+	trim := func(u string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	}
+	return trim(a) == trim(b)
+}
+
+// plainClone clones a repo to path. With --keep-clones the repo is cloned to
+// keptClonePath of its url rather than path, and if a previous run already left a clone
+// of the repo there, that clone is fetched and reused. If --reference-dir contains a
+// mirror of the repo, objects are borrowed from the mirror instead of fetched.
+func plainClone(path string, options *git.CloneOptions) (*git.Repository, error) {
+	var (
+		repository *git.Repository
+		err        error
+	)
+	if opts.KeepClones != "" {
+		path = keptClonePath(options.URL)
+	}
+	options = headOnlyOptions(cloneDepthOptions(options))
+	mirrorPath, objectsDir := "", ""
+	if opts.ReferenceDir != "" {
+		mirrorPath, objectsDir = findReference(options.URL)
+	}
+	if mirrorPath != "" {
+		repository, err = referenceClone(path, mirrorPath, objectsDir, options)
+	} else {
+		repository, err = git.PlainClone(path, false, options)
+	}
+	if err == git.ErrRepositoryAlreadyExists && opts.KeepClones != "" {
+		log.Infof("reusing existing clone at %s", path)
+		return updateClone(path, options)
+	}
+	return repository, err
+}
+
+// updateClone fetches the refs of the clone kept at path, so commits pushed since it was
+// cloned are audited. Local branches follow their remote branch, as clones are never
+// committed to.
+func updateClone(path string, options *git.CloneOptions) (*git.Repository, error) {
+	repository, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repository.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, fmt.Errorf("the clone at %s has no %s remote: %v", path, git.DefaultRemoteName, err)
+	}
+	if urls := remote.Config().URLs; len(urls) == 0 || !sameRemote(urls[0], options.URL) {
+		return nil, fmt.Errorf("the clone at %s is not a clone of %s, move it out of --keep-clones", path, options.URL)
+	}
+	err = repository.Fetch(&git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		Auth:       options.Auth,
+		Progress:   options.Progress,
+		Depth:      options.Depth,
+		Tags:       git.AllTags,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, fmt.Errorf("unable to fetch the clone at %s: %v", path, err)
+	}
+	refs, err := repository.References()
+	if err != nil {
+		return nil, err
+	}
+	remotePrefix := "refs/remotes/" + git.DefaultRemoteName + "/"
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if !ref.Name().IsBranch() {
+			return nil
+		}
+		remote, err := repository.Reference(plumbing.ReferenceName(remotePrefix+ref.Name().Short()), true)
+		if err != nil || remote.Hash() == ref.Hash() {
+			return nil
+		}
+		return repository.Storer.SetReference(plumbing.NewHashReference(ref.Name(), remote.Hash()))
+	})
+	return repository, err
+}
+
 // audit performs an audit
 func (repo *Repo) audit() error {
 	var (
@@ -163,11 +354,15 @@ func (repo *Repo) audit() error {
 		commitWg    sync.WaitGroup
 		semaphore   chan bool
 		logOpts     git.LogOptions
+		extraTips   []plumbing.Hash
+		walkedRefs  int
+		excluded    map[plumbing.Hash]bool
 	)
-	for _, re := range config.WhiteList.repos {
-		if re.FindString(repo.name) != "" {
-			return fmt.Errorf("skipping %s, whitelisted", repo.name)
-		}
+	repo.startSpan()
+	walkTrace := startTrace("ref walk", repo.spanID)
+	defer walkTrace.finish()
+	if re := whitelistedRepo(repo.name, repo.remoteURLs()...); re != nil {
+		return fmt.Errorf("skipping %s, %w%s", repo.name, ErrWhitelisted, re.describe())
 	}
 
 	start := time.Now()
@@ -177,8 +372,52 @@ func (repo *Repo) audit() error {
 		err := config.updateFromRepo(repo)
 		if err != nil {
 			log.Warn(err)
+			degrade()
+		}
+	}
+
+	// personal whitelists only apply to the audit of the repo they live in
+	if repo.path != "" {
+		local, err := config.withLocalWhitelist(repo.path)
+		if err != nil {
+			log.Warn(err)
+			degrade()
+		} else if local != config {
+			defer func(shared *Config) {
+				config = shared
+			}(config)
+			config = local
 		}
 	}
+	ignored, err := repo.ignoredLeaks()
+	if err != nil {
+		log.Warn(err)
+		degrade()
+	} else if local := config.withIgnoredLeaks(ignored); local != config {
+		defer func(shared *Config) {
+			config = shared
+		}(config)
+		config = local
+	}
+
+	if opts.Uncommitted || opts.Staged {
+		return repo.auditUncommitted()
+	}
+
+	if err := repo.checkHealth(); err != nil {
+		return err
+	}
+
+	// on-disk repos carry config and hooks which are never committed
+	if repo.path != "" {
+		repo.auditGitDir()
+	}
+
+	if opts.RemoteHeadOnly {
+		err := repo.auditHead()
+		repo.duration = time.Since(start)
+		return err
+	}
 
 	if opts.Commit != "" {
 		h := plumbing.NewHash(opts.Commit)
@@ -189,6 +428,8 @@ func (repo *Repo) audit() error {
 
 		totalCommits = totalCommits + 1
 		repo.numCommits = 1
+		setProgressRef("commit " + opts.Commit)
+		commitWalked(opts.Commit)
 		return repo.auditSingleCommit(c)
 	} else if opts.Branch != "" {
 		refs, err := repo.repository.Storer.IterReferences()
@@ -213,9 +454,35 @@ func (repo *Repo) audit() error {
 			}
 			return nil
 		})
-	} else {
+	} else if opts.CommitFrom != "" || opts.CommitTo != "" {
+		to, rangeExcluded, err := repo.commitRange()
+		if err != nil {
+			return err
+		}
 		logOpts = git.LogOptions{
-			All: true,
+			From: to,
+		}
+		excluded = rangeExcluded
+	} else {
+		tips, err := repo.refTips()
+		if err != nil {
+			return err
+		}
+		if !opts.selectsRefs() && len(tips) <= refBatch {
+			logOpts = git.LogOptions{
+				All: true,
+			}
+		} else if len(tips) == 0 {
+			log.Infof("no refs of %s selected", repo.name)
+			repo.duration = time.Since(start)
+			return nil
+		} else {
+			// walk the first ref, the remaining ones are walked after it
+			logOpts = git.LogOptions{
+				From: tips[0],
+			}
+			extraTips = tips[1:]
+			walkedRefs = len(tips)
 		}
 	}
 
@@ -224,6 +491,32 @@ func (repo *Repo) audit() error {
 	if err != nil {
 		return err
 	}
+	if opts.IncludeReflog && repo.path != "" {
+		reflogTips, err := reflogHashes(repo.path)
+		if err != nil {
+			return err
+		}
+		extraTips = append(extraTips, reflogTips...)
+	}
+	if opts.IncludeUnreachable {
+		danglingTips, err := commitHashes(repo.repository)
+		if err != nil {
+			return err
+		}
+		extraTips = append(extraTips, danglingTips...)
+	}
+	if len(extraTips) != 0 {
+		iter := newExtraCommitIter(repo, cIter, extraTips)
+		if walkedRefs > refBatch {
+			iter.onTip = func(tip int) {
+				if tip%refBatch == 0 && tip < walkedRefs {
+					log.Infof("walked %d of %d refs of %s", tip, walkedRefs, repo.name)
+					setProgressRef(fmt.Sprintf("refs %d-%d of %d", tip+1, tip+refBatch, walkedRefs))
+				}
+			}
+		}
+		cIter = iter
+	}
 
 	if opts.Threads != 0 {
 		threads = opts.Threads
@@ -233,21 +526,59 @@ func (repo *Repo) audit() error {
 	}
 	semaphore = make(chan bool, threads)
 
+	switch {
+	case opts.Branch != "":
+		setProgressRef(opts.Branch)
+	case opts.RefShard != "":
+		setProgressRef("ref shard " + opts.RefShard)
+	case walkedRefs > refBatch:
+		setProgressRef(fmt.Sprintf("refs 1-%d of %d", refBatch, walkedRefs))
+	case walkedRefs != 0:
+		setProgressRef(fmt.Sprintf("%d selected refs", walkedRefs))
+	case opts.CommitFrom != "" || opts.CommitTo != "":
+		setProgressRef("commits " + opts.CommitFrom + ".." + opts.CommitTo)
+	default:
+		setProgressRef("all refs")
+	}
+	// the files of the grafted commits of shallow clones, e.g. of --clone-depth, are
+	// audited as they are, since their parents are missing
+	grafted := make(map[plumbing.Hash]bool)
+	if shallow, err := repo.repository.Storer.Shallow(); err == nil {
+		for _, h := range shallow {
+			grafted[h] = true
+		}
+	}
 	err = cIter.ForEach(func(c *object.Commit) error {
 		if c == nil || (opts.Depth != 0 && commitCount == opts.Depth) {
 			return storer.ErrStop
 		}
+		if err := scanCanceled(); err != nil {
+			return err
+		}
+		if isInterrupted() {
+			// commits being audited finish, so their leaks are reported
+			return storer.ErrStop
+		}
+		if excluded[c.Hash] {
+			return nil
+		}
+		commitWalked(c.Hash.String())
 
-		if config.WhiteList.commits[c.Hash.String()] {
-			log.Infof("skipping commit: %s\n", c.Hash.String())
+		if wl := config.WhiteList.commits[c.Hash.String()]; wl != nil {
+			log.Infof("skipping commit: %s%s\n", c.Hash.String(), wl.describe())
+			return nil
+		}
+		// skipped before computing the diff, bot commits are often huge
+		if wl := whitelistedCommit(c); wl != nil {
+			log.Debugf("skipping commit: %s (matched regex '%s'%s)", c.Hash.String(), wl.String(), wl.describe())
 			return nil
 		}
 
-		// commits w/o parent (root of git the git ref)
-		if len(c.ParentHashes) == 0 {
+		// commits w/o parent (root of git the git ref), or whose parents were not fetched
+		if len(c.ParentHashes) == 0 || grafted[c.Hash] {
 			commitCount = commitCount + 1
 			totalCommits = totalCommits + 1
-			err := repo.auditSingleCommit(c)
+			err := repo.auditCommitFiles(c)
 			if err != nil {
 				return err
 			}
@@ -263,26 +594,27 @@ func (repo *Repo) audit() error {
 			semaphore <- true
 			go func(c *object.Commit, parent *object.Commit) {
 				var (
-					filePath string
-					skipFile bool
+					filePath     string
+					suppressedBy string
 				)
+				commitTrace := startTrace("commit audit", walkTrace.id()).set("commit", c.Hash.String())
 				defer func() {
+					commitTrace.finish()
 					commitWg.Done()
 					<-semaphore
 					if r := recover(); r != nil {
 						log.Warnf("recovering from panic on commit %s, likely large diff causing panic", c.Hash.String())
+						degrade()
 					}
 				}()
 				patch, err := c.Patch(parent)
 				if err != nil {
 					log.Warnf("problem generating patch for commit: %s\n", c.Hash.String())
+					degrade()
 					return
 				}
 				for _, f := range patch.FilePatches() {
-					if f.IsBinary() {
-						continue
-					}
-					skipFile = false
+					suppressedBy = ""
 					from, to := f.Files()
 					filePath = "???"
 					if from != nil {
@@ -290,56 +622,69 @@ func (repo *Repo) audit() error {
 					} else if to != nil {
 						filePath = to.Path()
 					}
-
-					for _, fr := range config.FileRules {
-						for _, r := range fr.fileTypes {
-							if r.FindString(filePath) != "" {
-								commitInfo := &Commit{
-									repoName: repo.name,
-									filePath: filePath,
-									sha:      c.Hash.String(),
-									author:   c.Author.Name,
-									email:    c.Author.Email,
-									message:  strings.Replace(c.Message, "\n", " ", -1),
-									date:     c.Author.When,
-								}
-								leak := *newLeak("N/A", fmt.Sprintf("filetype %s found", r.String()), r.String(), fr, commitInfo)
-								mutex.Lock()
-								repo.leaks = append(repo.leaks, leak)
-								mutex.Unlock()
-							}
-						}
+					fileCommit := &Commit{
+						repoName:      repo.name,
+						filePath:      filePath,
+						sha:           c.Hash.String(),
+						author:        c.Author.Name,
+						email:         c.Author.Email,
+						message:       strings.Replace(c.Message, "\n", " ", -1),
+						date:          c.Author.When,
+						committerDate: c.Committer.When,
 					}
-
-					for _, re := range config.WhiteList.files {
-						if re.FindString(filePath) != "" {
-							log.Debugf("skipping whitelisted file (matched regex '%s'): %s", re.String(), filePath)
-							skipFile = true
-							break
-						}
+					if skipWhitelistedFile(fileCommit) {
+						continue
+					}
+					suppressedBy = fileCommit.suppressedBy
+					// file rules report binary files too, like keystores
+					repo.auditFileRules(fileCommit)
+					if from != nil && repo.auditArchive(fileCommit, repo.blobOpener(from.Hash())) {
+						continue
 					}
-					if skipFile {
+					if f.IsBinary() {
 						continue
 					}
 					chunks := f.Chunks()
+					if skipLargeFile(fileCommit, patchFileSize(chunks)) {
+						continue
+					}
+					// fromLine and toLine are the line numbers of the next line of the
+					// file in c and in its parent
+					fromLine, toLine := 1, 1
 					for _, chunk := range chunks {
+						startLine, numLines := 0, chunkLines(chunk.Content())
+						switch chunk.Type() {
+						case diffType.Equal:
+							fromLine += numLines
+							toLine += numLines
+						case diffType.Delete:
+							startLine = fromLine
+							fromLine += numLines
+						case diffType.Add:
+							startLine = toLine
+							toLine += numLines
+						}
 						if chunk.Type() == diffType.Add || chunk.Type() == diffType.Delete {
-							diff := &Commit{
-								repoName: repo.name,
-								filePath: filePath,
-								content:  chunk.Content(),
-								sha:      c.Hash.String(),
-								author:   c.Author.Name,
-								email:    c.Author.Email,
-								message:  strings.Replace(c.Message, "\n", " ", -1),
-								date:     c.Author.When,
+							// the patch is from c to its parent, lines added by c are deleted
+							blob := ""
+							if chunk.Type() == diffType.Delete && from != nil {
+								blob = from.Hash().String()
 							}
-							chunkLeaks := inspect(diff)
-							for _, leak := range chunkLeaks {
-								mutex.Lock()
-								repo.leaks = append(repo.leaks, leak)
-								mutex.Unlock()
+							diff := &Commit{
+								repoName:      repo.name,
+								filePath:      filePath,
+								content:       chunk.Content(),
+								sha:           c.Hash.String(),
+								author:        c.Author.Name,
+								email:         c.Author.Email,
+								message:       strings.Replace(c.Message, "\n", " ", -1),
+								date:          c.Author.When,
+								committerDate: c.Committer.When,
+								suppressedBy:  suppressedBy,
+								blob:          blob,
+								startLine:     startLine,
 							}
+							repo.inspect(diff)
 						}
 					}
 				}
@@ -352,18 +697,54 @@ func (repo *Repo) audit() error {
 	})
 
 	commitWg.Wait()
+	if err := scanCanceled(); err != nil {
+		return err
+	}
+	if opts.DedupeRefs {
+		repo.dedupeRefs()
+	}
+	if opts.IncludeUnreachable {
+		if err := repo.auditUnreachableBlobs(); err != nil {
+			log.Warnf("unable to audit unreachable blobs of %s: %v", repo.name, err)
+			degrade()
+		}
+	}
 	repo.numCommits = commitCount
-	repo.auditDuration = durafmt.Parse(time.Now().Sub(start)).String()
+	repo.duration = time.Since(start)
 
 	return nil
 }
 
-func (repo *Repo) auditSingleCommit(c *object.Commit) error {
-	fIter, err := c.Files()
-	if err != nil {
-		return err
+// chunkLines returns the number of lines of the content of a chunk of a patch. The last
+// line of a file may lack a newline.
+func chunkLines(content string) int {
+	n := strings.Count(content, "\n")
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		n++
 	}
+	return n
+}
 
+// patchFileSize returns the size of the larger version of the file of a patch
+func patchFileSize(chunks []diffType.Chunk) int64 {
+	var equal, deleted, added int64
+	for _, chunk := range chunks {
+		switch chunk.Type() {
+		case diffType.Equal:
+			equal += int64(len(chunk.Content()))
+		case diffType.Delete:
+			deleted += int64(len(chunk.Content()))
+		case diffType.Add:
+			added += int64(len(chunk.Content()))
+		}
+	}
+	if added > deleted {
+		return equal + added
+	}
+	return equal + deleted
+}
+
+func (repo *Repo) auditSingleCommit(c *object.Commit) error {
 	// If current commit has parents then search for leaks in tree change,
 	// that means scan in changed/modified files from one commit to another.
 	if len(c.ParentHashes) > 0 {
@@ -374,56 +755,178 @@ func (repo *Repo) auditSingleCommit(c *object.Commit) error {
 		return repo.auditTreeChange(prevCommitObject, c)
 	}
 
-	// Scan for leaks in files related to current commit
+	return repo.auditCommitFiles(c)
+}
+
+// auditCommitFiles audits every file of the tree of commit c
+func (repo *Repo) auditCommitFiles(c *object.Commit) error {
+	fIter, err := c.Files()
+	if err != nil {
+		return err
+	}
 	err = fIter.ForEach(func(f *object.File) error {
+		diff := &Commit{
+			repoName:      repo.name,
+			filePath:      f.Name,
+			sha:           c.Hash.String(),
+			author:        c.Author.Name,
+			email:         c.Author.Email,
+			message:       strings.Replace(c.Message, "\n", " ", -1),
+			date:          c.Author.When,
+			committerDate: c.Committer.When,
+			blob:          f.Hash.String(),
+			startLine:     1,
+		}
+		if skipWhitelistedFile(diff) {
+			return nil
+		}
+		repo.auditFileRules(diff)
+		if repo.auditArchive(diff, f.Reader) {
+			return nil
+		}
 		bin, err := f.IsBinary()
 		if bin || err != nil {
 			return nil
 		}
-		for _, re := range config.WhiteList.files {
-			if re.FindString(f.Name) != "" {
-				log.Debugf("skipping whitelisted file (matched regex '%s'): %s", re.String(), f.Name)
-				return nil
-			}
-		}
-		content, err := f.Contents()
+		r, err := f.Reader()
 		if err != nil {
 			return nil
 		}
-		diff := &Commit{
-			repoName: repo.name,
-			filePath: f.Name,
-			content:  content,
-			sha:      c.Hash.String(),
-			author:   c.Author.Name,
-			email:    c.Author.Email,
-			message:  strings.Replace(c.Message, "\n", " ", -1),
-			date:     c.Author.When,
-		}
-		fileLeaks := inspect(diff)
-		mutex.Lock()
-		repo.leaks = append(repo.leaks, fileLeaks...)
-		mutex.Unlock()
+		defer r.Close()
+		if err := repo.inspectReader(r, f.Size, diff); err != nil {
+			log.Debugf("unable to read %s of %s: %v", f.Name, c.Hash.String(), err)
+		}
 		return nil
 	})
 	return err
 }
 
+// AuditStats are statistics about the audit of a repo
+type AuditStats struct {
+	// Commits is the number of commits audited
+	Commits int64
+	// Bytes is the size of the diffs and files inspected
+	Bytes int64
+	// Duration is how long the audit took
+	Duration time.Duration
+	// RulesFired is the number of leaks found by each rule, by rule description
+	RulesFired map[string]int
+}
+
+// Stats returns statistics about the audit of the repo
+func (repo *Repo) Stats() AuditStats {
+	stats := AuditStats{
+		Commits:    repo.numCommits,
+		Bytes:      atomic.LoadInt64(&repo.numBytes),
+		Duration:   repo.duration,
+		RulesFired: make(map[string]int),
+	}
+	for _, leak := range repo.Leaks() {
+		stats.RulesFired[leak.Rule]++
+	}
+	return stats
+}
+
+// Leaks returns the leaks found by the audit of the repo
+func (repo *Repo) Leaks() []Leak {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return append([]Leak(nil), repo.leaks...)
+}
+
+// remoteURLs returns the url the repo was cloned from and the urls of its remotes
+func (repo *Repo) remoteURLs() []string {
+	urls := []string{repo.url}
+	if repo.repository == nil {
+		return urls
+	}
+	remotes, err := repo.repository.Remotes()
+	if err != nil {
+		return urls
+	}
+	for _, remote := range remotes {
+		urls = append(urls, remote.Config().URLs...)
+	}
+	return urls
+}
+
+// inspect inspects the content of commit and records the leaks found
+func (repo *Repo) inspect(commit *Commit) {
+	atomic.AddInt64(&repo.numBytes, int64(len(commit.content)))
+	leaks := inspect(commit)
+	mutex.Lock()
+	repo.leaks = append(repo.leaks, leaks...)
+	mutex.Unlock()
+	repo.inspectLFS(commit)
+}
+
+// auditFileRules reports the file of commit as a leak for each filetype or path of a file
+// rule matching its path, whatever its content. Key material like keystores is binary,
+// no regex sees it. Callers skip whitelisted files first, with skipWhitelistedFile.
+func (repo *Repo) auditFileRules(commit *Commit) {
+	for _, fr := range config.FileRules {
+		for _, r := range fr.FileTypes {
+			if r.FindString(commit.filePath) == "" || ignoredLeak(commit.sha, commit.filePath, fr.Description) != nil ||
+				fr.AllowedFile(commit.filePath) != nil || config.ruleCommits[fr][commit.sha] != nil {
+				continue
+			}
+			if opts.CountOnly {
+				countMatch(repo.name, fr.Description)
+				continue
+			}
+			info, offender := fmt.Sprintf("filetype %s found", r.String()), r.String()
+			if glob, ok := config.pathGlobs[r]; ok {
+				info, offender = fmt.Sprintf("path %s found", glob), glob
+			}
+			leak := *newLeak("N/A", info, offender, fr, commit)
+			mutex.Lock()
+			repo.leaks = append(repo.leaks, leak)
+			mutex.Unlock()
+		}
+	}
+}
+
 func (repo *Repo) report() {
+	if opts.CountOnly {
+		repo.trace.finish()
+		repo.trace = nil
+		repoReported(repo)
+		reportCounts(repo.name)
+		return
+	}
+	repo.leaks = filterBaseline(repo.leaks)
+	repo.recordRemoteURL()
+	repo.trace.set("commits", strconv.FormatInt(repo.numCommits, 10)).finish()
+	repo.trace = nil
+	repoReported(repo)
+	stats := repo.Stats()
+	repo.recordAttestSubject(stats.RulesFired)
+	repo.recordHead()
+	duration := durafmt.Parse(stats.Duration).String()
 	if len(repo.leaks) != 0 {
-		log.Warnf("%d leaks detected. %d commits inspected in %s", len(repo.leaks), repo.numCommits, repo.auditDuration)
+		log.Warnf("%d leaks detected. %d commits (%s) inspected in %s", len(repo.leaks), stats.Commits, formatSize(stats.Bytes), duration)
 	} else {
-		log.Infof("No leaks detected. %d commits inspected in %s", repo.numCommits, repo.auditDuration)
+		log.Infof("No leaks detected. %d commits (%s) inspected in %s", stats.Commits, formatSize(stats.Bytes), duration)
+	}
+	var rules []string
+	for rule := range stats.RulesFired {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		log.Infof("%d leaks detected by rule %s", stats.RulesFired[rule], rule)
+	}
+	if leakStream != nil {
+		// streamed already, see leakStream
+		mutex.Lock()
+		repo.leaks = nil
+		mutex.Unlock()
 	}
 }
 
 // auditTreeChange will search for leaks in changed/modified files from one
 // commit to another
 func (repo *Repo) auditTreeChange(src, dst *object.Commit) error {
-	var (
-		skip bool
-	)
-
 	// Get state of src commit
 	srcState, err := src.Tree()
 	if err != nil {
@@ -451,42 +954,39 @@ func (repo *Repo) auditTreeChange(src, dst *object.Commit) error {
 
 		// Get list of involved files
 		_, to, err := change.Files()
-		bin, err := to.IsBinary()
-		if bin || err != nil {
+		diff := &Commit{
+			repoName:      repo.name,
+			filePath:      to.Name,
+			sha:           dst.Hash.String(),
+			author:        dst.Author.Name,
+			email:         dst.Author.Email,
+			message:       strings.Replace(dst.Message, "\n", " ", -1),
+			date:          dst.Author.When,
+			committerDate: dst.Committer.When,
+			blob:          to.Hash.String(),
+			startLine:     1,
+		}
+		if skipWhitelistedFile(diff) {
 			continue
 		}
-
-		for _, re := range config.WhiteList.files {
-			if re.FindString(to.Name) != "" {
-				log.Debugf("skipping whitelisted file (matched regex '%s'): %s", re.String(), to.Name)
-				skip = true
-			}
+		repo.auditFileRules(diff)
+		if repo.auditArchive(diff, to.Reader) {
+			continue
 		}
-
-		if skip {
-			skip = false
+		bin, err := to.IsBinary()
+		if bin || err != nil {
 			continue
 		}
 
-		content, err := to.Contents()
+		r, err := to.Reader()
+		if err != nil {
+			return err
+		}
+		err = repo.inspectReader(r, to.Size, diff)
+		r.Close()
 		if err != nil {
 			return err
 		}
-
-		diff := &Commit{
-			repoName: repo.name,
-			filePath: to.Name,
-			content:  content,
-			sha:      dst.Hash.String(),
-			author:   dst.Author.Name,
-			email:    dst.Author.Email,
-			message:  strings.Replace(dst.Message, "\n", " ", -1),
-			date:     dst.Author.When,
-		}
-		fileLeaks := inspect(diff)
-		mutex.Lock()
-		repo.leaks = append(repo.leaks, fileLeaks...)
-		mutex.Unlock()
 	}
 	return nil
 
@@ -0,0 +1,124 @@
+package gitleaks
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// revokedSecrets are the sha256 hashes of the secrets of --revoked-feed, nil without it
+var revokedSecrets map[string]bool
+
+// loadRevokedFeed loads the hashes of revoked secrets of --revoked-feed. Feeds are a url
+// or file listing the hex sha256 of a revoked secret per line, optionally prefixed by
+// sha256:, as reported by --mask=hash. Lines starting with # are comments. A .json feed
+// is a report of leaks written with --mask=hash, e.g. of the leaks rotated in a past
+// incident, whose offenders are the hashes.
+func loadRevokedFeed(feed string) (map[string]bool, error) {
+	revoked := make(map[string]bool)
+	if strings.HasSuffix(feed, ".json") && !isFeedURL(feed) {
+		leaks, _, err := readReport(feed)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load revoked feed: %v", err)
+		}
+		for _, leak := range leaks {
+			if hash, ok := revokedHash(leak.Offender); ok {
+				revoked[hash] = true
+			}
+		}
+		if len(revoked) == 0 && len(leaks) != 0 {
+			return nil, fmt.Errorf("revoked feed %s has no hashed offenders, it must be written with --mask=hash", feed)
+		}
+		log.Debugf("loaded %d revoked secrets from %s", len(revoked), feed)
+		return revoked, nil
+	}
+
+	content, err := readRevokedFeed(feed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load revoked feed: %v", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, ok := revokedHash(strings.Fields(line)[0])
+		if !ok {
+			return nil, fmt.Errorf("line %d of revoked feed %s is not a sha256 hash", n, feedName(feed))
+		}
+		revoked[hash] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to load revoked feed: %v", err)
+	}
+	log.Debugf("loaded %d revoked secrets from %s", len(revoked), feedName(feed))
+	return revoked, nil
+}
+
+// readRevokedFeed reads the feed at a url or path
+func readRevokedFeed(feed string) ([]byte, error) {
+	if !isFeedURL(feed) {
+		return ioutil.ReadFile(feed)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(feed)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func isFeedURL(feed string) bool {
+	return strings.HasPrefix(feed, "http://") || strings.HasPrefix(feed, "https://")
+}
+
+// feedName returns the path of a feed, or its url without credentials, for logs
+func feedName(feed string) string {
+	if isFeedURL(feed) {
+		return sinkURL(feed)
+	}
+	return feed
+}
+
+// revokedHash returns the lower case hex sha256 of an entry of a revoked feed
+func revokedHash(entry string) (string, bool) {
+	hash := strings.ToLower(strings.TrimPrefix(entry, "sha256:"))
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+		return "", false
+	}
+	return hash, true
+}
+
+// isRevoked returns true if offender, or the credential of a structured offender like a
+// connection string, is in --revoked-feed. The credential is what --mask=hash hashes.
+func isRevoked(offender string) bool {
+	if revokedSecrets == nil {
+		return false
+	}
+	secrets := []string{offender}
+	for _, re := range structuredSecrets {
+		for _, groups := range re.FindAllStringSubmatch(offender, -1) {
+			secrets = append(secrets, groups[2])
+		}
+	}
+	for _, secret := range secrets {
+		sum := sha256.Sum256([]byte(secret))
+		if revokedSecrets[hex.EncodeToString(sum[:])] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package gitleaks
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// runID identifies a gitleaks run in log lines, leaks and reports
+	runID string
+	// currentSpan identifies the audit of the repo currently being audited
+	currentSpan atomic.Value
+)
+
+// newRunID returns a random (version 4) UUID
+func newRunID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newSpanID returns a random 8 byte hex id
+func newSpanID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// spanID returns the span of the repo currently being audited, empty between audits
+func spanID() string {
+	span, _ := currentSpan.Load().(string)
+	return span
+}
+
+// startSpan assigns the repo a span id, if it does not have one yet, and makes it the
+// current span so log lines and leaks can be traced back to the audit of this repo
+func (repo *Repo) startSpan() {
+	if repo.spanID == "" {
+		repo.spanID = newSpanID()
+	}
+	if repo.trace == nil {
+		repo.trace = startTrace("repo", "").set("repo", repo.name)
+		if repo.trace != nil {
+			repo.trace.spanID = repo.spanID
+		}
+	}
+	currentSpan.Store(repo.spanID)
+	progress.repo.Store(repo)
+}
+
+// idHook adds the run id and current span id to every log line
+type idHook struct{}
+
+// Levels implements logrus.Hook
+func (idHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (idHook) Fire(entry *log.Entry) error {
+	if runID != "" {
+		entry.Data["run"] = runID
+	}
+	if span := spanID(); span != "" {
+		entry.Data["span"] = span
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package gitleaks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// ScannerConfig configures a Scanner
+type ScannerConfig struct {
+	// ConfigPath is the path of the gitleaks config, GITLEAKS_CONFIG or the default
+	// config if empty
+	ConfigPath string
+	// Args are options of every scan as on the command line, like --redact or
+	// --depth=100. Scans return their leaks, options shaping reports like --report,
+	// --sink or --count-only are rejected.
+	Args []string
+}
+
+// Scanner audits repos and diffs for Go programs embedding gitleaks, returning their
+// leaks instead of writing reports. Scans of all Scanners run one at a time, and not
+// alongside the audits of gitleaks serve, as audits share the state of the package.
+// Logs are those of the standard logrus logger.
+type Scanner struct {
+	args []string
+}
+
+// scanContext cancels the scan running, checked between commits. Nil outside of the
+// scans of Scanners.
+var scanContext context.Context
+
+// NewScanner returns a Scanner with the options of config
+func NewScanner(config ScannerConfig) (*Scanner, error) {
+	s := &Scanner{args: append([]string{}, config.Args...)}
+	if config.ConfigPath != "" {
+		if _, err := os.Stat(config.ConfigPath); err != nil {
+			return nil, fmt.Errorf("no gitleaks config at %s", config.ConfigPath)
+		}
+		s.args = append(s.args, "--config="+config.ConfigPath)
+	}
+	// invalid options fail now rather than on every scan
+	if _, err := s.scanOptions("--stdin"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ScanRepo audits the history of repo, a local repo if it is a directory or else the url
+// of a remote repo to clone, and returns its leaks
+func (s *Scanner) ScanRepo(ctx context.Context, repo string) ([]Leak, error) {
+	target := "--repo=" + repo
+	if info, err := os.Stat(repo); err == nil && info.IsDir() {
+		target = "--repo-path=" + repo
+	}
+	return s.scan(ctx, nil, target)
+}
+
+// ScanDiff audits the text of r, like --stdin. Of unified diffs, e.g. of git diff, only
+// the added lines are audited.
+func (s *Scanner) ScanDiff(ctx context.Context, r io.Reader) ([]Leak, error) {
+	return s.scan(ctx, r, "--stdin")
+}
+
+// scanOptions returns the options of a scan of target, the flag selecting what it audits.
+// It runs without auditMu, while other audits may run, so it only checks the options and
+// leaves the state of the package to the audit.
+func (s *Scanner) scanOptions(target string) (*Options, error) {
+	var scanOpts Options
+	if _, err := flags.NewParser(&scanOpts, flags.None).ParseArgs(append(append([]string{}, s.args...), target)); err != nil {
+		return nil, err
+	}
+	switch {
+	case scanOpts.Report != "" || scanOpts.ReportFormat != "" || scanOpts.ReportTemplate != "":
+		return nil, fmt.Errorf("--report, --report-format and --report-template can not be used with a Scanner, scans return their leaks")
+	case len(scanOpts.Sinks) != 0:
+		return nil, fmt.Errorf("--sink can not be used with a Scanner, scans return their leaks")
+	case scanOpts.CountOnly || scanOpts.MergeReports != "":
+		return nil, fmt.Errorf("--count-only and --merge-reports can not be used with a Scanner, scans return leaks")
+	case scanOpts.CSVColumns != "" || scanOpts.CSVNoLine:
+		return nil, fmt.Errorf("--csv-columns and --csv-no-line can not be used with a Scanner, scans return their leaks")
+	}
+	if err := scanOpts.guard(); err != nil {
+		return nil, err
+	}
+	return &scanOpts, nil
+}
+
+// scan runs the audit of target, reading r as stdin if it is not nil
+func (s *Scanner) scan(ctx context.Context, r io.Reader, target string) ([]Leak, error) {
+	scanOpts, err := s.scanOptions(target)
+	if err != nil {
+		return nil, err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r != nil {
+		stdin = r
+		defer func() { stdin = os.Stdin }()
+	}
+	scanContext = ctx
+	defer func() { scanContext = nil }()
+
+	_, leaks, err := collectScan(scanOpts)
+	if err != nil {
+		return nil, err
+	}
+	return leaks, nil
+}
+
+// scanCanceled returns the error of the context of the scan running if it is canceled
+func scanCanceled() error {
+	if scanContext == nil {
+		return nil
+	}
+	return scanContext.Err()
+}
@@ -0,0 +1,416 @@
+package gitleaks
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServeOptions are the options of gitleaks serve
+type ServeOptions struct {
+	Listen     string `long:"listen" default:":8080" description:"address to listen on"`
+	ConfigPath string `long:"config" description:"path to the gitleaks config of all scans"`
+	MaxQueue   int    `long:"max-queue" default:"100" description:"maximum number of queued scans, further scans are refused until the queue drains"`
+	MaxScans   int    `long:"max-scans" default:"1000" description:"number of finished scans whose results are kept"`
+	Disk       bool   `long:"disk" description:"clone repos to disk instead of memory"`
+	GithubURL  string `long:"github-url" default:"https://api.github.com/" description:"GitHub API Base URL of the commit statuses of github webhook scans, use for GitHub Enterprise"`
+	PublicURL  string `long:"public-url" description:"url of this server, linked from the commit statuses of github and azure devops webhook scans. The links are to GET /scan/{id}, which requires the bearer token of GITLEAKS_SERVE_TOKEN, so only clients holding it can open them"`
+	AzdevURL   string `long:"azdev-url" description:"Azure DevOps organization url of the pull request statuses of azure devops service hook scans, e.g. https://dev.azure.com/org"`
+	Log        string `short:"l" long:"log" description:"log level"`
+
+	// InsecureNoAuth serves POST /scan to anyone who can reach the server, which then
+	// clones whatever url they send
+	InsecureNoAuth bool `long:"insecure-no-auth" description:"serve the api without GITLEAKS_SERVE_TOKEN, letting anyone reaching the server scan any url it can reach"`
+}
+
+// scanRequest is the body of POST /scan. Only repo_url is required.
+type scanRequest struct {
+	RepoURL    string `json:"repo_url"`
+	Branch     string `json:"branch,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	CommitFrom string `json:"commit_from,omitempty"`
+	CommitTo   string `json:"commit_to,omitempty"`
+	Depth      int64  `json:"depth,omitempty"`
+}
+
+// scan is an audit queued by POST /scan, returned by GET /scan/{id}
+type scan struct {
+	ID       string     `json:"id"`
+	RepoURL  string     `json:"repo_url"`
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Failing is the number of leaks which fail the audit, e.g. with --fail-on
+	Failing int    `json:"failing"`
+	Leaks   []Leak `json:"leaks"`
+
+	opts *Options
+	// status is set with the result of the scan, for scans of webhooks
+	status statusTarget
+}
+
+// statusTarget is where the result of a scan of a webhook is reported, e.g. the commit
+// status of a github commit
+type statusTarget interface {
+	setStatus(s *scanServer, sc *scan)
+}
+
+const (
+	scanQueued  = "queued"
+	scanRunning = "running"
+	scanDone    = "done"
+	scanFailed  = "failed"
+)
+
+// scanServer queues scans and runs them one at a time, since audits share the state
+// of the package
+type scanServer struct {
+	sopts ServeOptions
+	queue chan *scan
+	// audit runs the audit of a scan, returning its failing count and leaks
+	audit func(*Options) (int, []Leak, error)
+
+	mu       sync.Mutex
+	scans    map[string]*scan
+	finished []string
+}
+
+// Serve is the entry point for gitleaks serve. It exposes a REST API queueing audits
+// of repos, POST /scan, and returning their results, GET /scan/{id}. Requests must
+// carry the bearer token GITLEAKS_SERVE_TOKEN, which is required unless
+// --insecure-no-auth is set. GitHub webhooks are
+// received at POST /github/webhook, Azure DevOps service hooks at POST /azdev/webhook.
+func Serve(args []string) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	return serve(args, stop, nil)
+}
+
+// serve runs gitleaks serve with args until stop receives a signal. Logs are written to
+// logs without colors if set, e.g. to the log file of gitleaks service run.
+func serve(args []string, stop <-chan os.Signal, logs io.Writer) error {
+	var sopts ServeOptions
+	parser := flags.NewParser(&sopts, flags.Default&^flags.PrintErrors)
+	parser.Usage = "serve [OPTIONS]"
+	if _, err := parser.ParseArgs(args); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	(&Options{Log: sopts.Log}).setLogs()
+	if logs != nil {
+		log.SetOutput(logs)
+		log.SetFormatter(&log.TextFormatter{DisableColors: true, FullTimestamp: true})
+	}
+	if sopts.ConfigPath != "" {
+		if _, err := os.Stat(sopts.ConfigPath); err != nil {
+			return fmt.Errorf("no gitleaks config at %s", sopts.ConfigPath)
+		}
+	}
+	if sopts.MaxQueue < 1 || sopts.MaxScans < 1 {
+		return fmt.Errorf("--max-queue and --max-scans must be at least 1")
+	}
+	if os.Getenv("GITLEAKS_SERVE_TOKEN") == "" {
+		if !sopts.InsecureNoAuth {
+			return fmt.Errorf("set GITLEAKS_SERVE_TOKEN, the bearer token of the api, or --insecure-no-auth to serve it to anyone")
+		}
+		log.Warn("serving the api without GITLEAKS_SERVE_TOKEN, anyone reaching the server can scan any url it can reach")
+	}
+
+	s := newScanServer(sopts)
+	go s.work()
+	server := &http.Server{
+		Addr:    sopts.Listen,
+		Handler: s.handler(),
+		// requests are small and answered right away, scans run in the background, so
+		// slow or idle clients are cut off rather than holding connections open
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+		WriteTimeout:      serveWriteTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+	go func() {
+		<-stop
+		log.Info("shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	log.Infof("serving the gitleaks api on %s", sopts.Listen)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// timeouts of the connections of gitleaks serve
+const (
+	serveReadHeaderTimeout = 10 * time.Second
+	serveReadTimeout       = 30 * time.Second
+	serveWriteTimeout      = 30 * time.Second
+	serveIdleTimeout       = 2 * time.Minute
+)
+
+func newScanServer(sopts ServeOptions) *scanServer {
+	return &scanServer{
+		sopts: sopts,
+		queue: make(chan *scan, sopts.MaxQueue),
+		audit: runScan,
+		scans: make(map[string]*scan),
+	}
+}
+
+func (s *scanServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scan", s.authorize(s.createScan))
+	mux.HandleFunc("/scan/", s.authorize(s.getScan))
+	// webhooks are authenticated by their signature
+	mux.HandleFunc("/github/webhook", s.githubWebhook)
+	mux.HandleFunc("/azdev/webhook", s.azdevWebhook)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// authorize rejects requests without the bearer token GITLEAKS_SERVE_TOKEN, if set.
+// Serve refuses to start without it unless --insecure-no-auth is set.
+func (s *scanServer) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("GITLEAKS_SERVE_TOKEN")
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// createScan handles POST /scan
+func (s *scanServer) createScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use POST /scan")
+		return
+	}
+	var req scanRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid scan request: %v", err))
+		return
+	}
+	s.queueScan(w, req, nil)
+}
+
+// queueScan queues the scan of req and writes it to w. The status of target is set
+// with the result of the scan, if not nil.
+func (s *scanServer) queueScan(w http.ResponseWriter, req scanRequest, target statusTarget) {
+	sc, code, err := s.enqueue(req, target)
+	if err != nil {
+		writeAPIError(w, code, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/scan/"+sc.ID)
+	s.writeScan(w, http.StatusAccepted, sc)
+}
+
+// enqueue queues the scan of req. On errors it returns the http status of the error.
+func (s *scanServer) enqueue(req scanRequest, target statusTarget) (*scan, int, error) {
+	scanOpts, err := s.scanOptions(req)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	sc := &scan{
+		ID:      newRunID(),
+		RepoURL: req.RepoURL,
+		Status:  scanQueued,
+		Created: time.Now().UTC(),
+		opts:    scanOpts,
+		status:  target,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- sc:
+		s.scans[sc.ID] = sc
+	default:
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("scan queue is full, retry later")
+	}
+	log.Infof("queued scan %s of %s", sc.ID, sc.RepoURL)
+	return sc, 0, nil
+}
+
+// getScan handles GET /scan/{id}
+func (s *scanServer) getScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use GET /scan/{id}")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/scan/")
+	s.mu.Lock()
+	sc, ok := s.scans[id]
+	s.mu.Unlock()
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("no scan %s", id))
+		return
+	}
+	s.writeScan(w, http.StatusOK, sc)
+}
+
+// scanOptions returns the options of the audit of req, as if passed on the command line
+func (s *scanServer) scanOptions(req scanRequest) (*Options, error) {
+	if err := validateScanURL(req.RepoURL); err != nil {
+		return nil, err
+	}
+	// values are joined to their flags, so values starting with a dash are not flags
+	args := []string{"--repo=" + req.RepoURL}
+	if s.sopts.ConfigPath != "" {
+		args = append(args, "--config="+s.sopts.ConfigPath)
+	}
+	if s.sopts.Disk {
+		args = append(args, "--disk")
+	}
+	for flag, value := range map[string]string{
+		"--branch":      req.Branch,
+		"--commit":      req.Commit,
+		"--commit-from": req.CommitFrom,
+		"--commit-to":   req.CommitTo,
+	} {
+		if value != "" {
+			args = append(args, flag+"="+value)
+		}
+	}
+	if req.Depth != 0 {
+		args = append(args, "--depth="+strconv.FormatInt(req.Depth, 10))
+	}
+	var scanOpts Options
+	if _, err := flags.NewParser(&scanOpts, flags.None).ParseArgs(args); err != nil {
+		return nil, err
+	}
+	if err := scanOpts.guard(); err != nil {
+		return nil, err
+	}
+	return &scanOpts, nil
+}
+
+// validateScanURL only accepts remote repos, so callers of the api can not audit the
+// repos and files of the server
+func validateScanURL(repoURL string) error {
+	if strings.HasPrefix(repoURL, "git@") {
+		return nil
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil || repoURL == "" {
+		return fmt.Errorf("invalid repo_url %q", repoURL)
+	}
+	switch u.Scheme {
+	case "https", "http", "ssh", "git":
+		if u.Host != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("repo_url %q must be an https, http, ssh or git url", repoURL)
+}
+
+// work runs the queued scans one at a time
+func (s *scanServer) work() {
+	for sc := range s.queue {
+		started := time.Now().UTC()
+		s.mu.Lock()
+		sc.Status, sc.Started = scanRunning, &started
+		s.mu.Unlock()
+		s.setStatus(sc)
+
+		failing, leaks, err := s.audit(sc.opts)
+
+		finished := time.Now().UTC()
+		s.mu.Lock()
+		sc.Finished = &finished
+		if err != nil {
+			sc.Status, sc.Error = scanFailed, err.Error()
+			log.Warnf("scan %s of %s failed: %v", sc.ID, sc.RepoURL, err)
+		} else {
+			sc.Status, sc.Failing, sc.Leaks = scanDone, failing, leaks
+			log.Infof("scan %s of %s found %d leaks", sc.ID, sc.RepoURL, len(leaks))
+		}
+		// only the results of the latest scans are kept
+		s.finished = append(s.finished, sc.ID)
+		for len(s.finished) > s.sopts.MaxScans {
+			delete(s.scans, s.finished[0])
+			s.finished = s.finished[1:]
+		}
+		s.mu.Unlock()
+		s.setStatus(sc)
+	}
+}
+
+// setStatus reports the state of sc to its status target, if any
+func (s *scanServer) setStatus(sc *scan) {
+	if sc.status != nil {
+		sc.status.setStatus(s, sc)
+	}
+}
+
+// auditMu serializes the audits of Scanners, gitleaks serve, gitleaks bench and
+// --jsonrpc, as audits share the state of the package
+var auditMu sync.Mutex
+
+// runScan runs the audit of scanOpts and returns the leaks of its report
+func runScan(scanOpts *Options) (int, []Leak, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return collectScan(scanOpts)
+}
+
+// collectScan runs the audit of scanOpts with auditMu held and returns the leaks of its
+// report, collected in memory
+func collectScan(scanOpts *Options) (int, []Leak, error) {
+	sink := &memorySink{leaks: []Leak{}}
+	collectSink = sink
+	defer func() { collectSink = nil }()
+
+	failing, err := Run(scanOpts)
+	if err != nil {
+		return 0, nil, err
+	}
+	return failing, sink.leaks, nil
+}
+
+// writeScan writes v, a scan or scans, locked as the worker updates scans
+func (s *scanServer) writeScan(w http.ResponseWriter, status int, v interface{}) {
+	s.mu.Lock()
+	b, err := json.Marshal(v)
+	s.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{message})
+}
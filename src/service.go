@@ -0,0 +1,312 @@
+package gitleaks
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServiceOptions are the options of gitleaks service. The options of gitleaks serve
+// follow --, e.g. gitleaks service install --env-file=/etc/gitleaks/env -- --listen=:8080
+type ServiceOptions struct {
+	Name       string `long:"name" default:"gitleaks" description:"name of the service"`
+	EnvFile    string `long:"env-file" description:"file of KEY=value lines set in the environment of the service, like GITLEAKS_SERVE_TOKEN and GITHUB_TOKEN, readable only by the user of the service"`
+	LogFile    string `long:"log-file" description:"file the logs of the service are written to, /var/log/<name>/<name>.log by default, or %ProgramData%\\<name>\\<name>.log on windows"`
+	LogMaxSize string `long:"log-max-size" default:"10MB" description:"size the log file is rotated at"`
+	LogBackups int    `long:"log-backups" default:"5" description:"number of rotated log files kept, <log-file>.1 being the newest"`
+	UnitDir    string `long:"unit-dir" default:"/etc/systemd/system" description:"directory the systemd unit is installed to, not used on windows"`
+	User       string `long:"user" description:"user the systemd unit runs as, root by default. On windows services run as LocalSystem"`
+}
+
+// Service is the entry point for gitleaks service. install registers gitleaks serve as
+// a service of the system, a systemd unit on linux or a service of the service control
+// manager on windows, and uninstall removes it. run is what the service runs, gitleaks
+// serve with the environment of --env-file and its logs written to a rotated log file,
+// so the scan api can be deployed with the standard tooling of each platform.
+func Service(args []string) error {
+	const usage = "gitleaks service install|uninstall|run [OPTIONS] [-- serve options]"
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", usage)
+	}
+	var svopts ServiceOptions
+	parser := flags.NewParser(&svopts, flags.Default&^flags.PrintErrors)
+	parser.Usage = "service " + args[0] + " [OPTIONS] [-- serve options]"
+	serveArgs, err := parser.ParseArgs(args[1:])
+	if err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	if _, err := parseSize(svopts.LogMaxSize); err != nil {
+		return fmt.Errorf("--log-max-size: %v", err)
+	}
+	if svopts.LogBackups < 0 {
+		return fmt.Errorf("--log-backups must not be negative")
+	}
+	if svopts.LogFile == "" {
+		svopts.LogFile = defaultServiceLogFile(svopts.Name)
+	}
+
+	switch args[0] {
+	case "install":
+		return installServiceCommand(svopts, serveArgs)
+	case "uninstall":
+		return uninstallService(svopts)
+	case "run":
+		return runServiceCommand(svopts, serveArgs)
+	}
+	return fmt.Errorf("no service command %s, usage: %s", args[0], usage)
+}
+
+// installServiceCommand checks the options of the service and installs it, running
+// gitleaks service run with the same options
+func installServiceCommand(svopts ServiceOptions, serveArgs []string) error {
+	var sopts ServeOptions
+	if _, err := flags.NewParser(&sopts, flags.None).ParseArgs(serveArgs); err != nil {
+		return fmt.Errorf("invalid serve options: %v", err)
+	}
+	// the service does not inherit the environment gitleaks service install runs in
+	if svopts.EnvFile != "" {
+		envFile, err := filepath.Abs(svopts.EnvFile)
+		if err != nil {
+			return err
+		}
+		svopts.EnvFile = envFile
+	}
+	if !sopts.InsecureNoAuth {
+		if svopts.EnvFile == "" {
+			return fmt.Errorf("set --env-file to a file setting GITLEAKS_SERVE_TOKEN, or serve the api with -- --insecure-no-auth")
+		}
+		env, err := readEnvFile(svopts.EnvFile)
+		if err != nil {
+			return err
+		}
+		if env["GITLEAKS_SERVE_TOKEN"] == "" {
+			return fmt.Errorf("%s does not set GITLEAKS_SERVE_TOKEN", svopts.EnvFile)
+		}
+	}
+	logFile, err := filepath.Abs(svopts.LogFile)
+	if err != nil {
+		return err
+	}
+	svopts.LogFile = logFile
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find the gitleaks binary: %v", err)
+	}
+	return installService(svopts, exe, serviceRunArgs(svopts, serveArgs))
+}
+
+// serviceRunArgs returns the args of gitleaks service run of a service
+func serviceRunArgs(svopts ServiceOptions, serveArgs []string) []string {
+	args := []string{"service", "run",
+		"--name=" + svopts.Name,
+		"--log-file=" + svopts.LogFile,
+		"--log-max-size=" + svopts.LogMaxSize,
+		"--log-backups=" + strconv.Itoa(svopts.LogBackups),
+	}
+	if svopts.EnvFile != "" {
+		args = append(args, "--env-file="+svopts.EnvFile)
+	}
+	return append(append(args, "--"), serveArgs...)
+}
+
+// runServiceCommand runs gitleaks serve as the service, until it is stopped. Errors
+// are logged to the log file too, as the service may have no stderr.
+func runServiceCommand(svopts ServiceOptions, serveArgs []string) (err error) {
+	maxSize, _ := parseSize(svopts.LogMaxSize)
+	logs, err := newRotatingFile(svopts.LogFile, maxSize, svopts.LogBackups)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(logs)
+	defer func() {
+		if err != nil {
+			log.Error(err)
+		}
+		log.SetOutput(os.Stderr)
+		logs.Close()
+	}()
+	if svopts.EnvFile != "" {
+		if err := loadEnvFile(svopts.EnvFile); err != nil {
+			return err
+		}
+	}
+	return runService(svopts.Name, func(stop <-chan os.Signal) error {
+		return serve(serveArgs, stop, logs)
+	})
+}
+
+// runUntilSignal runs run until the process is interrupted or terminated
+func runUntilSignal(run func(stop <-chan os.Signal) error) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	return run(stop)
+}
+
+// loadEnvFile sets the variables of the env file envPath in the environment
+func loadEnvFile(envPath string) error {
+	env, err := readEnvFile(envPath)
+	if err != nil {
+		return err
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	return nil
+}
+
+// readEnvFile reads the KEY=value lines of envPath. Blank lines and lines starting with
+// # are skipped, and values may be quoted, as in the EnvironmentFile of systemd.
+func readEnvFile(envPath string) (map[string]string, error) {
+	f, err := os.Open(envPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%s:%d is not a KEY=value line", envPath, n)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[key] = value
+	}
+	return env, scanner.Err()
+}
+
+// systemdUnit returns the systemd unit of a service running exe with args
+func systemdUnit(svopts ServiceOptions, exe string, args []string) string {
+	execStart := []string{systemdQuote(exe)}
+	for _, arg := range args {
+		execStart = append(execStart, systemdQuote(arg))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `[Unit]
+Description=gitleaks scan api (%s)
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+RestartSec=5
+`, svopts.Name, strings.Join(execStart, " "))
+	if svopts.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", svopts.User)
+	}
+	if filepath.Dir(svopts.LogFile) == "/var/log/"+svopts.Name {
+		// created by systemd, owned by User
+		fmt.Fprintf(&b, "LogsDirectory=%s\n", svopts.Name)
+	}
+	b.WriteString(`
+[Install]
+WantedBy=multi-user.target
+`)
+	return b.String()
+}
+
+// systemdQuote quotes an arg of ExecStart, escaping the specifiers and variables of
+// systemd
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// rotatingFile is a log file rotated once it grows past maxSize. Rotated files are
+// renamed <path>.1, the newest, to <path>.<backups>, the oldest, older ones are removed.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	return r, r.open()
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// Write implements io.Writer, rotating the file first if p does not fit in it
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	if r.backups == 0 {
+		os.Remove(r.path)
+		return r.open()
+	}
+	os.Remove(r.backup(r.backups))
+	for i := r.backups - 1; i >= 1; i-- {
+		os.Rename(r.backup(i), r.backup(i+1))
+	}
+	if err := os.Rename(r.path, r.backup(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) backup(i int) string {
+	return r.path + "." + strconv.Itoa(i)
+}
+
+// Close closes the log file
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+package gitleaks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultServiceLogFile is the log file of the service name without --log-file, in the
+// LogsDirectory of its systemd unit
+func defaultServiceLogFile(name string) string {
+	return filepath.Join("/var/log", name, name+".log")
+}
+
+// installService writes the systemd unit of the service, which is enabled with systemctl
+func installService(svopts ServiceOptions, exe string, args []string) error {
+	unitPath := filepath.Join(svopts.UnitDir, svopts.Name+".service")
+	if _, err := os.Stat(unitPath); err == nil {
+		return fmt.Errorf("%s exists, run gitleaks service uninstall first", unitPath)
+	}
+	if err := ioutil.WriteFile(unitPath, []byte(systemdUnit(svopts, exe, args)), 0644); err != nil {
+		return err
+	}
+	log.Infof("installed systemd unit %s, start it with: systemctl daemon-reload && systemctl enable --now %s", unitPath, svopts.Name)
+	return nil
+}
+
+// uninstallService removes the systemd unit of the service, which should be stopped
+// and disabled first
+func uninstallService(svopts ServiceOptions) error {
+	unitPath := filepath.Join(svopts.UnitDir, svopts.Name+".service")
+	if err := os.Remove(unitPath); err != nil {
+		return err
+	}
+	log.Infof("removed systemd unit %s, reload systemd with: systemctl daemon-reload", unitPath)
+	return nil
+}
+
+// runService runs the service until systemd stops it
+func runService(name string, run func(stop <-chan os.Signal) error) error {
+	return runUntilSignal(run)
+}
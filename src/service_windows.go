@@ -0,0 +1,112 @@
+package gitleaks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// defaultServiceLogFile is the log file of the service name without --log-file
+func defaultServiceLogFile(name string) string {
+	return filepath.Join(os.Getenv("ProgramData"), name, name+".log")
+}
+
+// installService registers the service with the service control manager, started
+// automatically and restarted when it fails
+func installService(svopts ServiceOptions, exe string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("unable to connect to the service control manager, run as administrator: %v", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(svopts.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s exists, run gitleaks service uninstall first", svopts.Name)
+	}
+	s, err := m.CreateService(svopts.Name, exe, mgr.Config{
+		DisplayName: "gitleaks (" + svopts.Name + ")",
+		Description: "gitleaks scan api",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 5 * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, 24*60*60); err != nil {
+		log.Warnf("unable to restart service %s when it fails: %v", svopts.Name, err)
+	}
+	log.Infof("installed service %s, start it with: sc start %s", svopts.Name, svopts.Name)
+	return nil
+}
+
+// uninstallService removes the service from the service control manager, which
+// deletes it once it is stopped
+func uninstallService(svopts ServiceOptions) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("unable to connect to the service control manager, run as administrator: %v", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(svopts.Name)
+	if err != nil {
+		return fmt.Errorf("no service %s: %v", svopts.Name, err)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	log.Infof("removed service %s", svopts.Name)
+	return nil
+}
+
+// runService runs the service under the service control manager, or until it is
+// interrupted when started from a console
+func runService(name string, run func(stop <-chan os.Signal) error) error {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		return err
+	}
+	if interactive {
+		return runUntilSignal(run)
+	}
+	return svc.Run(name, serviceHandler(run))
+}
+
+// serviceHandler runs the service until the service control manager stops it
+type serviceHandler func(stop <-chan os.Signal) error
+
+// Execute implements svc.Handler
+func (run serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(stop)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Error(err)
+				return false, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				stop <- syscall.SIGTERM
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package gitleaks
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// severities ranks the severities a rule can have
+var severities = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// parseSeverity returns the rank of severity, which is case insensitive
+func parseSeverity(severity string) (int, error) {
+	rank, ok := severities[strings.ToLower(severity)]
+	if !ok {
+		return 0, fmt.Errorf("unknown severity %q, must be low, medium, high or critical", severity)
+	}
+	return rank, nil
+}
+
+// failingLeaks returns the number of leaks which fail the audit. Without --fail-on every
+// leak does. With --fail-on only leaks of rules at or above that severity do, as well
+// as leaks of rules without a severity, so unrated rules are never silenced. Streamed
+// leaks are counted as they are written instead. With --policy the policy decides.
+func failingLeaks(leaks []Leak) int {
+	if policy != nil {
+		return policyFailingLeaks(leaks)
+	}
+	total, failing := len(leaks), 0
+	if s := leakStream; s != nil {
+		s.mu.Lock()
+		total, failing = s.leaks, s.failing
+		s.mu.Unlock()
+	} else {
+		for _, leak := range leaks {
+			if failsAudit(leak) {
+				failing++
+			}
+		}
+	}
+	if below := total - failing; below != 0 {
+		log.Infof("%d leaks below --fail-on %s do not fail the audit", below, opts.FailOn)
+	}
+	return failing
+}
+
+// failsAudit reports whether leak fails the audit, see failingLeaks
+func failsAudit(leak Leak) bool {
+	if opts.FailOn == "" || leak.Severity == "" {
+		return true
+	}
+	threshold, _ := parseSeverity(opts.FailOn)
+	return severities[strings.ToLower(leak.Severity)] >= threshold
+}
@@ -0,0 +1,102 @@
+package gitleaks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// slackTopRules is the number of rules listed in slack summaries
+const slackTopRules = 3
+
+// slackConfig is the [notify.slack] section of the config
+type slackConfig struct {
+	webhookConfig
+	// channel overrides the channel of the incoming webhook
+	channel string
+	// reportURL links the report of the run, e.g. a CI artifact, instead of --report
+	reportURL string
+}
+
+// slackMessage is posted to a slack incoming webhook
+type slackMessage struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+// newSlackConfig validates the [notify.slack] section of a config
+func newSlackConfig(tomlConfig TomlConfig) (slackConfig, error) {
+	slack := tomlConfig.Notify.Slack
+	delivery, err := newDelivery("notify.slack", slack.URL, slack.Retries, slack.Backoff)
+	return slackConfig{
+		webhookConfig: delivery,
+		channel:       slack.Channel,
+		reportURL:     slack.ReportURL,
+	}, err
+}
+
+// notifySlack posts a summary of the leaks of a repo to the incoming webhook of
+// [notify.slack]: their count, the rules with the most leaks and where the report is.
+// Returns false if the notification failed.
+func notifySlack(repoName string, leaks []Leak) bool {
+	if opts.CountOnly || config == nil || config.slack.url == "" || len(leaks) == 0 {
+		return true
+	}
+	err := deliver(config.slack.webhookConfig, slackMessage{
+		Channel: config.slack.channel,
+		Text:    slackSummary(repoName, leaks, config.slack.reportURL),
+	})
+	if err != nil {
+		log.Warnf("unable to notify slack of %d leaks of %s: %v", len(leaks), repoName, err)
+		degrade()
+		return false
+	}
+	log.Debugf("notified slack of %d leaks of %s", len(leaks), repoName)
+	return true
+}
+
+// slackSummary returns the mrkdwn text summarizing the leaks of a repo
+func slackSummary(repoName string, leaks []Leak, reportURL string) string {
+	counts := make(map[string]int)
+	var rules []string
+	for _, leak := range leaks {
+		if counts[leak.Rule] == 0 {
+			rules = append(rules, leak.Rule)
+		}
+		counts[leak.Rule]++
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if counts[rules[i]] != counts[rules[j]] {
+			return counts[rules[i]] > counts[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	var top []string
+	for i, rule := range rules {
+		if i == slackTopRules {
+			top = append(top, fmt.Sprintf("and %d more", len(rules)-slackTopRules))
+			break
+		}
+		top = append(top, fmt.Sprintf("%s (%d)", slackEscape(rule), counts[rule]))
+	}
+
+	noun := "leaks"
+	if len(leaks) == 1 {
+		noun = "leak"
+	}
+	text := fmt.Sprintf(":rotating_light: gitleaks found %d %s in *%s*\nTop rules: %s",
+		len(leaks), noun, slackEscape(repoName), strings.Join(top, ", "))
+	if reportURL != "" {
+		text += fmt.Sprintf("\nReport: <%s|run %s>", reportURL, runID)
+	} else if opts.Report != "" {
+		text += fmt.Sprintf("\nReport: `%s` of run %s", slackEscape(opts.Report), runID)
+	}
+	return text
+}
+
+// slackEscape escapes the control characters of slack mrkdwn
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,77 @@
+package gitleaks
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// sshHostKey is an entry of [[auth.ssh]], the ssh key of the hosts matching host
+type sshHostKey struct {
+	host *regexp.Regexp
+	auth *ssh.PublicKeys
+}
+
+// loadSSHHostKeys loads the keys of [[auth.ssh]]. Passphrases may reference
+// environment variables, and key paths may start with ~/.
+func loadSSHHostKeys(tomlConfig TomlConfig) ([]*sshHostKey, error) {
+	var keys []*sshHostKey
+	for _, entry := range tomlConfig.Auth.SSH {
+		host, err := regexp.Compile(entry.Host)
+		if err != nil || entry.Host == "" {
+			return nil, fmt.Errorf("invalid auth.ssh host %q: %v", entry.Host, err)
+		}
+		keyPath := entry.Key
+		if strings.HasPrefix(keyPath, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			keyPath = filepath.Join(home, keyPath[2:])
+		}
+		auth, err := ssh.NewPublicKeysFromFile("git", keyPath, os.ExpandEnv(entry.Passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load ssh key %s of host %s: %v", entry.Key, entry.Host, err)
+		}
+		keys = append(keys, &sshHostKey{host: host, auth: auth})
+	}
+	return keys, nil
+}
+
+// sshAuthFor returns the ssh auth of the repo at rawURL: the key of the first
+// [[auth.ssh]] entry matching its host, or else --ssh-key or ~/.ssh/id_rsa
+func (config *Config) sshAuthFor(rawURL string) *ssh.PublicKeys {
+	if host := sshHost(rawURL); host != "" {
+		for _, key := range config.sshKeys {
+			if key.host.MatchString(host) {
+				return key.auth
+			}
+		}
+	}
+	return config.sshAuth
+}
+
+// sshHost returns the host of an ssh clone url, either ssh://git@host:22/path or the
+// scp-like git@host:path
+func sshHost(rawURL string) string {
+	if strings.Contains(rawURL, "://") {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+	host := rawURL
+	if i := strings.Index(host, "@"); i != -1 {
+		host = host[i+1:]
+	}
+	if i := strings.Index(host, ":"); i != -1 {
+		return host[:i]
+	}
+	return ""
+}
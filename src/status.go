@@ -0,0 +1,83 @@
+package gitleaks
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// progress tracks the audit so operators can ask a long running job what it is doing,
+// see watchStatusSignal
+var progress struct {
+	// commits and leaks are first to keep them 64-bit aligned for atomic access
+	commits int64
+	// leaks found in repos which have already been reported
+	leaks  int64
+	start  time.Time
+	repo   atomic.Value // *Repo being audited
+	ref    atomic.Value // string, refs walked for the current repo
+	commit atomic.Value // string, last commit walked
+}
+
+// resetProgress clears the progress of a previous run
+func resetProgress() {
+	atomic.StoreInt64(&progress.commits, 0)
+	atomic.StoreInt64(&progress.leaks, 0)
+	progress.start = time.Now()
+	progress.repo.Store((*Repo)(nil))
+	progress.ref.Store("")
+	progress.commit.Store("")
+}
+
+// setProgressRef records which refs of the current repo are walked
+func setProgressRef(ref string) {
+	progress.ref.Store(ref)
+	progress.commit.Store("")
+}
+
+// commitWalked records that commit sha of the current repo is being audited
+func commitWalked(sha string) {
+	atomic.AddInt64(&progress.commits, 1)
+	progress.commit.Store(sha)
+}
+
+// repoReported moves the leaks of a finished repo into the progress totals
+func repoReported(repo *Repo) {
+	mutex.Lock()
+	atomic.AddInt64(&progress.leaks, int64(len(repo.leaks)))
+	mutex.Unlock()
+	progress.repo.Store((*Repo)(nil))
+	recordTelemetry(repo)
+	leaks := repo.Leaks()
+	notifyLeaks(repo.name, leaks)
+	notifyWorkItems(repo, leaks)
+}
+
+// writeStatus writes the progress of the audit to w
+func writeStatus(w io.Writer) {
+	leaks := atomic.LoadInt64(&progress.leaks)
+	repoName := "none"
+	if repo, _ := progress.repo.Load().(*Repo); repo != nil {
+		repoName = repo.name
+		mutex.Lock()
+		leaks += int64(len(repo.leaks))
+		mutex.Unlock()
+	}
+	ref, _ := progress.ref.Load().(string)
+	commit, _ := progress.commit.Load().(string)
+	if ref == "" {
+		ref = "none"
+	}
+	if commit == "" {
+		commit = "none"
+	}
+	fmt.Fprintf(w, "gitleaks status: run %s, running for %s\n", runID, time.Since(progress.start).Round(time.Second))
+	fmt.Fprintf(w, "  repo:       %s\n", repoName)
+	fmt.Fprintf(w, "  ref:        %s\n", ref)
+	fmt.Fprintf(w, "  commit:     %s\n", commit)
+	fmt.Fprintf(w, "  commits:    %d\n", atomic.LoadInt64(&progress.commits))
+	fmt.Fprintf(w, "  leaks:      %d\n", leaks)
+	fmt.Fprintf(w, "  goroutines: %d\n", runtime.NumGoroutine())
+}
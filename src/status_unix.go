@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package gitleaks
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchStatusSignal dumps the progress of the audit to stderr every time the process
+// receives SIGUSR1, without interrupting the audit. The returned func stops watching.
+func watchStatusSignal() func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	go func() {
+		for range sigs {
+			writeStatus(os.Stderr)
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
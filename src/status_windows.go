@@ -0,0 +1,6 @@
+package gitleaks
+
+// watchStatusSignal is a no-op, windows has no SIGUSR1
+func watchStatusSignal() func() {
+	return func() {}
+}
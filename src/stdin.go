@@ -0,0 +1,157 @@
+package gitleaks
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// stdin is read by --stdin
+var stdin io.Reader = os.Stdin
+
+// hunkHeaderRe matches the header of a hunk of a unified diff, e.g. @@ -1,3 +1,4 @@
+var hunkHeaderRe = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// diffFragment is a run of added lines of a file in a unified diff
+type diffFragment struct {
+	filePath  string
+	startLine int
+	content   string
+}
+
+// auditStdin audits text read from stdin, e.g. git diff | gitleaks --stdin. Of unified
+// diffs only the added lines are audited, and leaks are reported with the file and
+// line number of the new side. Any other text is audited as a single file named by
+// --stdin-name. Leaks are reported with "N/A" as the commit.
+func auditStdin() ([]Leak, error) {
+	b, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read stdin: %v", err)
+	}
+	content := string(b)
+
+	repo := &Repo{name: "stdin"}
+	repo.startSpan()
+	if fragments, ok := parseUnifiedDiff(content); ok {
+		for _, fragment := range fragments {
+			repo.auditFragment(fragment.filePath, fragment.content, fragment.startLine)
+		}
+		log.Debugf("audited %d runs of added lines of a diff", len(fragments))
+	} else {
+		repo.auditFragment(opts.StdinName, content, 1)
+	}
+	numBytes := repo.Stats().Bytes
+	repo.trace.finish()
+	repo.trace = nil
+
+	if opts.CountOnly {
+		repoReported(repo)
+		reportCounts(repo.name)
+		return nil, nil
+	}
+	repo.leaks = filterBaseline(repo.leaks)
+	repoReported(repo)
+	if len(repo.leaks) != 0 {
+		log.Warnf("%d leaks detected. %s read from stdin", len(repo.leaks), formatSize(numBytes))
+	} else {
+		log.Infof("No leaks detected. %s read from stdin", formatSize(numBytes))
+	}
+	return repo.leaks, nil
+}
+
+// parseUnifiedDiff returns the runs of added lines of the unified diff in content, or
+// false if content is not a diff
+func parseUnifiedDiff(content string) ([]diffFragment, bool) {
+	var (
+		fragments []diffFragment
+		added     []string
+		isDiff    bool
+		filePath  string
+		// newLine is the line number of the next line of the new side, oldLeft and
+		// newLeft count the lines left in the current hunk
+		newLine, oldLeft, newLeft int
+	)
+	flush := func() {
+		if len(added) != 0 && filePath != "" {
+			fragments = append(fragments, diffFragment{
+				filePath:  filePath,
+				startLine: newLine - len(added),
+				content:   strings.Join(added, "\n"),
+			})
+		}
+		added = nil
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				added = append(added, line[1:])
+				newLine++
+				newLeft--
+				continue
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, "\\"):
+				// \ No newline at end of file
+				continue
+			default:
+				// context line
+				oldLeft--
+				newLeft--
+			}
+			flush()
+			if strings.HasPrefix(line, " ") || line == "" {
+				newLine++
+			}
+			continue
+		}
+		flush()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			isDiff = true
+			filePath = diffPath(line[4:])
+		case strings.HasPrefix(line, "@@ "):
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			oldLeft, newLeft = hunkLines(m[1]), hunkLines(m[3])
+			newLine, _ = strconv.Atoi(m[2])
+		}
+	}
+	flush()
+	return fragments, isDiff
+}
+
+// hunkLines returns the number of lines of a side of a hunk, which is 1 if omitted
+func hunkLines(count string) int {
+	if count == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(count)
+	return n
+}
+
+// diffPath returns the path of the new side of a diff from a +++ header, or "" if
+// the file was deleted
+func diffPath(header string) string {
+	if i := strings.Index(header, "\t"); i != -1 {
+		// diff -u appends the modification time
+		header = header[:i]
+	}
+	if strings.HasPrefix(header, `"`) {
+		if unquoted, err := strconv.Unquote(header); err == nil {
+			header = unquoted
+		}
+	}
+	if header == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(header, "b/")
+}
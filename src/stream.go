@@ -0,0 +1,85 @@
+package gitleaks
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// leakStream writes leaks to an ndjson --report as they are found, one JSON object per
+// line, instead of holding them until the audit finishes. Leaks are released once the
+// audit of their repo is reported, so audits of large estates run in bounded memory.
+// Leaks of forks are not collapsed into their upstream, as the upstream may be audited
+// after the fork.
+var leakStream *ndjsonStream
+
+type ndjsonStream struct {
+	mu      sync.Mutex
+	f       *os.File
+	encoder *json.Encoder
+	// leaks and failing count the leaks written, and those failing the audit
+	leaks   int
+	failing int
+}
+
+// openLeakStream creates the ndjson --report leaks are streamed to
+func openLeakStream() error {
+	f, err := os.Create(opts.Report)
+	if err != nil {
+		return err
+	}
+	log.Infof("streaming report to %s", opts.Report)
+	leakStream = &ndjsonStream{f: f, encoder: json.NewEncoder(f)}
+	return nil
+}
+
+// closeLeakStream syncs and closes the streamed report
+func closeLeakStream() error {
+	if leakStream == nil {
+		return nil
+	}
+	s := leakStream
+	leakStream = nil
+	log.Infof("%d leaks written to %s", s.leaks, opts.Report)
+	if err := s.f.Sync(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// streamLeak writes leak to the streamed report, unless it is in the --baseline. The
+// file is unbuffered, so every leak is on disk as soon as it is found.
+func streamLeak(leak Leak) {
+	s := leakStream
+	if s == nil || (baseline != nil && baseline[baselineFingerprint(leak)]) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(leak); err != nil {
+		log.Errorf("unable to write leak to %s: %v", opts.Report, err)
+		degrade()
+		return
+	}
+	if leak.SuppressedBy == "" {
+		s.leaks++
+		if failsAudit(leak) {
+			s.failing++
+		}
+	}
+}
+
+// writeNDJSONLeaks writes leaks to w as JSON lines, e.g. when merging reports
+func writeNDJSONLeaks(w io.Writer, leaks []Leak) error {
+	encoder := json.NewEncoder(w)
+	for _, leak := range leaks {
+		if err := encoder.Encode(leak); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package gitleaks
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// degradations counts the recoverable issues of a run, like skipped rules or repos
+// which could not be audited. With --strict they fail the run.
+var degradations int64
+
+// degrade records a recoverable issue which leaves the audit incomplete
+func degrade() {
+	atomic.AddInt64(&degradations, 1)
+}
+
+// skipRepo logs why a repo of an owner audit was not audited. Whitelisted repos, excluded
+// forks and empty repos are skipped on purpose, any other error degrades the audit.
+func skipRepo(err error) {
+	log.Warn(err)
+	if !errors.Is(err, ErrWhitelisted) && !errors.Is(err, ErrExcludedFork) && !errors.Is(err, ErrEmptyRepo) {
+		degrade()
+	}
+}
+
+// strictError returns an error if --strict is set and the run was degraded
+func strictError() error {
+	if n := atomic.LoadInt64(&degradations); opts.Strict && n != 0 {
+		return fmt.Errorf("%d warnings during the audit, failing because of --strict", n)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package gitleaks
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+// ignoreFile lists the fingerprints of leaks to ignore, one per line. It is read from the
+// root of the audited repo, so suppressions can be committed next to the code.
+const ignoreFile = ".gitleaksignore"
+
+// SuppressOptions are the options of gitleaks suppress
+type SuppressOptions struct {
+	FromReport string `long:"from-report" required:"true" description:"json report of the leaks to suppress"`
+	Reason     string `long:"reason" description:"reason the leaks are suppressed, e.g. \"legacy, rotated 2024-05\""`
+	ApprovedBy string `long:"approved-by" description:"reviewer who approved the suppression"`
+	Expires    string `long:"expires" description:"date the suppressions expire, after which the leaks are reported again. Example: 2025-06-01"`
+	To         string `long:"to" default:".gitleaksignore" description:"file to append the suppressions to: a .gitleaksignore file, or a gitleaks config ending in .toml"`
+}
+
+// ignoreFingerprint identifies a leak in .gitleaksignore files and whitelist fingerprints
+func ignoreFingerprint(commit, file, rule string) string {
+	return commit + ":" + file + ":" + rule
+}
+
+// ignoredLeak returns the whitelist fingerprint ignoring the leak of rule in filePath at
+// commit sha, or nil if the leak is not ignored
+func ignoredLeak(sha, filePath, rule string) *whitelistEntry {
+	return config.WhiteList.fingerprints[ignoreFingerprint(sha, reportPath(filePath), rule)]
+}
+
+// Suppress is the entry point for gitleaks suppress. It appends a fingerprint whitelist
+// entry for every leak of a report to a .gitleaksignore file or a config, so the leaks
+// found by the first audit of a legacy repo can be triaged at once.
+func Suppress(args []string) error {
+	var sopts SuppressOptions
+	parser := flags.NewParser(&sopts, flags.Default&^flags.PrintErrors)
+	parser.Usage = "suppress [OPTIONS]"
+	if _, err := parser.ParseArgs(args); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	if sopts.Expires != "" {
+		if _, err := time.Parse(expiresLayout, sopts.Expires); err != nil {
+			return fmt.Errorf("--expires should be a date like 2006-01-02")
+		}
+	}
+	if !strings.HasSuffix(sopts.To, ".toml") {
+		// the fields of .gitleaksignore comments are separated by "; " after " # "
+		for flag, value := range map[string]string{"--reason": sopts.Reason, "--approved-by": sopts.ApprovedBy} {
+			if strings.Contains(value, "; ") || strings.Contains(value, " # ") || strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("%s can not contain \"; \", \" # \" or line breaks in a %s file, suppress the leaks in a .toml config instead", flag, ignoreFile)
+			}
+		}
+	}
+
+	leaks, _, err := readReport(sopts.FromReport)
+	if err != nil {
+		return err
+	}
+	existing, err := suppressedFingerprints(sopts.To)
+	if err != nil {
+		return err
+	}
+	var fingerprints []string
+	for _, leak := range leaks {
+		fingerprint := ignoreFingerprint(leak.Commit, leak.File, leak.Rule)
+		if existing[fingerprint] {
+			continue
+		}
+		existing[fingerprint] = true
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Strings(fingerprints)
+	if len(fingerprints) == 0 {
+		log.Infof("all leaks of %s are suppressed in %s already", sopts.FromReport, sopts.To)
+		return nil
+	}
+
+	unterminated, err := missingFinalNewline(sopts.To)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(sopts.To, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if unterminated {
+		// or the first suppression would be appended to the last line
+		if _, err := f.Write([]byte("\n")); err != nil {
+			return err
+		}
+	}
+	if strings.HasSuffix(sopts.To, ".toml") {
+		err = writeSuppressedConfig(f, fingerprints, sopts)
+	} else {
+		err = writeIgnoreFile(f, fingerprints, sopts)
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("suppressed %d leaks in %s", len(fingerprints), sopts.To)
+	return nil
+}
+
+// missingFinalNewline returns true if the file at path exists and its last line does not
+// end with a newline
+func missingFinalNewline(path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+// suppressedFingerprints returns the fingerprints suppressed by the file at path already
+func suppressedFingerprints(path string) (map[string]bool, error) {
+	fingerprints := make(map[string]bool)
+	var (
+		entries []*whitelistEntry
+		err     error
+	)
+	if strings.HasSuffix(path, ".toml") {
+		var tomlConfig TomlConfig
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return fingerprints, nil
+		}
+		if _, err = toml.DecodeFile(path, &tomlConfig); err != nil {
+			return nil, fmt.Errorf("problem loading %s: %v", path, err)
+		}
+		entries, err = getWhitelistEntries("fingerprint", tomlConfig.Whitelist.Fingerprints)
+	} else {
+		var f *os.File
+		if f, err = os.Open(path); os.IsNotExist(err) {
+			return fingerprints, nil
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		entries, err = readIgnoreEntries(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		fingerprints[entry.value] = true
+	}
+	return fingerprints, nil
+}
+
+// writeIgnoreFile appends fingerprints to a .gitleaksignore file. The reason, reviewer and
+// expiry date follow the fingerprint as a comment, e.g.
+// 0a1b2c:config/prod.env:AWS Client ID # reason=rotated; approvedBy=alice; expires=2025-06-01
+func writeIgnoreFile(w io.Writer, fingerprints []string, sopts SuppressOptions) error {
+	var fields []string
+	if sopts.Reason != "" {
+		fields = append(fields, "reason="+sopts.Reason)
+	}
+	if sopts.ApprovedBy != "" {
+		fields = append(fields, "approvedBy="+sopts.ApprovedBy)
+	}
+	if sopts.Expires != "" {
+		fields = append(fields, "expires="+sopts.Expires)
+	}
+	comment := ""
+	if len(fields) != 0 {
+		comment = " # " + strings.Join(fields, "; ")
+	}
+	for _, fingerprint := range fingerprints {
+		if _, err := fmt.Fprintf(w, "%s%s\n", fingerprint, comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSuppressedConfig appends fingerprints to a config as [[whitelist.fingerprints]] tables
+func writeSuppressedConfig(w io.Writer, fingerprints []string, sopts SuppressOptions) error {
+	for _, fingerprint := range fingerprints {
+		entry := "\n[[whitelist.fingerprints]]\nfingerprint = " + strconv.Quote(fingerprint) + "\n"
+		if sopts.Reason != "" {
+			entry += "reason = " + strconv.Quote(sopts.Reason) + "\n"
+		}
+		if sopts.ApprovedBy != "" {
+			entry += "approvedBy = " + strconv.Quote(sopts.ApprovedBy) + "\n"
+		}
+		if sopts.Expires != "" {
+			entry += "expires = " + strconv.Quote(sopts.Expires) + "\n"
+		}
+		if _, err := io.WriteString(w, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIgnoreEntries reads the fingerprints of a .gitleaksignore file. Blank lines and
+// lines starting with # are skipped.
+func readIgnoreEntries(r io.Reader) ([]*whitelistEntry, error) {
+	var items []interface{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		item := map[string]interface{}{"fingerprint": line}
+		if i := strings.Index(line, " # "); i != -1 {
+			item["fingerprint"] = strings.TrimSpace(line[:i])
+			for _, field := range strings.Split(line[i+3:], "; ") {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) == 2 {
+					item[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return getWhitelistEntries("fingerprint", items)
+}
+
+// ignoredLeaks returns the fingerprints of the .gitleaksignore file of the repo, read
+// from the worktree of an on-disk repo, or else from the tree of HEAD
+func (repo *Repo) ignoredLeaks() ([]*whitelistEntry, error) {
+	var content string
+	if repo.path != "" {
+		b, err := ioutil.ReadFile(filepath.Join(repo.path, ignoreFile))
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		content = string(b)
+	} else {
+		if repo.repository == nil {
+			return nil, nil
+		}
+		head, err := repo.repository.Head()
+		if err != nil {
+			return nil, nil
+		}
+		c, err := repo.repository.CommitObject(head.Hash())
+		if err != nil {
+			return nil, nil
+		}
+		f, err := c.File(ignoreFile)
+		if err != nil {
+			return nil, nil
+		}
+		if content, err = f.Contents(); err != nil {
+			return nil, err
+		}
+	}
+	entries, err := readIgnoreEntries(strings.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("problem loading %s of %s: %v", ignoreFile, repo.name, err)
+	}
+	return entries, nil
+}
+
+// withIgnoredLeaks returns a copy of the config which also ignores the leaks of entries,
+// or the config itself if there are none
+func (config *Config) withIgnoredLeaks(entries []*whitelistEntry) *Config {
+	if len(entries) == 0 {
+		return config
+	}
+	local := *config
+	local.WhiteList.fingerprints = make(map[string]*whitelistEntry)
+	for fingerprint, entry := range config.WhiteList.fingerprints {
+		local.WhiteList.fingerprints[fingerprint] = entry
+	}
+	for _, entry := range entries {
+		local.WhiteList.fingerprints[entry.value] = entry
+	}
+	return &local
+}
@@ -0,0 +1,178 @@
+package gitleaks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// telemetry aggregates the audited repos for --telemetry-url and gitleaks bench. Only
+// counts are kept, never repo names, paths, commits or leak content.
+var telemetry struct {
+	repos      int
+	commits    int64
+	bytes      int64
+	leaks      int64
+	rulesFired map[string]int64
+	// known is the number of leaks left out because they are in --baseline
+	known int64
+}
+
+// telemetryReport is posted to --telemetry-url at the end of a run, so platform teams
+// can measure adoption and rule efficacy across pipelines
+type telemetryReport struct {
+	RunID      string    `json:"runID"`
+	Version    string    `json:"version"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	Mode       string    `json:"mode"`
+	StartedOn  time.Time `json:"startedOn"`
+	DurationMs int64     `json:"durationMs"`
+	Repos      int       `json:"repos"`
+	Commits    int64     `json:"commits"`
+	Bytes      int64     `json:"bytes"`
+	Leaks      int64     `json:"leaks"`
+	// Failing is the number of leaks which failed the audit
+	Failing      int              `json:"failing"`
+	RulesFired   map[string]int64 `json:"rulesFired"`
+	Degradations int64            `json:"degradations"`
+	Passed       bool             `json:"passed"`
+	// Errored is set if the run failed with an error, which is not sent
+	Errored bool `json:"errored"`
+}
+
+// resetTelemetry clears the counts of a previous run
+func resetTelemetry() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	telemetry.repos, telemetry.commits, telemetry.bytes, telemetry.leaks = 0, 0, 0, 0
+	telemetry.rulesFired = nil
+	telemetry.known = 0
+}
+
+// recordTelemetry adds the counts of a reported repo to telemetry
+func recordTelemetry(repo *Repo) {
+	if opts == nil {
+		return
+	}
+	rulesFired := make(map[string]int64)
+	if opts.CountOnly {
+		_, rulesFired = repoCounts(repo.name)
+	} else {
+		for rule, n := range repo.Stats().RulesFired {
+			rulesFired[rule] = int64(n)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	telemetry.repos++
+	telemetry.commits += repo.numCommits
+	telemetry.bytes += atomic.LoadInt64(&repo.numBytes)
+	if telemetry.rulesFired == nil {
+		telemetry.rulesFired = make(map[string]int64)
+	}
+	for rule, n := range rulesFired {
+		telemetry.rulesFired[rule] += n
+		telemetry.leaks += n
+	}
+}
+
+// telemetryMode names what the run audited, e.g. owner-path or github
+func telemetryMode() string {
+	switch {
+	case opts.MergeReports != "":
+		return "merge-reports"
+	case opts.Repo != "":
+		return "repo"
+	case opts.RepoPath != "":
+		return "repo-path"
+	case opts.OwnerPath != "":
+		return "owner-path"
+	case opts.Bundle != "":
+		return "bundle"
+	case opts.Stdin:
+		return "stdin"
+	case opts.Image != "":
+		return "image"
+	case opts.Path != "":
+		return "path"
+	case opts.AzdevOrg != "":
+		return "azure-devops"
+	case opts.BitbucketOrg != "" || opts.BitbucketUser != "":
+		return "bitbucket"
+	case opts.GiteaOrg != "" || opts.GiteaUser != "":
+		return "gitea"
+	case opts.GithubOrg != "" || opts.GithubUser != "" || opts.GithubPR != "":
+		return "github"
+	case opts.GitLabOrg != "" || opts.GitLabUser != "":
+		return "gitlab"
+	}
+	return "none"
+}
+
+// sendTelemetry posts the aggregate counts of the run to --telemetry-url, with the
+// bearer token GITLEAKS_TELEMETRY_TOKEN if set. Telemetry never fails the run, errors
+// are only logged.
+func sendTelemetry(failing int, runErr error, started time.Time) {
+	mutex.Lock()
+	report := telemetryReport{
+		RunID:        runID,
+		Version:      version,
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Mode:         telemetryMode(),
+		StartedOn:    started.UTC(),
+		DurationMs:   time.Since(started).Nanoseconds() / int64(time.Millisecond),
+		Repos:        telemetry.repos,
+		Commits:      telemetry.commits,
+		Bytes:        telemetry.bytes,
+		Leaks:        telemetry.leaks,
+		Failing:      failing,
+		RulesFired:   make(map[string]int64),
+		Degradations: atomic.LoadInt64(&degradations),
+		Errored:      runErr != nil,
+	}
+	for rule, n := range telemetry.rulesFired {
+		report.RulesFired[rule] = n
+	}
+	mutex.Unlock()
+	report.Passed = runErr == nil && failing == 0
+
+	if err := postTelemetry(report); err != nil {
+		log.Warnf("unable to send telemetry to %s: %v", opts.TelemetryURL, err)
+		return
+	}
+	log.Debugf("telemetry sent to %s", opts.TelemetryURL)
+}
+
+func postTelemetry(report telemetryReport) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", opts.TelemetryURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("GITLEAKS_TELEMETRY_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package gitleaks
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// leakGroup is a group of leaks sharing the value of a field, see groupBy
+type leakGroup struct {
+	Key   string
+	Leaks []Leak
+}
+
+// templateFuncs are the helpers of --report-template
+var templateFuncs = template.FuncMap{
+	"groupBy":  groupBy,
+	"redact":   redact,
+	"join":     strings.Join,
+	"truncate": truncateString,
+}
+
+// parseReportTemplate parses the --report-template at path
+func parseReportTemplate(path string) (*template.Template, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(path).Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --report-template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// writeTemplateReport renders leaks through the --report-template, e.g. into a markdown
+// summary or the markup of a wiki. Templates see the fields RunID, Generated, Total,
+// Leaks, Suppressed and ExtraFields, and the helpers groupBy, redact, join and truncate.
+func writeTemplateReport(w io.Writer, leaks []Leak) error {
+	tmpl, err := parseReportTemplate(opts.ReportTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, struct {
+		RunID       string
+		Generated   string
+		Total       int
+		Leaks       []Leak
+		Suppressed  []Leak
+		ExtraFields map[string]string
+	}{
+		RunID:       runID,
+		Generated:   time.Now().Format(time.RFC3339),
+		Total:       len(leaks),
+		Leaks:       leaks,
+		Suppressed:  suppressedLeaks,
+		ExtraFields: extraFields(),
+	})
+}
+
+// groupBy groups leaks by a field, one of rule, ruleID, severity, repo, file, commit,
+// author or email, in the order the values first occur
+func groupBy(field string, leaks []Leak) ([]leakGroup, error) {
+	var key func(Leak) string
+	switch field {
+	case "rule":
+		key = func(leak Leak) string { return leak.Rule }
+	case "ruleID":
+		key = func(leak Leak) string { return leak.RuleID }
+	case "severity":
+		key = func(leak Leak) string { return leak.Severity }
+	case "repo":
+		key = func(leak Leak) string { return leak.Repo }
+	case "file":
+		key = func(leak Leak) string { return leak.File }
+	case "commit":
+		key = func(leak Leak) string { return leak.Commit }
+	case "author":
+		key = func(leak Leak) string { return leak.Author }
+	case "email":
+		key = func(leak Leak) string { return leak.Email }
+	default:
+		return nil, fmt.Errorf("unable to group leaks by %q", field)
+	}
+
+	var groups []leakGroup
+	index := make(map[string]int)
+	for _, leak := range leaks {
+		k := key(leak)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, leakGroup{Key: k})
+		}
+		groups[i].Leaks = append(groups[i].Leaks, leak)
+	}
+	return groups, nil
+}
+
+// truncateString shortens s to n characters, ending it with an ellipsis if it is longer
+func truncateString(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + ellipsis
+}
@@ -0,0 +1,236 @@
+package gitleaks
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Tracing exports spans for enumeration, clones, ref walks, commit audits and report
+// writing to an OpenTelemetry collector using OTLP/HTTP with JSON encoding. The trace
+// id is the run id and repo spans use the repo span id, so traces line up with logs.
+// Spans are posted in batches of traceBatchSize while the audit runs, so a run with a
+// span per commit neither keeps every span in memory nor posts them in one request.
+
+// traceBatchSize is the number of finished spans posted to the collector at once
+const traceBatchSize = 512
+
+var (
+	traceMu    sync.Mutex
+	traceSpans []*traceSpan
+	rootSpan   *traceSpan
+	// traceExports tracks batches being posted, waited on by exportTraces
+	traceExports sync.WaitGroup
+)
+
+// traceSpan is a finished or in flight span
+type traceSpan struct {
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]string
+}
+
+// tracing returns true if spans are exported
+func tracing() bool {
+	return otlpEndpoint() != ""
+}
+
+// otlpEndpoint returns the url spans are posted to, either --otlp-endpoint or the
+// standard OTEL_EXPORTER_OTLP_* environment variables
+func otlpEndpoint() string {
+	if opts == nil {
+		return ""
+	}
+	if opts.OTLPEndpoint != "" {
+		return opts.OTLPEndpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// startTrace starts a span called name under parentID. An empty parentID makes the
+// span a child of the run. Returns nil, which is safe to end, if tracing is off.
+func startTrace(name string, parentID string) *traceSpan {
+	if !tracing() {
+		return nil
+	}
+	if parentID == "" && rootSpan != nil {
+		parentID = rootSpan.spanID
+	}
+	return &traceSpan{
+		spanID:   newSpanID(),
+		parentID: parentID,
+		name:     name,
+		start:    time.Now(),
+		attrs:    make(map[string]string),
+	}
+}
+
+// set adds an attribute to the span
+func (s *traceSpan) set(key, value string) *traceSpan {
+	if s != nil {
+		s.attrs[key] = value
+	}
+	return s
+}
+
+// id returns the span id, empty if tracing is off
+func (s *traceSpan) id() string {
+	if s == nil {
+		return ""
+	}
+	return s.spanID
+}
+
+// finish ends the span and queues it for export, posting the queued spans in the
+// background once there are traceBatchSize of them
+func (s *traceSpan) finish() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	traceMu.Lock()
+	traceSpans = append(traceSpans, s)
+	var batch []*traceSpan
+	if len(traceSpans) >= traceBatchSize {
+		batch = traceSpans
+		traceSpans = nil
+	}
+	traceMu.Unlock()
+	if batch != nil {
+		traceExports.Add(1)
+		go func() {
+			defer traceExports.Done()
+			postSpans(batch)
+		}()
+	}
+}
+
+// startRootTrace starts the span covering the whole run
+func startRootTrace() {
+	traceMu.Lock()
+	traceSpans = nil
+	traceMu.Unlock()
+	rootSpan = nil
+	rootSpan = startTrace("gitleaks", "")
+}
+
+// exportTraces ends the run span, posts the spans not exported yet and waits for
+// batches still being posted. Export failures are logged, they never fail the audit.
+func exportTraces() {
+	if rootSpan == nil {
+		return
+	}
+	rootSpan.finish()
+	rootSpan = nil
+
+	traceMu.Lock()
+	spans := traceSpans
+	traceSpans = nil
+	traceMu.Unlock()
+
+	if len(spans) != 0 {
+		postSpans(spans)
+	}
+	traceExports.Wait()
+}
+
+// postSpans posts spans to the collector in one request
+func postSpans(spans []*traceSpan) {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		log.Warnf("unable to encode traces: %v", err)
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(otlpEndpoint(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warnf("unable to export traces: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Warnf("unable to export traces: %s", resp.Status)
+		return
+	}
+	log.Debugf("exported %d spans to %s", len(spans), otlpEndpoint())
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+func otlpAttributes(attrs map[string]string) []otlpKeyValue {
+	var kvs []otlpKeyValue
+	for k, v := range attrs {
+		kv := otlpKeyValue{Key: k}
+		kv.Value.StringValue = v
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
+
+// otlpRequest builds an ExportTraceServiceRequest in the OTLP JSON encoding
+func otlpRequest(spans []*traceSpan) interface{} {
+	traceID := strings.Replace(runID, "-", "", -1)
+	var encoded []otlpSpan
+	for _, s := range spans {
+		encoded = append(encoded, otlpSpan{
+			TraceID:           traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              1, // SPAN_KIND_INTERNAL
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attrs),
+		})
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]string{
+						"service.name":    "gitleaks",
+						"service.version": version,
+					}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "gitleaks", "version": version},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package gitleaks
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ellipsis marks where a reported line or offender was truncated
+const ellipsis = "..."
+
+// truncateLeak cuts the line and offender of leak to --max-line-length and
+// --max-offender-length characters, so matches in minified bundles do not bloat
+// reports. The original lengths of truncated values are kept in the leak.
+func truncateLeak(leak *Leak) {
+	if opts.MaxLineLength > 0 {
+		if n := utf8.RuneCountInString(leak.Line); n > opts.MaxLineLength {
+			leak.Line = truncateAround(leak.Line, leak.Offender, opts.MaxLineLength)
+			leak.LineLength = n
+		}
+		leak.ContextBefore = truncateLines(leak.ContextBefore, leak.Offender, opts.MaxLineLength)
+		leak.ContextAfter = truncateLines(leak.ContextAfter, leak.Offender, opts.MaxLineLength)
+	}
+	if opts.MaxOffenderLength > 0 {
+		if n := utf8.RuneCountInString(leak.Offender); n > opts.MaxOffenderLength {
+			leak.Offender = string([]rune(leak.Offender)[:opts.MaxOffenderLength]) + ellipsis
+			leak.OffenderLength = n
+		}
+	}
+}
+
+// truncateLines cuts each of lines, the context of a leak, to max characters around
+// offender
+func truncateLines(lines []string, offender string, max int) []string {
+	for i, line := range lines {
+		if utf8.RuneCountInString(line) > max {
+			lines[i] = truncateAround(line, offender, max)
+		}
+	}
+	return lines
+}
+
+// truncateAround returns max characters of line, centered on the first occurrence of
+// offender so it stays visible, with an ellipsis at each end which was cut
+func truncateAround(line, offender string, max int) string {
+	runes := []rune(line)
+	start := 0
+	if i := strings.Index(line, offender); offender != "" && i != -1 {
+		start = utf8.RuneCountInString(line[:i])
+		if n := utf8.RuneCountInString(offender); n < max {
+			start -= (max - n) / 2
+		}
+	}
+	if start > len(runes)-max {
+		start = len(runes) - max
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + max
+	truncated := string(runes[start:end])
+	if start > 0 {
+		truncated = ellipsis + truncated
+	}
+	if end < len(runes) {
+		truncated += ellipsis
+	}
+	return truncated
+}
@@ -0,0 +1,157 @@
+package gitleaks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// auditUncommitted audits the changes which are not committed yet: the staged changes
+// with --staged, or the staged and unstaged changes of the working tree with
+// --uncommitted. Only lines added compared to HEAD are inspected so the audit can run
+// as a pre-commit hook and block leaks before they reach the history.
+func (repo *Repo) auditUncommitted() error {
+	start := time.Now()
+	wt, err := repo.repository.Worktree()
+	if err == git.ErrIsBareRepository {
+		return fmt.Errorf("%s is a bare repo, it has no uncommitted changes to audit", repo.path)
+	} else if err != nil {
+		return err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return err
+	}
+	head, err := repo.headTree()
+	if err != nil {
+		return err
+	}
+	index, err := repo.repository.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for file, s := range status {
+		if opts.Staged {
+			if s.Staging == git.Unmodified || s.Staging == git.Untracked || s.Staging == git.Deleted {
+				continue
+			}
+		} else if s.Worktree == git.Deleted || (s.Staging == git.Unmodified && s.Worktree == git.Unmodified) {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	setProgressRef("uncommitted changes")
+	for _, file := range files {
+		var content []byte
+		if opts.Staged {
+			entry, err := index.Entry(file)
+			if err != nil {
+				return err
+			}
+			blob, err := repo.repository.BlobObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			r, err := blob.Reader()
+			if err != nil {
+				return err
+			}
+			content, err = ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		} else {
+			content, err = ioutil.ReadFile(filepath.Join(repo.path, filepath.FromSlash(file)))
+			if err != nil {
+				log.Debugf("unable to read %s: %v", file, err)
+				continue
+			}
+		}
+		if bytes.IndexByte(content, 0) != -1 {
+			// binary file
+			continue
+		}
+
+		var previous string
+		if head != nil {
+			if f, err := head.File(file); err == nil {
+				previous, _ = f.Contents()
+			}
+		}
+		for _, fragment := range addedFragments(file, previous, string(content)) {
+			repo.auditFragment(fragment.filePath, fragment.content, fragment.startLine)
+		}
+	}
+
+	repo.duration = time.Since(start)
+	log.Infof("%d changed files inspected", len(files))
+	return nil
+}
+
+// headTree returns the tree of HEAD, or nil if the repo has no commits yet
+func (repo *Repo) headTree() (*object.Tree, error) {
+	ref, err := repo.repository.Head()
+	if err != nil {
+		return nil, nil
+	}
+	c, err := repo.repository.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("unable to read HEAD: %v", err)
+	}
+	return c.Tree()
+}
+
+// addedLines returns the lines of dst which are not in src. Lines which only moved are
+// not returned.
+func addedLines(src, dst string) string {
+	var added []string
+	for _, fragment := range addedFragments("", src, dst) {
+		added = append(added, fragment.content)
+	}
+	return strings.Join(added, "\n")
+}
+
+// addedFragments returns the runs of lines of dst which are not in src, with the line
+// number of their first line in dst
+func addedFragments(filePath, src, dst string) []diffFragment {
+	existing := make(map[string]int)
+	for _, line := range strings.Split(src, "\n") {
+		existing[line]++
+	}
+	var (
+		fragments []diffFragment
+		added     []string
+	)
+	lines := strings.Split(dst, "\n")
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && existing[lines[i]] == 0 {
+			added = append(added, lines[i])
+			continue
+		}
+		if len(added) != 0 {
+			fragments = append(fragments, diffFragment{
+				filePath:  filePath,
+				startLine: i - len(added) + 1,
+				content:   strings.Join(added, "\n"),
+			})
+			added = nil
+		}
+		if i < len(lines) {
+			existing[lines[i]]--
+		}
+	}
+	return fragments
+}
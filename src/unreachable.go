@@ -0,0 +1,102 @@
+package gitleaks
+
+import (
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// commitHashes returns the hash of every commit object in the repository storage,
+// reachable or not. Used as extra tips so dangling commits get audited.
+func commitHashes(repository *git.Repository) ([]plumbing.Hash, error) {
+	var hashes []plumbing.Hash
+	iter, err := repository.CommitObjects()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(c *object.Commit) error {
+		hashes = append(hashes, c.Hash)
+		return nil
+	})
+	return hashes, err
+}
+
+// auditUnreachableBlobs audits every blob in the repository storage which is not part
+// of the tree of any commit. These are left behind by `git add` followed by a reset or
+// by history rewrites and are still served by the remote until it is garbage collected.
+// Since these blobs have no path the blob hash is reported as the file, which file
+// whitelists and --max-file-size apply to as to other files.
+func (repo *Repo) auditUnreachableBlobs() error {
+	referenced := make(map[plumbing.Hash]bool)
+	seenTrees := make(map[plumbing.Hash]bool)
+	commits, err := repo.repository.CommitObjects()
+	if err != nil {
+		return err
+	}
+	err = commits.ForEach(func(c *object.Commit) error {
+		return markTreeBlobs(repo.repository, c.TreeHash, seenTrees, referenced)
+	})
+	if err != nil {
+		return err
+	}
+
+	blobs, err := repo.repository.BlobObjects()
+	if err != nil {
+		return err
+	}
+	return blobs.ForEach(func(b *object.Blob) error {
+		if referenced[b.Hash] {
+			return nil
+		}
+		f := object.NewFile("unreachable blob "+b.Hash.String(), filemode.Regular, b)
+		commit := &Commit{
+			repoName: repo.name,
+			filePath: f.Name,
+			sha:      "N/A",
+		}
+		if skipWhitelistedFile(commit) || skipLargeFile(commit, b.Size) {
+			return nil
+		}
+		if bin, err := f.IsBinary(); bin || err != nil {
+			return nil
+		}
+		r, err := b.Reader()
+		if err != nil {
+			return nil
+		}
+		defer r.Close()
+		log.Debugf("auditing unreachable blob %s", b.Hash.String())
+		if err := repo.inspectReader(r, b.Size, commit); err != nil {
+			log.Debugf("unable to read unreachable blob %s: %v", b.Hash.String(), err)
+		}
+		return nil
+	})
+}
+
+// markTreeBlobs records the blobs of a tree and its subtrees in referenced. Trees are
+// shared heavily between commits so seenTrees keeps each one from being walked twice.
+func markTreeBlobs(repository *git.Repository, h plumbing.Hash, seenTrees, referenced map[plumbing.Hash]bool) error {
+	if seenTrees[h] {
+		return nil
+	}
+	seenTrees[h] = true
+	tree, err := repository.TreeObject(h)
+	if err != nil {
+		// missing trees are possible in damaged or shallow repos, nothing to mark
+		return nil
+	}
+	for _, entry := range tree.Entries {
+		switch entry.Mode {
+		case filemode.Dir:
+			if err := markTreeBlobs(repository, entry.Hash, seenTrees, referenced); err != nil {
+				return err
+			}
+		case filemode.Submodule:
+		default:
+			referenced[entry.Hash] = true
+		}
+	}
+	return nil
+}
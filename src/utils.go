@@ -1,195 +1,380 @@
 package gitleaks
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/zricethezav/gitleaks/src/detect"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
-// writeReport writes a report to a file specified in the --report= option.
-// Default format for report is JSON. You can use the --csv option to write the report as a csv
+// writeReport writes the report of leaks to every sink of the run, the file of --report
+// and those of --sink, see reportSink. Default format for report is JSON. You can use the
+// --csv option to write the report as a csv, or .html for a page reviewers can triage in a
+// browser. --report-format overrides the format of the file extension, e.g. junit for the
+// test tabs of CI servers, or ndjson to stream leaks to the report as they are found.
+// With --show-suppressed, matches suppressed by whitelists are written after the leaks,
+// with the whitelist suppressing them in suppressedBy.
+// Sinks failing to write do not stop the others, the first error is returned.
 func writeReport(leaks []Leak) error {
-	if len(leaks) == 0 {
-		return nil
+	if opts.CountOnly {
+		return writeCountReport()
+	}
+	sinks, err := reportSinks()
+	if err != nil {
+		return err
 	}
 
-	log.Infof("writing report to %s", opts.Report)
-	if strings.HasSuffix(opts.Report, ".csv") {
-		f, err := os.Create(opts.Report)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		w := csv.NewWriter(f)
-		w.Write([]string{"repo", "line", "commit", "offender", "rule", "info", "tags", "severity", "commitMsg", "author", "email", "file", "date"})
-		for _, leak := range leaks {
-			w.Write([]string{leak.Repo, leak.Line, leak.Commit, leak.Offender, leak.Rule, leak.Info, leak.Tags, leak.Severity, leak.Message, leak.Author, leak.Email, leak.File, leak.Date.Format(time.RFC3339)})
+	// leaks are found by concurrent commit audits, sorted reports of the same history
+	// are the same, so reports of runs can be diffed
+	sortLeaks(leaks)
+	if opts.Verify {
+		verifyLeaks(leaks)
+	}
+	sortLeaks(suppressedLeaks)
+
+	var firstErr error
+	for _, sink := range sinks {
+		format := sink.reportFormat()
+		if len(leaks) == 0 && len(suppressedLeaks) == 0 && format != "junit" && format != "template" {
+			// junit reports are written without leaks too, listing the rules as passed tests,
+			// and templates may render a summary of a clean audit
+			continue
 		}
-		w.Flush()
-	} else {
-		f, err := os.Create(opts.Report)
+		log.Infof("writing report to %s", sink)
+		reportTrace := startTrace("report", "").set("report", sink.String())
+		err := sink.writeLeaks(leaks)
+		reportTrace.finish()
 		if err != nil {
-			return err
-		}
-		defer f.Close()
-		encoder := json.NewEncoder(f)
-		encoder.SetIndent("", "\t")
-		if _, err := f.WriteString("[\n"); err != nil {
-			return err
-		}
-		for i := 0; i < len(leaks); i++ {
-			if err := encoder.Encode(leaks[i]); err != nil {
-				return err
-			}
-			// for all but the last leak, seek back and overwrite the newline appended by Encode() with comma & newline
-			if i+1 < len(leaks) {
-				if _, err := f.Seek(-1, 1); err != nil {
-					return err
-				}
-				if _, err := f.WriteString(",\n"); err != nil {
-					return err
-				}
+			log.Errorf("unable to write report to %s: %v", sink, err)
+			if firstErr == nil {
+				firstErr = err
 			}
 		}
-		if _, err := f.WriteString("]"); err != nil {
-			return err
-		}
-		if err := f.Sync(); err != nil {
-			log.Error(err)
-			return err
-		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if len(suppressedLeaks) != 0 {
+		log.Infof("%d matches suppressed by whitelists", len(suppressedLeaks))
 	}
 	return nil
 }
 
-// check rule will inspect a single line and return a leak if it encounters one
-func (rule *Rule) check(line string, commit *Commit) (*Leak, error) {
-	var (
-		match       string
-		fileMatch   string
-		entropy     float64
-		entropyWord string
-	)
-
-	for _, f := range rule.fileTypes {
-		fileMatch = f.FindString(commit.filePath)
-		if fileMatch != "" {
-			break
+// sortLeaks sorts leaks by repo, file, line number, rule and commit, and by column and
+// offender for several leaks in a line
+func sortLeaks(leaks []Leak) {
+	sort.SliceStable(leaks, func(i, j int) bool {
+		a, b := leaks[i], leaks[j]
+		switch {
+		case a.Repo != b.Repo:
+			return a.Repo < b.Repo
+		case a.File != b.File:
+			return a.File < b.File
+		case a.LineNumber != b.LineNumber:
+			return a.LineNumber < b.LineNumber
+		case a.Rule != b.Rule:
+			return a.Rule < b.Rule
+		case a.Commit != b.Commit:
+			return a.Commit < b.Commit
+		case a.StartColumn != b.StartColumn:
+			return a.StartColumn < b.StartColumn
 		}
-	}
+		return a.Offender < b.Offender
+	})
+}
 
-	if fileMatch == "" && len(rule.fileTypes) != 0 {
-		return nil, nil
+// writeJSONLeaks writes leaks to w as a JSON array, one encoded leak at a time
+func writeJSONLeaks(w io.Writer, leaks []Leak) error {
+	if _, err := io.WriteString(w, "[\n"); err != nil {
+		return err
 	}
-
-	if rule.entropies != nil {
-		if rule.entropyROI == "word" {
-			words := strings.Fields(line)
-			for _, word := range words {
-				_entropy := getShannonEntropy(word)
-				for _, e := range rule.entropies {
-					if _entropy > e.v1 && _entropy < e.v2 {
-						entropy = _entropy
-						entropyWord = word
-						goto postEntropy
-					}
-				}
-			}
+	for i := 0; i < len(leaks); i++ {
+		b, err := json.MarshalIndent(leaks[i], "", "\t")
+		if err != nil {
+			return err
+		}
+		// all but the last leak are followed by a comma
+		if i+1 < len(leaks) {
+			b = append(b, ",\n"...)
 		} else {
-			_entropy := getShannonEntropy(line)
-			for _, e := range rule.entropies {
-				if _entropy > e.v1 && _entropy < e.v2 {
-					entropy = _entropy
-					entropyWord = line
-					goto postEntropy
-				}
-			}
+			b = append(b, '\n')
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
 		}
 	}
-
-postEntropy:
-	if rule.regex != nil {
-		match = rule.regex.FindString(line)
-	}
-
-	if match != "" && entropy != 0.0 {
-		return newLeak(line, fmt.Sprintf("%s regex match and entropy met at %.2f", rule.regex.String(), entropy), entropyWord, rule, commit), nil
-	} else if match != "" && rule.entropies == nil {
-		return newLeak(line, fmt.Sprintf("%s regex match", rule.regex.String()), match, rule, commit), nil
-	} else if entropy != 0.0 && rule.regex.String() == "" {
-		return newLeak(line, fmt.Sprintf("entropy met at %.2f", entropy), entropyWord, rule, commit), nil
-	}
-	return nil, nil
+	_, err := io.WriteString(w, "]")
+	return err
 }
 
 // inspect will parse each line of the git diff's content against a set of regexes or
 // a set of regexes set by the config (see gitleaks.toml for example). This function
 // will skip lines that include a whitelisted regex. A list of leaks is returned.
 // If verbose mode (-v/--verbose) is set, then checkDiff will log leaks as they are discovered.
+// If --show-suppressed is set, matches on whitelisted lines and in whitelisted files are
+// collected as suppressed leaks instead of being dropped.
 func inspect(commit *Commit) []Leak {
 	var leaks []Leak
-	lines := strings.Split(commit.content, "\n")
-
-	for _, line := range lines {
-		for _, rule := range config.Rules {
-			if isLineWhitelisted(line) {
-				break
+	detector := config.detector
+	detector.KeepAllowed = opts.ShowSuppressed
+	detector.Entropies = entropyHistogram
+	detector.MaxLineLength = opts.MaxScanLineLength
+	detector.SkippedLine = func(filePath string, lineNumber, length int) {
+		log.Debugf("skipping line %d of %s in %s, %d bytes are above --max-scan-line-length", lineNumber, filePath, commit.sha, length)
+	}
+	findings := detector.Detect(detect.Fragment{
+		Content:   commit.content,
+		FilePath:  commit.filePath,
+		StartLine: commit.startLine,
+	})
+	firstLine := commit.startLine
+	if firstLine == 0 {
+		firstLine = 1
+	}
+	var lines []string
+	if opts.Context > 0 && len(findings) != 0 {
+		lines = strings.Split(strings.TrimSuffix(commit.content, "\n"), "\n")
+	}
+	for _, finding := range findings {
+		if finding.LineNumber == firstLine && inOverlap(finding.Line, finding.Offender, commit.overlap) {
+			continue
+		}
+		ignored, ignoredKind := ignoredLeak(commit.sha, commit.filePath, finding.Rule.Description), "fingerprint"
+		if ignored == nil {
+			ignored, ignoredKind = config.ruleCommits[finding.Rule][commit.sha], "rule commit"
+		}
+		if opts.CountOnly {
+			if finding.AllowedBy == nil && commit.suppressedBy == "" && ignored == nil {
+				countMatch(commit.repoName, finding.Rule.Description)
 			}
-			leak, err := rule.check(line, commit)
-			if err != nil || leak == nil {
+			continue
+		}
+		located := *commit
+		if commit.startLine != 0 {
+			located.lineNumber = finding.LineNumber
+		}
+		located.startColumn, located.endColumn = finding.StartColumn, finding.EndColumn
+		if lines != nil {
+			located.contextBefore, located.contextAfter = contextLines(lines, finding.LineNumber-firstLine, opts.Context)
+		}
+		findingCommit := &located
+		if re, ok := finding.AllowedBy.(*whitelistEntry); ok && commit.suppressedBy == "" {
+			c := *findingCommit
+			c.suppressedBy = re.suppression(finding.AllowedKind)
+			findingCommit = &c
+		} else if ignored != nil && commit.suppressedBy == "" {
+			if !opts.ShowSuppressed {
 				continue
 			}
-			leaks = append(leaks, *leak)
+			c := *findingCommit
+			c.suppressedBy = ignored.suppression(ignoredKind)
+			findingCommit = &c
 		}
+		leak := newLeak(finding.Line, finding.Info, finding.Offender, finding.Rule, findingCommit)
+		if leak.SuppressedBy != "" {
+			suppress(*leak)
+			continue
+		}
+		leaks = append(leaks, *leak)
 	}
 	return leaks
 }
 
-// isLineWhitelisted returns true iff the line is matched by at least one of the whiteListRegexes.
-func isLineWhitelisted(line string) bool {
+// whitelistedLine returns the first whitelist regex matching line, or nil if the line
+// is not whitelisted.
+func whitelistedLine(line string) *whitelistEntry {
 	for _, wRe := range config.WhiteList.regexes {
 		whitelistMatch := wRe.FindString(line)
 		if whitelistMatch != "" {
-			return true
+			return wRe
+		}
+	}
+	return nil
+}
+
+// whitelistedFile returns the first whitelist file regex matching filePath, or nil if
+// the file is not whitelisted.
+func whitelistedFile(filePath string) *whitelistEntry {
+	for _, re := range config.WhiteList.files {
+		if re.FindString(filePath) != "" || re.FindString(reportPath(filePath)) != "" {
+			return re
 		}
 	}
-	return false
+	return nil
+}
+
+// whitelistedRepo returns the first whitelist repo regex matching the name of a repo or
+// one of its urls, or nil if the repo is not whitelisted. Urls are matched without
+// credentials, and their path is matched too, e.g. "owner/name" of
+// https://github.com/owner/name.git, so repos of the same name owned by different teams
+// can be told apart.
+func whitelistedRepo(name string, urls ...string) *whitelistEntry {
+	ids := []string{name}
+	for _, u := range urls {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+			parsed.User = nil
+			ids = append(ids, parsed.String(), strings.TrimSuffix(strings.Trim(parsed.Path, "/"), ".git"))
+		} else if i := strings.Index(u, ":"); i != -1 && !strings.Contains(u[:i], "/") {
+			// scp-like ssh url, e.g. git@github.com:owner/name.git
+			ids = append(ids, u, strings.TrimSuffix(strings.Trim(u[i+1:], "/"), ".git"))
+		} else {
+			ids = append(ids, u)
+		}
+	}
+	for _, re := range config.WhiteList.repos {
+		for _, id := range ids {
+			if re.FindString(id) != "" {
+				return re
+			}
+		}
+	}
+	return nil
+}
+
+// whitelistedCommit returns the first whitelist author or message regex matching commit c,
+// or nil if the commit is not whitelisted. Authors are matched as "name <email>".
+func whitelistedCommit(c *object.Commit) *whitelistEntry {
+	author := fmt.Sprintf("%s <%s>", c.Author.Name, c.Author.Email)
+	for _, re := range config.WhiteList.authors {
+		if re.FindString(author) != "" {
+			return re
+		}
+	}
+	for _, re := range config.WhiteList.messages {
+		if re.FindString(c.Message) != "" {
+			return re
+		}
+	}
+	return nil
+}
+
+// suppress records a match suppressed by a whitelist for --show-suppressed
+func suppress(leak Leak) {
+	if opts.Verbose {
+		leak.log()
+	}
+	if leakStream != nil {
+		// streamed by newLeak already
+		return
+	}
+	mutex.Lock()
+	suppressedLeaks = append(suppressedLeaks, leak)
+	mutex.Unlock()
+}
+
+// reportTime returns t in the timezone of reports. Unknown dates, e.g. of leaks outside
+// of commits, are left as they are.
+func reportTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(timezone)
 }
 
 func newLeak(line string, info string, offender string, rule *Rule, commit *Commit) *Leak {
 	leak := &Leak{
-		Line:     line,
-		Commit:   commit.sha,
-		Offender: offender,
-		Rule:     rule.description,
-		Info:     info,
-		Author:   commit.author,
-		Email:    commit.email,
-		File:     commit.filePath,
-		Repo:     commit.repoName,
-		Message:  commit.message,
-		Date:     commit.date,
-		Tags:     strings.Join(rule.tags, ", "),
-		Severity: rule.severity,
+		Line:        line,
+		Commit:      commit.sha,
+		Offender:    offender,
+		Rule:        rule.Description,
+		RuleID:      rule.ID,
+		Info:        info,
+		Author:      commit.author,
+		Email:       commit.email,
+		File:        reportPath(commit.filePath),
+		Repo:        commit.repoName,
+		Message:     commit.message,
+		Date:        reportTime(commit.date),
+		CommitDate:  reportTime(commit.committerDate),
+		Tags:        strings.Join(rule.Tags, ", "),
+		Severity:    rule.Severity,
+		RunID:       runID,
+		SpanID:      spanID(),
+		LineNumber:  commit.lineNumber,
+		StartColumn: commit.startColumn,
+		EndColumn:   commit.endColumn,
+		Layer:       commit.layer,
+		blob:        commit.blob,
+
+		SuppressedBy: commit.suppressedBy,
+
+		ContextBefore: commit.contextBefore,
+		ContextAfter:  commit.contextAfter,
+	}
+	if leak.RuleID == "" {
+		leak.RuleID = ruleID(rule.Description)
+	}
+	leak.stampRule(rule)
+	leak.ExtraFields = extraFields()
+	leak.Fingerprint = findingFingerprint(leak.Repo, leak.Commit, leak.File, leak.RuleID, leak.LineNumber, leak.StartColumn, offender)
+	if isRevoked(offender) {
+		log.Debugf("secret of %s in %s of %s is in --revoked-feed", leak.Rule, leak.File, leak.Commit)
+		leak.Revoked = true
+	}
+	if opts.Verify && leak.SuppressedBy == "" {
+		if leak.verifier = config.ruleVerifiers[rule]; leak.verifier != "" {
+			leak.secret, leak.content = offender, commit.content
+		}
 	}
 	if opts.Redact {
-		leak.Offender = "REDACTED"
-		leak.Line = strings.Replace(line, offender, "REDACTED", -1)
+		leak.Offender = redact(offender)
+		leak.Line = strings.Replace(line, offender, leak.Offender, -1)
+		leak.ContextBefore = replaceInLines(leak.ContextBefore, offender, leak.Offender)
+		leak.ContextAfter = replaceInLines(leak.ContextAfter, offender, leak.Offender)
 	}
+	truncateLeak(leak)
 
-	if opts.Verbose {
+	if opts.Verbose && leak.SuppressedBy == "" {
 		leak.log()
 	}
+	streamLeak(*leak)
 	return leak
 }
 
+// contextLines returns up to n lines of lines before and after the line at index i
+func contextLines(lines []string, i, n int) ([]string, []string) {
+	if i < 0 || i >= len(lines) {
+		return nil, nil
+	}
+	first, last := i-n, i+1+n
+	if first < 0 {
+		first = 0
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	var before, after []string
+	before = append(before, lines[first:i]...)
+	after = append(after, lines[i+1:last]...)
+	return before, after
+}
+
+// replaceInLines returns lines with every old replaced by new, e.g. to redact secrets
+// repeated in the context of a leak
+func replaceInLines(lines []string, old, new string) []string {
+	if len(lines) == 0 || old == "" {
+		return lines
+	}
+	replaced := make([]string, len(lines))
+	for i, line := range lines {
+		replaced[i] = strings.Replace(line, old, new, -1)
+	}
+	return replaced
+}
+
 // discoverRepos walks all the children of `path`. If a child directory
 // contain a .git subdirectory then that repo will be added to the list of repos returned
 func discoverRepos(ownerPath string) ([]*Repo, error) {
@@ -204,8 +389,13 @@ func discoverRepos(ownerPath string) ([]*Repo, error) {
 	for _, f := range files {
 		repoPath := path.Join(ownerPath, f.Name())
 		if f.IsDir() && containsGit(repoPath) {
+			name := f.Name()
+			// bare repos, like those of git servers, are named like their clones
+			if gitDir(repoPath) == repoPath {
+				name = strings.TrimSuffix(name, ".git")
+			}
 			repoDs = append(repoDs, &Repo{
-				name: f.Name(),
+				name: name,
 				path: repoPath,
 			})
 		}
@@ -213,6 +403,27 @@ func discoverRepos(ownerPath string) ([]*Repo, error) {
 	return repoDs, err
 }
 
+// ownerCloneDir returns the directory the repos of an owner (user, org, group) are cloned
+// into when cloning to disk. Normally this is a fresh temporary directory. With
+// --keep-clones it is --keep-clones itself, as plainClone keeps each repo at
+// keptClonePath of its url.
+func ownerCloneDir(owner string) (string, error) {
+	if opts.KeepClones != "" {
+		return dir, os.MkdirAll(dir, 0755)
+	}
+	return ioutil.TempDir(dir, owner)
+}
+
+// removeClone deletes a disk clone after it has been audited unless --keep-clones or
+// --no-cleanup is set
+func removeClone(clonePath string) {
+	if opts.KeepClones != "" || opts.NoCleanup {
+		log.Debugf("keeping clone %s", clonePath)
+		return
+	}
+	os.RemoveAll(clonePath)
+}
+
 func (leak Leak) log() {
 	b, _ := json.MarshalIndent(leak, "", "   ")
 	fmt.Println(string(b))
@@ -0,0 +1,281 @@
+package gitleaks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// verifier checks with its provider whether the secret of a leak is live. It returns
+// true if the provider accepts the secret, false if it rejects it, and an error if it
+// can not tell, e.g. as the provider is unreachable. The content of the leak, the file or
+// diff the secret is found in, is searched by verifiers needing a second secret, like the
+// secret key of an aws access key id.
+type verifier func(leak Leak) (bool, error)
+
+// verifiers are the verifiers of --verify by name, picked by the verifier of a rule
+var verifiers = map[string]verifier{
+	"aws":    verifyAWS,
+	"github": verifyGithub,
+	"slack":  verifySlack,
+}
+
+// defaultVerifiers are the verifiers of rules without a verifier in the config, by rule
+// id, those of the rules of the default config
+var defaultVerifiers = map[string]string{
+	"aws-client-id": "aws",
+	"github":        "github",
+	"slack":         "slack",
+}
+
+var (
+	// stsURL, slackAPIURL and githubAPIURL are the apis secrets are verified with. GitHub
+	// tokens of repos hosted on a GitHub Enterprise server are verified with --github-url.
+	stsURL       = "https://sts.amazonaws.com/"
+	slackAPIURL  = "https://slack.com/api/"
+	githubAPIURL = defaultGithubURL
+
+	verifyClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// verifyLeaks sets whether the secrets of leaks are live, once the audit finishes and
+// its leaks are deduplicated. Each secret is verified once, however many commits, refs
+// and repos it is found in.
+func verifyLeaks(leaks []Leak) {
+	var keys []string
+	secrets := make(map[string][]int)
+	for i, leak := range leaks {
+		if leak.verifier == "" {
+			continue
+		}
+		key := verifyKey(leak)
+		if _, ok := secrets[key]; !ok {
+			keys = append(keys, key)
+		}
+		secrets[key] = append(secrets[key], i)
+	}
+	for _, key := range keys {
+		verified := verifySecret(leaks, secrets[key])
+		for _, i := range secrets[key] {
+			leaks[i].Verified = verified
+		}
+	}
+}
+
+// verifyKey identifies the secret of a leak by its verifier and hash, and for github
+// tokens by the api they are verified with
+func verifyKey(leak Leak) string {
+	sum := sha256.Sum256([]byte(leak.secret))
+	key := leak.verifier + ":" + hex.EncodeToString(sum[:])
+	if leak.verifier == "github" {
+		key += ":" + githubVerifyURL(leak.Repo)
+	}
+	return key
+}
+
+// verifySecret verifies the secret shared by the leaks at indexes, with the content of
+// each leak until its verifier can tell, or returns nil if it can not
+func verifySecret(leaks []Leak, indexes []int) *bool {
+	tried := make(map[string]bool)
+	for _, i := range indexes {
+		leak := leaks[i]
+		if tried[leak.content] {
+			continue
+		}
+		tried[leak.content] = true
+		live, err := verifiers[leak.verifier](leak)
+		if err != nil {
+			log.Debugf("unable to verify secret of %s: %v", leak.Rule, err)
+			continue
+		}
+		if live {
+			log.Warnf("secret of %s is live, verified with %s", leak.Rule, leak.verifier)
+		}
+		return &live
+	}
+	return nil
+}
+
+// awsSecretKeyRe matches candidate aws secret access keys, 40 characters of base64
+var awsSecretKeyRe = regexp.MustCompile(`(?:^|[^0-9A-Za-z/+])([0-9A-Za-z/+]{40})(?:[^0-9A-Za-z/+=]|$)`)
+
+// maxAWSSecretKeys is the number of candidate secret keys tried per access key id
+const maxAWSSecretKeys = 10
+
+// verifyAWS calls sts GetCallerIdentity with an access key id and each candidate secret
+// key of content until one is accepted. Key ids unknown to aws are not live. Temporary
+// credentials, ASIA key ids, are not verified as they need their session token.
+func verifyAWS(leak Leak) (bool, error) {
+	keyID := leak.secret
+	if strings.HasPrefix(keyID, "ASIA") {
+		return false, fmt.Errorf("temporary key ids need their session token")
+	}
+	tried := make(map[string]bool)
+	for _, match := range awsSecretKeyRe.FindAllStringSubmatch(leak.content, -1) {
+		secretKey := match[1]
+		if tried[secretKey] || len(tried) == maxAWSSecretKeys {
+			continue
+		}
+		tried[secretKey] = true
+
+		body := "Action=GetCallerIdentity&Version=2011-06-15"
+		req, err := http.NewRequest("POST", stsURL, strings.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		payloadHash := sha256.Sum256([]byte(body))
+		now := time.Now().UTC()
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+		req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+		signAWSv4(req, keyID, secretKey, "us-east-1", "sts", now)
+
+		status, response, err := verifyRequest(req)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case status == http.StatusOK:
+			return true, nil
+		case strings.Contains(response, "InvalidClientTokenId"):
+			return false, nil
+		case strings.Contains(response, "SignatureDoesNotMatch"):
+			// the key id is known, but this is not its secret key
+			continue
+		}
+		return false, fmt.Errorf("sts responded %d", status)
+	}
+	if len(tried) == 0 {
+		return false, fmt.Errorf("no secret key next to the access key id")
+	}
+	return false, fmt.Errorf("none of %d secret keys next to the access key id match it", len(tried))
+}
+
+// githubTokenRe matches the token of an offender of the github rule, which includes the
+// name of its variable
+var githubTokenRe = regexp.MustCompile(`(?:gh[pousr]_)?[0-9A-Za-z_]{35,255}`)
+
+// githubVerifyURL returns the api the github tokens found in repo are verified with, that
+// of github.com for repos hosted on github.com and --github-url for repos hosted on its
+// GitHub Enterprise server. Tokens of repos hosted elsewhere or without a remote, like
+// --path audits, belong to an unknown host and are not sent anywhere.
+func githubVerifyURL(repo string) string {
+	host, _, ok := parseRemoteURL(repoRemoteURLs[repo])
+	if !ok {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "github.com" || host == "www.github.com" {
+		return githubAPIURL
+	}
+	if opts.GithubURL != "" && opts.GithubURL != defaultGithubURL {
+		if u, err := url.Parse(opts.GithubURL); err == nil && u.Hostname() == host {
+			return opts.GithubURL
+		}
+	}
+	return ""
+}
+
+// verifyGithub fetches the user of a token from the api of the host of the repo it is
+// found in, see githubVerifyURL
+func verifyGithub(leak Leak) (bool, error) {
+	tokens := githubTokenRe.FindAllString(leak.secret, -1)
+	if len(tokens) == 0 {
+		return false, fmt.Errorf("no token in the offender")
+	}
+	apiURL := githubVerifyURL(leak.Repo)
+	if apiURL == "" {
+		return false, fmt.Errorf("%s is not hosted on github.com or --github-url", leak.Repo)
+	}
+	req, err := http.NewRequest("GET", strings.TrimSuffix(apiURL, "/")+"/user", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "token "+tokens[len(tokens)-1])
+	status, _, err := verifyRequest(req)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusUnauthorized:
+		return false, nil
+	}
+	return false, fmt.Errorf("github responded %d", status)
+}
+
+// slackTokenRe matches whole slack tokens, of which the slack rule matches a prefix
+var slackTokenRe = regexp.MustCompile(`xox[a-z]-[0-9A-Za-z-]+`)
+
+// slackRevokedErrors are the errors of auth.test for tokens which are not live
+var slackRevokedErrors = map[string]bool{
+	"invalid_auth":     true,
+	"not_authed":       true,
+	"account_inactive": true,
+	"token_revoked":    true,
+	"token_expired":    true,
+}
+
+// verifySlack calls auth.test with the whole token of content starting with the secret
+func verifySlack(leak Leak) (bool, error) {
+	token := leak.secret
+	for _, t := range slackTokenRe.FindAllString(leak.content, -1) {
+		if strings.HasPrefix(t, leak.secret) && len(t) > len(token) {
+			token = t
+		}
+	}
+	req, err := http.NewRequest("POST", slackAPIURL+"auth.test", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	status, response, err := verifyRequest(req)
+	if err != nil {
+		return false, err
+	} else if status != http.StatusOK {
+		return false, fmt.Errorf("slack responded %d", status)
+	}
+	var authTest struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(response), &authTest); err != nil {
+		return false, fmt.Errorf("invalid auth.test response: %v", err)
+	}
+	if authTest.OK {
+		return true, nil
+	} else if slackRevokedErrors[authTest.Error] {
+		return false, nil
+	}
+	return false, fmt.Errorf("slack responded %s", authTest.Error)
+}
+
+// verifyRequest sends req and returns the status and up to 64KB of the body of its
+// response
+func verifyRequest(req *http.Request) (int, string, error) {
+	req.Header.Set("User-Agent", "gitleaks/"+version)
+	resp, err := verifyClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, string(body), nil
+}
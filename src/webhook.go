@@ -0,0 +1,187 @@
+package gitleaks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookConfig is the [notify.webhook] section of the config
+type webhookConfig struct {
+	// url may reference environment variables like headers, for urls carrying tokens
+	url string
+	// headers are sent with every notification. Values may reference environment
+	// variables, e.g. "Bearer ${SOAR_TOKEN}", so tokens are not committed.
+	headers map[string]string
+	// secret signs notifications, see signWebhook. It may reference environment
+	// variables like headers.
+	secret string
+	// retries is the number of retries of failed notifications, waiting backoff before
+	// the first retry and twice as long before each further one
+	retries int
+	backoff time.Duration
+}
+
+// webhookPayload is posted to the webhook for every audited repo with new leaks
+type webhookPayload struct {
+	RunID       string            `json:"runID"`
+	Version     string            `json:"version"`
+	Repo        string            `json:"repo"`
+	ExtraFields map[string]string `json:"extraFields,omitempty"`
+	Leaks       []Leak            `json:"leaks"`
+}
+
+// newWebhookConfig validates the [notify.webhook] section of a config
+func newWebhookConfig(tomlConfig TomlConfig) (webhookConfig, error) {
+	webhook := tomlConfig.Notify.Webhook
+	cfg, err := newDelivery("notify.webhook", webhook.URL, webhook.Retries, webhook.Backoff)
+	cfg.headers = webhook.Headers
+	cfg.secret = webhook.Secret
+	return cfg, err
+}
+
+// newDelivery validates the url, retries and backoff of the notify section of a config.
+// Defaults are 3 retries and a backoff of 1s.
+func newDelivery(section, rawURL string, retries *int, backoff string) (webhookConfig, error) {
+	cfg := webhookConfig{
+		url:     rawURL,
+		retries: 3,
+		backoff: time.Second,
+	}
+	if retries != nil {
+		cfg.retries = *retries
+	}
+	if cfg.retries < 0 {
+		return cfg, fmt.Errorf("retries of [%s] can not be negative", section)
+	}
+	if backoff != "" {
+		d, err := time.ParseDuration(backoff)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid backoff of [%s]: %v", section, err)
+		}
+		cfg.backoff = d
+	}
+	if cfg.url != "" {
+		if err := validateWebhookURL(os.ExpandEnv(cfg.url)); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// validateWebhookURL returns an error if rawURL is not an http or https url
+func validateWebhookURL(rawURL string) error {
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook url %s must be an http or https url", rawURL)
+	}
+	return nil
+}
+
+// notifyWebhook posts the new leaks of a repo to --webhook-url or the url of
+// [notify.webhook]. Notifications which fail after all retries degrade the audit,
+// since the findings did not reach their destination. Returns false if the notification
+// failed.
+func notifyWebhook(repoName string, leaks []Leak) bool {
+	if opts.CountOnly || config == nil || len(leaks) == 0 {
+		return true
+	}
+	webhook := config.webhook
+	if opts.WebhookURL != "" {
+		webhook.url = opts.WebhookURL
+	}
+	if webhook.url == "" {
+		return true
+	}
+	err := deliver(webhook, webhookPayload{
+		RunID:       runID,
+		Version:     version,
+		Repo:        repoName,
+		ExtraFields: extraFields(),
+		Leaks:       leaks,
+	})
+	if err != nil {
+		log.Warnf("unable to notify webhook of %d leaks of %s: %v", len(leaks), repoName, err)
+		degrade()
+		return false
+	}
+	log.Debugf("notified webhook of %d leaks of %s", len(leaks), repoName)
+	return true
+}
+
+// deliver posts payload as json to the url of target, retrying failures which may pass
+func deliver(target webhookConfig, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return deliverBody(target, b, "application/json")
+}
+
+// deliverBody posts body of contentType to the url of target, retrying failures which
+// may pass
+func deliverBody(target webhookConfig, body []byte, contentType string) error {
+	// retries of a notification keep its nonce, so receivers can drop duplicates
+	nonce := newSpanID()
+	backoff := target.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := postWebhook(target, body, contentType, nonce)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == target.retries {
+			return err
+		}
+		log.Debugf("notification failed, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postWebhook posts payload of contentType to the webhook. Retry is set for errors which may pass,
+// like network errors, rate limits and server errors.
+func postWebhook(webhook webhookConfig, payload []byte, contentType, nonce string) (retry bool, err error) {
+	req, err := http.NewRequest("POST", os.ExpandEnv(webhook.url), bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range webhook.headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	if secret := os.ExpandEnv(webhook.secret); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Gitleaks-Timestamp", timestamp)
+		req.Header.Set("X-Gitleaks-Nonce", nonce)
+		req.Header.Set("X-Gitleaks-Signature", "sha256="+signWebhook(secret, timestamp, nonce, payload))
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, fmt.Errorf("%s", resp.Status)
+	}
+	return false, nil
+}
+
+// signWebhook returns the hex hmac-sha256 with secret of the timestamp, nonce and
+// payload of a notification, joined by dots. Receivers recompute it to authenticate
+// notifications, and reject old timestamps and seen nonces to stop replays.
+func signWebhook(secret, timestamp, nonce string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,195 @@
+package gitleaks
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/microsoft/azure-devops-go-api/azuredevops"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/webapi"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/workitemtracking"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultFingerprintField is the custom field holding the fingerprints of work items
+const defaultFingerprintField = "Custom.GitleaksFingerprint"
+
+// fieldName matches the reference names of work item fields, which are put into queries
+var fieldName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)+$`)
+
+// workItemsConfig is the [notify.azureBoards] section of the config
+type workItemsConfig struct {
+	organization string
+	project      string
+	workItemType string
+	areaPath     string
+	tags         []string
+	// fingerprintField is the reference name of the field of the fingerprint of the
+	// leak of a work item, which finds the work item of a leak in later runs
+	fingerprintField string
+}
+
+// workItemClient is the part of the work item tracking api used to file leaks
+type workItemClient interface {
+	QueryByWiql(context.Context, workitemtracking.QueryByWiqlArgs) (*workitemtracking.WorkItemQueryResult, error)
+	CreateWorkItem(context.Context, workitemtracking.CreateWorkItemArgs) (*workitemtracking.WorkItem, error)
+	UpdateWorkItem(context.Context, workitemtracking.UpdateWorkItemArgs) (*workitemtracking.WorkItem, error)
+}
+
+// newWorkItemClient connects to the work item tracking api of an organization
+var newWorkItemClient = func(ctx context.Context, organization, token string) (workItemClient, error) {
+	return workitemtracking.NewClient(ctx, azuredevops.NewPatConnection(organization, token))
+}
+
+// newWorkItemsConfig validates the [notify.azureBoards] section of a config
+func newWorkItemsConfig(tomlConfig TomlConfig) (workItemsConfig, error) {
+	boards := tomlConfig.Notify.AzureBoards
+	cfg := workItemsConfig{
+		organization:     os.ExpandEnv(boards.Organization),
+		project:          boards.Project,
+		workItemType:     boards.Type,
+		areaPath:         boards.AreaPath,
+		tags:             boards.Tags,
+		fingerprintField: boards.FingerprintField,
+	}
+	if cfg.organization == "" {
+		return cfg, nil
+	}
+	if u, err := url.Parse(cfg.organization); err != nil || u.Scheme != "https" || u.Host == "" {
+		return cfg, fmt.Errorf("organization of [notify.azureBoards] must be an https url, e.g. https://dev.azure.com/org")
+	}
+	if cfg.project == "" {
+		return cfg, fmt.Errorf("[notify.azureBoards] needs the project of the work items")
+	}
+	if cfg.workItemType == "" {
+		cfg.workItemType = "Bug"
+	}
+	if cfg.fingerprintField == "" {
+		cfg.fingerprintField = defaultFingerprintField
+	}
+	if !fieldName.MatchString(cfg.fingerprintField) {
+		return cfg, fmt.Errorf("invalid fingerprintField %q of [notify.azureBoards], expected a reference name like %s", cfg.fingerprintField, defaultFingerprintField)
+	}
+	return cfg, nil
+}
+
+// notifyWorkItems files a work item of [notify.azureBoards] for each new leak of repo,
+// assigned to the first owner of its file in the CODEOWNERS of the repo. Leaks already
+// filed in earlier runs, found by their fingerprint, update their work item instead.
+func notifyWorkItems(repo *Repo, leaks []Leak) {
+	if opts.CountOnly || config == nil || config.workItems.organization == "" || len(leaks) == 0 {
+		return
+	}
+	boards := config.workItems
+	token := os.Getenv("AZURE_DEVOPS_TOKEN")
+	if token == "" {
+		log.Warnf("AZURE_DEVOPS_TOKEN is not set, not filing work items of %d leaks of %s", len(leaks), repo.name)
+		degrade()
+		return
+	}
+	ctx := context.Background()
+	client, err := newWorkItemClient(ctx, boards.organization, token)
+	if err != nil {
+		log.Warnf("unable to connect to %s: %v", boards.organization, err)
+		degrade()
+		return
+	}
+
+	owners := repoCodeowners(repo)
+	created, updated := 0, 0
+	for _, leak := range leaks {
+		isNew, err := upsertWorkItem(ctx, client, boards, leak, workItemOwner(owners.owners(leak.File)))
+		if err != nil {
+			log.Warnf("unable to file the work item of leak %s of %s: %v", leak.Fingerprint, repo.name, err)
+			degrade()
+			continue
+		}
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
+	}
+	log.Infof("filed work items of the leaks of %s: %d created, %d updated", repo.name, created, updated)
+}
+
+// upsertWorkItem creates the work item of leak, or updates it if it was filed before.
+// It returns true if the work item was created.
+func upsertWorkItem(ctx context.Context, client workItemClient, boards workItemsConfig, leak Leak, owner string) (bool, error) {
+	// fingerprints are hex and the field name is validated, so the query is safe
+	query := fmt.Sprintf("SELECT [System.Id] FROM WorkItems WHERE [System.TeamProject] = @project AND [%s] = '%s'",
+		boards.fingerprintField, leak.Fingerprint)
+	result, err := client.QueryByWiql(ctx, workitemtracking.QueryByWiqlArgs{
+		Wiql:    &workitemtracking.Wiql{Query: &query},
+		Project: &boards.project,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	document := workItemDocument(boards, leak, owner)
+	if result != nil && result.WorkItems != nil && len(*result.WorkItems) != 0 && (*result.WorkItems)[0].Id != nil {
+		_, err = client.UpdateWorkItem(ctx, workitemtracking.UpdateWorkItemArgs{
+			Document: &document,
+			Id:       (*result.WorkItems)[0].Id,
+			Project:  &boards.project,
+		})
+		return false, err
+	}
+	_, err = client.CreateWorkItem(ctx, workitemtracking.CreateWorkItemArgs{
+		Document: &document,
+		Project:  &boards.project,
+		Type:     &boards.workItemType,
+	})
+	return err == nil, err
+}
+
+// workItemDocument returns the fields of the work item of leak. The secret itself is
+// left out, work items are visible to far more people than reports.
+func workItemDocument(boards workItemsConfig, leak Leak, owner string) []webapi.JsonPatchOperation {
+	var document []webapi.JsonPatchOperation
+	set := func(field string, value interface{}) {
+		op, path := webapi.OperationValues.Add, "/fields/"+field
+		document = append(document, webapi.JsonPatchOperation{Op: &op, Path: &path, Value: value})
+	}
+
+	set("System.Title", fmt.Sprintf("Secret found by gitleaks: %s in %s/%s", leak.Rule, leak.Repo, leak.File))
+	location := html.EscapeString(leak.File)
+	if leak.LineNumber != 0 {
+		location += fmt.Sprintf(", line %d", leak.LineNumber)
+	}
+	if link := fileLink(repoRemoteURLs[leak.Repo], leak.Commit, leak.File); link != "" {
+		location = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link), location)
+	}
+	set("System.Description", fmt.Sprintf(
+		"<p>gitleaks found a secret of rule <b>%s</b> (%s) in %s.</p><ul><li>repo: %s</li><li>commit: %s</li><li>author: %s, %s</li><li>run: %s</li></ul><p>Revoke the secret, then remove it from the history or whitelist it.</p>",
+		html.EscapeString(leak.Rule), html.EscapeString(leak.RuleID), location, html.EscapeString(leak.Repo),
+		html.EscapeString(leak.Commit), html.EscapeString(leak.Author), leak.Date.Format("2006-01-02"), html.EscapeString(leak.RunID)))
+	if boards.areaPath != "" {
+		set("System.AreaPath", boards.areaPath)
+	}
+	if len(boards.tags) != 0 {
+		set("System.Tags", strings.Join(boards.tags, "; "))
+	}
+	if owner != "" {
+		set("System.AssignedTo", owner)
+	}
+	set(boards.fingerprintField, leak.Fingerprint)
+	return document
+}
+
+// workItemOwner returns the first of owners work items can be assigned to. Teams, like
+// @org/team, can not be assigned.
+func workItemOwner(owners []string) string {
+	for _, owner := range owners {
+		if strings.Contains(owner, "/") {
+			continue
+		}
+		return strings.TrimPrefix(owner, "@")
+	}
+	return ""
+}